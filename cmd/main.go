@@ -1,16 +1,30 @@
 package main
 
 import (
+	"log"
 	"net/http"
+	"time"
+	_ "time/tzdata" // Embed the zone database for per-account time zones
 
 	"github.com/ashX04/new_website/internal/handlers"
 	"github.com/ashX04/new_website/internal/middleware"
+	"github.com/ashX04/new_website/internal/storage"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	// Set up blob storage for uploaded images and generated files
+	blobStore, err := storage.NewFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to initialise blob storage: %v", err)
+	}
+	storage.Default = blobStore
+
+	// Check for expiring stock in the background
+	go handlers.RunExpiryAlerts(time.Hour)
+
 	r := gin.Default()
 
 	// Create a secure random key
@@ -34,7 +48,6 @@ func main() {
 
 	// Serve static files
 	r.Static("/static", "./static")
-	r.Static("/uploads", "./uploads")
 
 	// Load HTML templates
 	r.LoadHTMLGlob("internal/templates/*")
@@ -50,6 +63,7 @@ func main() {
 	r.POST("/register", gin.WrapF(handlers.RegisterProcess))
 	r.POST("/login", handlers.LoginProcess)
 	r.GET("/logout", handlers.Logout)
+	r.GET("/blobs/*key", handlers.ServeBlob)
 
 	// Protected routes (require authentication)
 	authorized := r.Group("/")
@@ -65,6 +79,56 @@ func main() {
 		authorized.GET("/preview/:id", handlers.PreviewImage)
 		authorized.GET("/preview/:id/", handlers.PreviewImage)
 		authorized.GET("/download-multiple", handlers.DownloadMultipleFiles)
+		authorized.GET("/invoices/:id/tally", handlers.ExportTally)
+		authorized.GET("/tally-export", handlers.ExportTallyBatch)
+		authorized.GET("/settings", handlers.ShowSettings)
+		authorized.POST("/settings", handlers.SaveSettings)
+		authorized.GET("/invoices/:id", handlers.ShowInvoice)
+		authorized.POST("/invoices/:id/rematch", handlers.RematchInvoice)
+		authorized.POST("/invoices/:id/lines/:line/match", handlers.ConfirmMatch)
+		authorized.GET("/products", handlers.ShowProducts)
+		authorized.POST("/products", handlers.SaveProduct)
+		authorized.POST("/products/:id/delete", handlers.DeleteProduct)
+		authorized.GET("/products/:id/prices", handlers.ShowPriceHistory)
+		authorized.GET("/suppliers", handlers.ShowSuppliers)
+		authorized.POST("/suppliers", handlers.SaveSupplier)
+		authorized.POST("/suppliers/:id/approve", handlers.ApproveSupplier)
+		authorized.POST("/suppliers/:id/merge", handlers.MergeSupplier)
+		authorized.POST("/suppliers/:id/delete", handlers.DeleteSupplier)
+		authorized.POST("/invoices/:id/supplier", handlers.LinkInvoiceSupplier)
+		authorized.POST("/invoices/:id/order", handlers.LinkInvoiceOrder)
+		authorized.POST("/invoices/:id/approve", handlers.ApproveInvoice)
+		authorized.POST("/invoices/:id/reverse", handlers.ReverseInvoice)
+		authorized.GET("/inventory", handlers.ShowInventory)
+		authorized.GET("/inventory/ledger", handlers.ShowLedger)
+		authorized.POST("/inventory/movements", handlers.RecordMovement)
+		authorized.GET("/inventory/expiry", handlers.ShowExpiry)
+		authorized.GET("/notifications", handlers.ShowNotifications)
+		authorized.POST("/notifications/read", handlers.MarkNotificationsRead)
+		authorized.GET("/output-templates", handlers.ShowTemplates)
+		authorized.POST("/output-templates", handlers.SaveTemplate)
+		authorized.POST("/output-templates/use", handlers.UseTemplate)
+		authorized.POST("/output-templates/:id/delete", handlers.DeleteTemplate)
+		authorized.GET("/gst/register", handlers.ShowPurchaseRegister)
+		authorized.GET("/gst/reconcile", handlers.ShowReconcile)
+		authorized.POST("/gst/reconcile", handlers.ReconcileGSTR2B)
+		authorized.GET("/analytics", handlers.ShowAnalytics)
+		authorized.GET("/orders", handlers.ShowOrders)
+		authorized.POST("/orders", handlers.SaveOrder)
+		authorized.GET("/orders/:id", handlers.ShowOrder)
+		authorized.POST("/orders/:id/delete", handlers.DeleteOrder)
+		authorized.GET("/payables", handlers.ShowPayables)
+		authorized.GET("/payables/:id", handlers.ShowSupplierAccount)
+		authorized.POST("/payables/:id/payments", handlers.RecordPayment)
+		authorized.POST("/payables/:id/payments/:payment/delete", handlers.DeletePayment)
+		authorized.GET("/payables/:id/statement", handlers.ShowStatement)
+		authorized.GET("/customers", handlers.ShowCustomers)
+		authorized.POST("/customers", handlers.SaveCustomer)
+		authorized.POST("/customers/:id/delete", handlers.DeleteCustomer)
+		authorized.GET("/sales", handlers.ShowSales)
+		authorized.POST("/sales", handlers.SaveSale)
+		authorized.GET("/sales/:id", handlers.ShowSale)
+		authorized.POST("/sales/:id/cancel", handlers.CancelSale)
 	}
 
 	// Start the server
@@ -0,0 +1,269 @@
+// Package analytics sums processed purchase invoices into spend by month,
+// supplier and product, tax by rate and product price trends, and lays them
+// out as charts the templates draw as inline SVG.
+package analytics
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ashX04/new_website/internal/gst"
+)
+
+// topN is how many suppliers and products the report ranks
+const topN = 10
+
+// Line is a product line of a purchase
+type Line struct {
+	// Index is the position of the line in the invoice
+	Index int
+	// Product is the product master ID, or the normalised name of lines
+	// not linked to the master
+	Product     string
+	ProductName string
+	// Quantity is the billed quantity; free goods are not included
+	Quantity float64
+	Taxable  int64
+	// Rate and MRP are the printed rate and MRP in paise, zero when not
+	// printed
+	Rate int64
+	MRP  int64
+}
+
+// Purchase is one purchase invoice. Dates are at midnight UTC, like
+// invoice dates.
+type Purchase struct {
+	ID     string
+	Number string
+	Date   time.Time
+	// Supplier is the supplier's GSTIN, or its normalised name without one
+	Supplier     string
+	SupplierName string
+	Rates        []gst.RateTotal
+	Lines        []Line
+}
+
+// Total sums the purchase's rates
+func (p *Purchase) Total() gst.RateTotal {
+	var total gst.RateTotal
+	for _, r := range p.Rates {
+		total.Add(r)
+	}
+	return total
+}
+
+// Spend is the invoice value: taxable value plus tax
+func (p *Purchase) Spend() int64 {
+	total := p.Total()
+	return total.Taxable + total.Tax()
+}
+
+// ProductKey identifies a line's product: its master ID, or its name
+// upper-cased with runs of spaces collapsed
+func ProductKey(productID, name string) string {
+	if productID != "" {
+		return productID
+	}
+	return "name:" + strings.ToUpper(strings.Join(strings.Fields(name), " "))
+}
+
+// Filter narrows the purchases a report covers. Empty fields do not filter.
+type Filter struct {
+	// From and To are the first and last month of the report
+	From time.Time
+	To   time.Time
+	// Month narrows the invoice list, but not the charts, to one month
+	Month    time.Time
+	Supplier string
+	// Product keeps invoices with a line of the product and adds its price
+	// trend to the report
+	Product string
+}
+
+// matches reports whether a purchase is in the filter's months, supplier
+// and product
+func (f Filter) matches(p *Purchase) bool {
+	if p.Date.Before(f.From) || !p.Date.Before(f.To.AddDate(0, 1, 0)) {
+		return false
+	}
+	if f.Supplier != "" && p.Supplier != f.Supplier {
+		return false
+	}
+	if f.Product != "" {
+		for _, l := range p.Lines {
+			if l.Product == f.Product {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// MonthTotal is the spend of one month
+type MonthTotal struct {
+	Month    time.Time
+	Spend    int64
+	Tax      int64
+	Invoices int
+}
+
+// Ranked is a supplier or product with what was bought from or of it
+type Ranked struct {
+	Key   string
+	Name  string
+	Spend int64
+	// Invoices counts the invoices of a supplier, or those with a product
+	Invoices int
+	Quantity float64
+}
+
+// MonthPrice is the average price paid for a product in one month
+type MonthPrice struct {
+	Month    time.Time
+	Quantity float64
+	Taxable  int64
+}
+
+// Average is the taxable value per billed unit in paise, zero if nothing
+// with a quantity was bought
+func (m MonthPrice) Average() float64 {
+	if m.Quantity == 0 {
+		return 0
+	}
+	return float64(m.Taxable) / m.Quantity
+}
+
+// Report is the analytics of a filtered set of purchases
+type Report struct {
+	// Months covers every month of the filter, with zeros where nothing
+	// was bought
+	Months []MonthTotal
+	// Suppliers are ranked by spend, products by taxable value
+	Suppliers []Ranked
+	Products  []Ranked
+	// Rates are the tax totals per GST rate, in ascending order of rate
+	Rates []gst.RateTotal
+	// Prices is the price trend of the filter's product, one entry per
+	// month it was bought in
+	Prices []MonthPrice
+	// Invoices are the matching purchases, newest first
+	Invoices []*Purchase
+	Total    gst.RateTotal
+	// ProductName names the filter's product
+	ProductName string
+}
+
+// Build aggregates the purchases that match a filter
+func Build(purchases []Purchase, f Filter) *Report {
+	r := &Report{}
+	months := make(map[time.Time]*MonthTotal)
+	for m := f.From; !m.After(f.To); m = m.AddDate(0, 1, 0) {
+		r.Months = append(r.Months, MonthTotal{Month: m})
+	}
+	for i := range r.Months {
+		months[r.Months[i].Month] = &r.Months[i]
+	}
+
+	suppliers := make(map[string]*Ranked)
+	products := make(map[string]*Ranked)
+	rates := make(map[int64]*gst.RateTotal)
+	prices := make(map[time.Time]*MonthPrice)
+
+	for i := range purchases {
+		p := &purchases[i]
+		if !f.matches(p) {
+			continue
+		}
+		month := time.Date(p.Date.Year(), p.Date.Month(), 1, 0, 0, 0, 0, time.UTC)
+		if f.Month.IsZero() || month.Equal(f.Month) {
+			r.Invoices = append(r.Invoices, p)
+		}
+
+		total := p.Total()
+		spend := total.Taxable + total.Tax()
+		r.Total.Add(total)
+		if m := months[month]; m != nil {
+			m.Spend += spend
+			m.Tax += total.Tax()
+			m.Invoices++
+		}
+
+		s := rank(suppliers, p.Supplier, p.SupplierName)
+		s.Spend += spend
+		s.Invoices++
+
+		for _, rt := range p.Rates {
+			if rates[rt.Rate] == nil {
+				rates[rt.Rate] = &gst.RateTotal{Rate: rt.Rate}
+			}
+			rates[rt.Rate].Add(rt)
+		}
+
+		seen := make(map[string]bool)
+		for _, l := range p.Lines {
+			pr := rank(products, l.Product, l.ProductName)
+			pr.Spend += l.Taxable
+			pr.Quantity += l.Quantity
+			if !seen[l.Product] {
+				pr.Invoices++
+				seen[l.Product] = true
+			}
+			if l.Product == f.Product {
+				if r.ProductName == "" {
+					r.ProductName = l.ProductName
+				}
+				if prices[month] == nil {
+					prices[month] = &MonthPrice{Month: month}
+				}
+				// Lines without a quantity have no price
+				if l.Quantity > 0 {
+					prices[month].Quantity += l.Quantity
+					prices[month].Taxable += l.Taxable
+				}
+			}
+		}
+	}
+
+	r.Suppliers = ranked(suppliers)
+	r.Products = ranked(products)
+	for _, rt := range rates {
+		r.Rates = append(r.Rates, *rt)
+	}
+	sort.Slice(r.Rates, func(i, j int) bool { return r.Rates[i].Rate < r.Rates[j].Rate })
+	for _, mp := range prices {
+		if mp.Quantity > 0 {
+			r.Prices = append(r.Prices, *mp)
+		}
+	}
+	sort.Slice(r.Prices, func(i, j int) bool { return r.Prices[i].Month.Before(r.Prices[j].Month) })
+	sort.SliceStable(r.Invoices, func(i, j int) bool { return r.Invoices[i].Date.After(r.Invoices[j].Date) })
+	return r
+}
+
+// rank returns the entry of a key, adding it on first sight
+func rank(entries map[string]*Ranked, key, name string) *Ranked {
+	if entries[key] == nil {
+		entries[key] = &Ranked{Key: key, Name: name}
+	}
+	return entries[key]
+}
+
+// ranked orders entries by spend, largest first, and keeps the top ones
+func ranked(entries map[string]*Ranked) []Ranked {
+	list := make([]Ranked, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, *e)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Spend != list[j].Spend {
+			return list[i].Spend > list[j].Spend
+		}
+		return list[i].Name < list[j].Name
+	})
+	if len(list) > topN {
+		list = list[:topN]
+	}
+	return list
+}
@@ -0,0 +1,211 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Chart dimensions in SVG user units. The SVG is scaled to the width of its
+// container, so these only fix the proportions.
+const (
+	chartWidth   = 720
+	chartHeight  = 220
+	plotLeft     = 64
+	plotTop      = 12
+	plotBottom   = 192
+	plotRight    = 712
+	gridLines    = 4
+	maxAxisLabel = 12
+)
+
+// Bar is one bar of a bar chart, or one point of a line chart
+type Bar struct {
+	X      float64
+	Y      float64
+	Width  float64
+	Height float64
+	// Title is shown as the bar's tooltip
+	Title string
+	// Href drills down from the bar, if set
+	Href string
+}
+
+// GridLine is a horizontal line across the plot at a value
+type GridLine struct {
+	Y     float64
+	Label string
+}
+
+// AxisLabel labels a bar or point under the plot
+type AxisLabel struct {
+	X    float64
+	Text string
+}
+
+// Chart is the geometry of a bar or line chart, ready for a template to
+// draw as SVG
+type Chart struct {
+	Width  float64
+	Height float64
+	Left   float64
+	Right  float64
+	Bottom float64
+	Bars   []Bar
+	// Points is the polyline of a line chart
+	Points string
+	Grid   []GridLine
+	Labels []AxisLabel
+}
+
+// Datum is one value of a chart
+type Datum struct {
+	Label string
+	Value float64
+	Title string
+	Href  string
+}
+
+// BarChart lays out one bar per datum. format labels the grid lines.
+func BarChart(data []Datum, format func(float64) string) Chart {
+	c := newChart(data, format)
+	if len(data) == 0 {
+		return c
+	}
+	slot := (plotRight - plotLeft) / float64(len(data))
+	scale := c.scale(data)
+	for i, d := range data {
+		height := math.Max(d.Value, 0) * scale
+		c.Bars = append(c.Bars, Bar{
+			X:      round(plotLeft + float64(i)*slot + slot*0.15),
+			Y:      round(plotBottom - height),
+			Width:  round(slot * 0.7),
+			Height: round(height),
+			Title:  d.Title,
+			Href:   d.Href,
+		})
+		c.label(i, len(data), plotLeft+float64(i)*slot+slot/2, d.Label)
+	}
+	return c
+}
+
+// LineChart lays out the data as points joined by a line. Bars hold the
+// points, with zero width and height.
+func LineChart(data []Datum, format func(float64) string) Chart {
+	c := newChart(data, format)
+	if len(data) == 0 {
+		return c
+	}
+	step := 0.0
+	if len(data) > 1 {
+		step = (plotRight - plotLeft - 24) / float64(len(data)-1)
+	}
+	scale := c.scale(data)
+	points := make([]string, len(data))
+	for i, d := range data {
+		x := round(plotLeft + 12 + float64(i)*step)
+		if len(data) == 1 {
+			x = round((plotLeft + plotRight) / 2)
+		}
+		y := round(plotBottom - math.Max(d.Value, 0)*scale)
+		points[i] = fmt.Sprintf("%g,%g", x, y)
+		c.Bars = append(c.Bars, Bar{X: x, Y: y, Title: d.Title, Href: d.Href})
+		c.label(i, len(data), x, d.Label)
+	}
+	c.Points = strings.Join(points, " ")
+	return c
+}
+
+// newChart sets up the plot area and its grid lines
+func newChart(data []Datum, format func(float64) string) Chart {
+	c := Chart{Width: chartWidth, Height: chartHeight, Left: plotLeft, Right: plotRight, Bottom: plotBottom}
+	top := niceCeiling(maxValue(data))
+	for i := 1; i <= gridLines; i++ {
+		value := top * float64(i) / gridLines
+		c.Grid = append(c.Grid, GridLine{
+			Y:     round(plotBottom - (plotBottom-plotTop)*float64(i)/gridLines),
+			Label: format(value),
+		})
+	}
+	return c
+}
+
+// scale is the height of one unit of value
+func (c *Chart) scale(data []Datum) float64 {
+	top := niceCeiling(maxValue(data))
+	return (plotBottom - plotTop) / top
+}
+
+// label adds the axis label of datum i of n, skipping labels so that at
+// most maxAxisLabel are shown
+func (c *Chart) label(i, n int, x float64, text string) {
+	every := (n + maxAxisLabel - 1) / maxAxisLabel
+	if i%every == 0 {
+		c.Labels = append(c.Labels, AxisLabel{X: round(x), Text: text})
+	}
+}
+
+func maxValue(data []Datum) float64 {
+	top := 0.0
+	for _, d := range data {
+		top = math.Max(top, d.Value)
+	}
+	return top
+}
+
+// niceCeiling rounds a value up to 1, 2 or 5 times a power of ten, so that
+// grid lines fall on round numbers
+func niceCeiling(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, step := range []float64{1, 2, 5, 10} {
+		if v <= step*magnitude {
+			return step * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+func round(v float64) float64 {
+	return math.Round(v*10) / 10
+}
+
+// Compact formats rupees for chart axes the Indian way: 950, 12.5k, 3.4L,
+// 1.2Cr
+func Compact(rupees float64) string {
+	switch abs := math.Abs(rupees); {
+	case abs >= 1e7:
+		return trim(rupees/1e7) + "Cr"
+	case abs >= 1e5:
+		return trim(rupees/1e5) + "L"
+	case abs >= 1e3:
+		return trim(rupees/1e3) + "k"
+	}
+	return trim(rupees)
+}
+
+func trim(v float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.1f", v), "0"), ".")
+}
+
+// Rupees formats paise as rupees with Indian digit grouping: 12,34,567.89
+func Rupees(paise int64) string {
+	sign := ""
+	if paise < 0 {
+		sign, paise = "-", -paise
+	}
+	whole := fmt.Sprint(paise / 100)
+	if len(whole) > 3 {
+		head, tail := whole[:len(whole)-3], whole[len(whole)-3:]
+		var groups []string
+		for len(head) > 2 {
+			groups = append([]string{head[len(head)-2:]}, groups...)
+			head = head[:len(head)-2]
+		}
+		groups = append([]string{head}, groups...)
+		whole = strings.Join(groups, ",") + "," + tail
+	}
+	return fmt.Sprintf("%s%s.%02d", sign, whole, paise%100)
+}
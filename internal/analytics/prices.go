@@ -0,0 +1,171 @@
+package analytics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// alternativeAge is how old another supplier's last rate may be and still
+// count as an alternative to a new invoice
+const alternativeAge = 365 * 24 * time.Hour
+
+// PricePoint is the rate a product was bought at on one invoice line
+type PricePoint struct {
+	InvoiceID    string
+	Number       string
+	Date         time.Time
+	Supplier     string
+	SupplierName string
+	// Rate and MRP are in paise
+	Rate     int64
+	MRP      int64
+	Quantity float64
+}
+
+// PriceHistory lists the printed rates of a product, oldest first. Lines
+// without a rate are left out.
+func PriceHistory(purchases []Purchase, product string) []PricePoint {
+	var history []PricePoint
+	for i := range purchases {
+		p := &purchases[i]
+		for _, l := range p.Lines {
+			if l.Product != product || l.Rate <= 0 {
+				continue
+			}
+			history = append(history, PricePoint{
+				InvoiceID:    p.ID,
+				Number:       p.Number,
+				Date:         p.Date,
+				Supplier:     p.Supplier,
+				SupplierName: p.SupplierName,
+				Rate:         l.Rate,
+				MRP:          l.MRP,
+				Quantity:     l.Quantity,
+			})
+		}
+	}
+	sort.SliceStable(history, func(i, j int) bool { return history[i].Date.Before(history[j].Date) })
+	return history
+}
+
+// SupplierPrice sums up what one supplier charged for a product
+type SupplierPrice struct {
+	Supplier     string
+	SupplierName string
+	Latest       PricePoint
+	Lowest       int64
+	Highest      int64
+	Lines        int
+}
+
+// SupplierPrices groups a price history by supplier, cheapest latest rate
+// first
+func SupplierPrices(history []PricePoint) []SupplierPrice {
+	bySupplier := make(map[string]*SupplierPrice)
+	var order []string
+	for _, pt := range history {
+		s := bySupplier[pt.Supplier]
+		if s == nil {
+			s = &SupplierPrice{Supplier: pt.Supplier, SupplierName: pt.SupplierName, Lowest: pt.Rate, Highest: pt.Rate}
+			bySupplier[pt.Supplier] = s
+			order = append(order, pt.Supplier)
+		}
+		s.Latest = pt
+		s.Lowest = min(s.Lowest, pt.Rate)
+		s.Highest = max(s.Highest, pt.Rate)
+		s.Lines++
+	}
+	prices := make([]SupplierPrice, len(order))
+	for i, key := range order {
+		prices[i] = *bySupplier[key]
+	}
+	sort.SliceStable(prices, func(i, j int) bool { return prices[i].Latest.Rate < prices[j].Latest.Rate })
+	return prices
+}
+
+// Change is the increase from one rate to another in percent
+func Change(from, to int64) float64 {
+	if from == 0 {
+		return 0
+	}
+	return float64(to-from) * 100 / float64(from)
+}
+
+// PriceAlert is a line of a new invoice whose rate went up by more than the
+// threshold on the supplier's previous rate, on the cheapest other
+// supplier's rate, or on both
+type PriceAlert struct {
+	Line        int
+	Product     string
+	ProductName string
+	Rate        int64
+	// Previous is the supplier's last rate, set when the line exceeds it
+	Previous *PricePoint
+	// Cheapest is the lowest current rate of another supplier, set when the
+	// line exceeds it
+	Cheapest *PricePoint
+}
+
+// String describes the alert: "Paracetamol 500: 12.50, up 8.7% on 11.50
+// from the same supplier on 03-02-2026; 10.9% above 11.27 from Beta Pharma"
+func (a PriceAlert) String() string {
+	parts := []string{fmt.Sprintf("%s: %s", a.ProductName, Rupees(a.Rate))}
+	if a.Previous != nil {
+		parts = append(parts, fmt.Sprintf("up %.1f%% on %s from the same supplier on %s",
+			Change(a.Previous.Rate, a.Rate), Rupees(a.Previous.Rate), a.Previous.Date.Format("02-01-2006")))
+	}
+	if a.Cheapest != nil {
+		parts = append(parts, fmt.Sprintf("%.1f%% above %s from %s on %s",
+			Change(a.Cheapest.Rate, a.Rate), Rupees(a.Cheapest.Rate), a.Cheapest.SupplierName, a.Cheapest.Date.Format("02-01-2006")))
+	}
+	return parts[0] + ", " + strings.Join(parts[1:], "; ")
+}
+
+// PriceAlerts compares the rates of a new purchase with the earlier
+// purchases of the same products. A line is flagged when its rate is more
+// than threshold percent above the supplier's previous rate, or above the
+// last rate of the cheapest other supplier bought from within a year.
+func PriceAlerts(p *Purchase, purchases []Purchase, threshold float64) []PriceAlert {
+	exceeds := func(rate, base int64) bool {
+		return base > 0 && float64(rate) > float64(base)*(1+threshold/100)
+	}
+
+	var alerts []PriceAlert
+	for _, l := range p.Lines {
+		if l.Rate <= 0 {
+			continue
+		}
+		var previous *PricePoint
+		latest := make(map[string]PricePoint)
+		for _, pt := range PriceHistory(purchases, l.Product) {
+			if pt.InvoiceID == p.ID || pt.Date.After(p.Date) {
+				continue
+			}
+			if pt.Supplier == p.Supplier {
+				previous = &pt
+			} else if p.Date.Sub(pt.Date) <= alternativeAge {
+				latest[pt.Supplier] = pt
+			}
+		}
+		var cheapest *PricePoint
+		for _, pt := range latest {
+			if cheapest == nil || pt.Rate < cheapest.Rate || (pt.Rate == cheapest.Rate && pt.SupplierName < cheapest.SupplierName) {
+				cheapest = &pt
+			}
+		}
+
+		alert := PriceAlert{Line: l.Index, Product: l.Product, ProductName: l.ProductName, Rate: l.Rate}
+		if previous != nil && exceeds(l.Rate, previous.Rate) {
+			alert.Previous = previous
+		}
+		if cheapest != nil && exceeds(l.Rate, cheapest.Rate) {
+			alert.Cheapest = cheapest
+		}
+		if alert.Previous != nil || alert.Cheapest != nil {
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts
+}
@@ -0,0 +1,218 @@
+// Package catalog links free-text product names from invoices to the
+// product master using token based fuzzy matching.
+package catalog
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/ashX04/new_website/internal/models"
+)
+
+// SuggestThreshold is the lowest score at which a match is proposed to the
+// reviewer
+const SuggestThreshold = 0.6
+
+// synonyms maps spelling variants found on invoices onto one token
+var synonyms = map[string]string{
+	"tab": "tab", "tabs": "tab", "tablet": "tab", "tablets": "tab", "tb": "tab",
+	"cap": "cap", "caps": "cap", "capsule": "cap", "capsules": "cap",
+	"syp": "syrup", "syrup": "syrup", "susp": "suspension", "suspension": "suspension",
+	"inj": "inj", "injection": "inj", "oint": "ointment", "ointment": "ointment",
+	"gm": "g", "gms": "g", "gram": "g", "grams": "g",
+	"mgs": "mg", "mls": "ml",
+}
+
+// units are dropped from names: "500mg" and "500" name the same strength
+var units = map[string]bool{"mg": true, "ml": true, "g": true, "mcg": true, "kg": true}
+
+// Tokens splits a product name into normalised tokens: lower case, letters
+// and digits separated, units dropped ("500mg" becomes "500") and common
+// abbreviations unified
+func Tokens(name string) []string {
+	var tokens []string
+	var cur []rune
+	var curDigit bool
+	flush := func() {
+		if len(cur) == 0 {
+			return
+		}
+		tok := string(cur)
+		if syn, ok := synonyms[tok]; ok {
+			tok = syn
+		}
+		if !units[tok] {
+			tokens = append(tokens, tok)
+		}
+		cur = cur[:0]
+	}
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case unicode.IsDigit(r) || r == '.' && curDigit && len(cur) > 0:
+			if !curDigit {
+				flush()
+			}
+			curDigit = true
+			cur = append(cur, r)
+		case unicode.IsLetter(r):
+			if curDigit {
+				flush()
+			}
+			curDigit = false
+			cur = append(cur, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return tokens
+}
+
+// Normalise returns the canonical form of a name, used to compare aliases
+func Normalise(name string) string {
+	return strings.Join(Tokens(name), " ")
+}
+
+// Score rates how likely two product names refer to the same product, from
+// 0 (unrelated) to 1 (same normalised name)
+func Score(a, b string) float64 {
+	ta, tb := Tokens(a), Tokens(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+	if strings.Join(ta, " ") == strings.Join(tb, " ") {
+		return 1
+	}
+
+	// Fuzzy token overlap: a token counts as shared when a token on the
+	// other side is spelled nearly the same
+	matched := 0
+	used := make([]bool, len(tb))
+	for _, x := range ta {
+		for j, y := range tb {
+			if !used[j] && tokenSimilar(x, y) {
+				used[j] = true
+				matched++
+				break
+			}
+		}
+	}
+	overlap := float64(matched) / float64(len(ta)+len(tb)-matched)
+
+	// Whole-string similarity of the sorted tokens catches run-together
+	// words such as "paracetamol500" that tokenising alone misses
+	sa, sb := append([]string(nil), ta...), append([]string(nil), tb...)
+	sort.Strings(sa)
+	sort.Strings(sb)
+	whole := similarity(strings.Join(sa, ""), strings.Join(sb, ""))
+
+	score := 0.6*overlap + 0.4*whole
+
+	// Different strengths are different products however close the rest
+	// of the name is
+	if numbersConflict(ta, tb) {
+		score *= 0.5
+	}
+	return score
+}
+
+// Match finds the product that best matches name, considering the product
+// name and its learned aliases. It returns nil if no product scores above 0.
+func Match(name string, products []models.Product) (*models.Product, float64) {
+	var best *models.Product
+	bestScore := 0.0
+	for i := range products {
+		candidates := append([]string{products[i].Name}, products[i].Aliases...)
+		for _, candidate := range candidates {
+			if s := Score(name, candidate); s > bestScore {
+				best, bestScore = &products[i], s
+			}
+		}
+	}
+	return best, bestScore
+}
+
+// HasAlias reports whether name is already known for the product, either as
+// its name or as one of its aliases
+func HasAlias(p *models.Product, name string) bool {
+	n := Normalise(name)
+	if n == Normalise(p.Name) {
+		return true
+	}
+	for _, alias := range p.Aliases {
+		if n == Normalise(alias) {
+			return true
+		}
+	}
+	return false
+}
+
+func tokenSimilar(a, b string) bool {
+	if a == b {
+		return true
+	}
+	// Numbers must match exactly; short tokens allow no typos
+	if isNumber(a) || isNumber(b) || len(a) < 4 || len(b) < 4 {
+		return false
+	}
+	return similarity(a, b) >= 0.8
+}
+
+func numbersConflict(a, b []string) bool {
+	na, nb := numbers(a), numbers(b)
+	if len(na) == 0 || len(nb) == 0 {
+		return false
+	}
+	for n := range na {
+		if !nb[n] {
+			return true
+		}
+	}
+	return false
+}
+
+func numbers(tokens []string) map[string]bool {
+	set := make(map[string]bool)
+	for _, t := range tokens {
+		if isNumber(t) {
+			set[t] = true
+		}
+	}
+	return set
+}
+
+func isNumber(s string) bool {
+	return s != "" && unicode.IsDigit(rune(s[0]))
+}
+
+// similarity is 1 minus the Levenshtein distance relative to the longer
+// string
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,83 @@
+package catalog
+
+import (
+	"strings"
+
+	"github.com/ashX04/new_website/internal/gst"
+	"github.com/ashX04/new_website/internal/models"
+)
+
+// SupplierThreshold is the lowest name score at which an invoice is linked
+// to a supplier without a GSTIN match. Supplier names are linked without
+// review, so the bar is higher than for products.
+const SupplierThreshold = 0.85
+
+// companyWords are dropped from supplier names before comparing them: "ABC
+// Pharma Pvt. Ltd." and "ABC Pharma" are the same distributor
+var companyWords = map[string]bool{
+	"pvt": true, "private": true, "ltd": true, "limited": true, "llp": true,
+	"co": true, "company": true, "and": true,
+}
+
+// MatchSupplier finds the supplier an invoice header belongs to. A GSTIN
+// match wins outright; otherwise the closest name above SupplierThreshold is
+// returned. It returns nil if nothing matches.
+func MatchSupplier(header *models.InvoiceHeader, suppliers []models.Supplier) *models.Supplier {
+	if gstin := gst.NormaliseGSTIN(header.SupplierGSTIN); gstin != "" {
+		for i := range suppliers {
+			if gst.NormaliseGSTIN(suppliers[i].GSTIN) == gstin {
+				return &suppliers[i]
+			}
+		}
+	}
+
+	name := supplierName(header.SupplierName)
+	if name == "" {
+		return nil
+	}
+	var best *models.Supplier
+	bestScore := 0.0
+	for i := range suppliers {
+		// A supplier whose GSTIN differs from the invoice's is a different
+		// business, however similar the name
+		if header.SupplierGSTIN != "" && suppliers[i].GSTIN != "" {
+			continue
+		}
+		if s := Score(name, supplierName(suppliers[i].Name)); s > bestScore {
+			best, bestScore = &suppliers[i], s
+		}
+	}
+	if bestScore < SupplierThreshold {
+		return nil
+	}
+	return best
+}
+
+// supplierName normalises a supplier name for comparison: a leading "M/s"
+// and company words are dropped and initials joined, so that "M/s A.B.C.
+// Pharma Pvt Ltd" becomes "abc pharma"
+func supplierName(name string) string {
+	tokens := Tokens(name)
+	if len(tokens) > 2 && tokens[0] == "m" && tokens[1] == "s" {
+		tokens = tokens[2:]
+	}
+	var kept []string
+	initials := ""
+	for _, tok := range tokens {
+		if len(tok) == 1 && !isNumber(tok) {
+			initials += tok
+			continue
+		}
+		if initials != "" {
+			kept = append(kept, initials)
+			initials = ""
+		}
+		if !companyWords[tok] {
+			kept = append(kept, tok)
+		}
+	}
+	if initials != "" {
+		kept = append(kept, initials)
+	}
+	return strings.Join(kept, " ")
+}
@@ -0,0 +1,112 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ashX04/new_website/internal/normalise"
+)
+
+// ODSContentType is the media type of OpenDocument spreadsheets
+const ODSContentType = "application/vnd.oasis.opendocument.spreadsheet"
+
+const odsManifest = xml.Header + `<manifest:manifest xmlns:manifest="urn:oasis:names:tc:opendocument:xmlns:manifest:1.0" manifest:version="1.2">
+ <manifest:file-entry manifest:full-path="/" manifest:version="1.2" manifest:media-type="` + ODSContentType + `"/>
+ <manifest:file-entry manifest:full-path="content.xml" manifest:media-type="text/xml"/>
+</manifest:manifest>
+`
+
+// WriteODS writes tables as the sheets of an OpenDocument spreadsheet. The
+// archive is streamed to w as it is written.
+func WriteODS(w io.Writer, tables ...*Table) error {
+	zw := zip.NewWriter(w)
+
+	// The mimetype entry must come first and be stored uncompressed
+	mimetype, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(mimetype, ODSContentType); err != nil {
+		return err
+	}
+	manifest, err := zw.Create("META-INF/manifest.xml")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(manifest, odsManifest); err != nil {
+		return err
+	}
+	content, err := zw.Create("content.xml")
+	if err != nil {
+		return err
+	}
+	// bufio.Writer keeps the first write error, which Flush reports
+	bw := bufio.NewWriter(content)
+	writeODSContent(bw, tables)
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeODSContent(w *bufio.Writer, tables []*Table) {
+	w.WriteString(xml.Header)
+	w.WriteString(`<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0"` +
+		` xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0"` +
+		` xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0" office:version="1.2">`)
+	w.WriteString("<office:body><office:spreadsheet>")
+	for _, t := range tables {
+		fmt.Fprintf(w, `<table:table table:name="%s">`, escape(t.Name))
+		w.WriteString("<table:table-row>")
+		for _, col := range t.Columns {
+			odsCell(w, normalise.KindText, col.Name)
+		}
+		w.WriteString("</table:table-row>")
+		for _, row := range t.Rows {
+			w.WriteString("<table:table-row>")
+			for i, col := range t.Columns {
+				odsCell(w, col.Kind, row[i])
+			}
+			w.WriteString("</table:table-row>")
+		}
+		w.WriteString("</table:table>")
+	}
+	w.WriteString("</office:spreadsheet></office:body></office:document-content>")
+}
+
+// odsCell writes a typed cell, keeping the extracted text as its display
+// value
+func odsCell(w *bufio.Writer, kind normalise.Kind, raw string) {
+	switch v := normalise.Cell(kind, raw).(type) {
+	case float64:
+		valueType := "float"
+		if kind == normalise.KindPercent {
+			valueType = "percentage"
+		}
+		fmt.Fprintf(w, `<table:table-cell office:value-type="%s" office:value="%s"><text:p>%s</text:p></table:table-cell>`,
+			valueType, strconv.FormatFloat(v, 'f', -1, 64), escape(raw))
+	case int64:
+		fmt.Fprintf(w, `<table:table-cell office:value-type="float" office:value="%d"><text:p>%s</text:p></table:table-cell>`, v, escape(raw))
+	case time.Time:
+		fmt.Fprintf(w, `<table:table-cell office:value-type="date" office:date-value="%s"><text:p>%s</text:p></table:table-cell>`,
+			v.Format("2006-01-02"), escape(raw))
+	case string:
+		if v == "" {
+			w.WriteString("<table:table-cell/>")
+			return
+		}
+		fmt.Fprintf(w, `<table:table-cell office:value-type="string"><text:p>%s</text:p></table:table-cell>`, escape(v))
+	}
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,128 @@
+// Package export renders the stored extraction data of invoices in formats
+// other than the generated workbook: CSV, JSON, ODS and a consolidated xlsx.
+package export
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ashX04/new_website/internal/models"
+	"github.com/ashX04/new_website/internal/normalise"
+)
+
+// Column is a column of an exported table
+type Column struct {
+	Field string
+	Name  string
+	Kind  normalise.Kind
+}
+
+// Table is one sheet of exported data. Cells hold the extracted text and
+// are typed by the kind of their column when written.
+type Table struct {
+	Name    string
+	Columns []Column
+	Rows    [][]string
+}
+
+// invoiceColumns tag each line item with the invoice it came from
+var invoiceColumns = []Column{
+	{Field: "supplier_name", Name: "Supplier", Kind: normalise.KindText},
+	{Field: "supplier_gstin", Name: "GSTIN", Kind: normalise.KindText},
+	{Field: "invoice_number", Name: "Invoice number", Kind: normalise.KindText},
+	{Field: "invoice_date", Name: "Invoice date", Kind: normalise.KindDate},
+}
+
+// recordColumn ties each row back to its excel_files record
+var recordColumn = Column{Field: "record_id", Name: "Record ID", Kind: normalise.KindText}
+
+// LineItems is a table with one row per line item across invoices, each
+// tagged with its invoice. Invoices extracted with different templates
+// share the columns they have in common; the others are left empty for
+// invoices without them.
+func LineItems(files []*models.ExcelFile) *Table {
+	var lineColumns []Column
+	seen := make(map[string]bool)
+	for _, file := range files {
+		for _, col := range file.LineColumns() {
+			if seen[col.Field] {
+				continue
+			}
+			seen[col.Field] = true
+			lineColumns = append(lineColumns, Column{Field: col.Field, Name: col.Name, Kind: normalise.Kind(col.Kind)})
+		}
+	}
+
+	t := &Table{Name: "Items"}
+	t.Columns = append(t.Columns, invoiceColumns...)
+	t.Columns = append(t.Columns, lineColumns...)
+	t.Columns = append(t.Columns, recordColumn)
+	for _, file := range files {
+		for i := range file.Lines {
+			row := []string{SupplierName(file), file.SupplierGSTIN, file.InvoiceNumber, file.InvoiceDate}
+			for _, col := range lineColumns {
+				row = append(row, file.Lines[i].Field(col.Field))
+			}
+			t.Rows = append(t.Rows, append(row, file.ID))
+		}
+	}
+	return t
+}
+
+// Invoices is a summary table with one row per invoice: its header, the
+// number of lines and how the line amounts compare to the printed total
+func Invoices(files []*models.ExcelFile) *Table {
+	t := &Table{Name: "Invoices"}
+	t.Columns = append(t.Columns, invoiceColumns...)
+	t.Columns = append(t.Columns,
+		Column{Field: "invoice_total", Name: "Invoice total", Kind: normalise.KindAmount},
+		Column{Field: "items_total", Name: "Items total", Kind: normalise.KindAmount},
+		Column{Field: "difference", Name: "Difference", Kind: normalise.KindAmount},
+		Column{Field: "lines", Name: "Lines", Kind: normalise.KindInteger},
+		Column{Field: "status", Name: "Status", Kind: normalise.KindText},
+		recordColumn,
+	)
+	for _, file := range files {
+		var items float64
+		for _, line := range file.Lines {
+			items += normalise.Line(line).Amount
+		}
+		t.Rows = append(t.Rows, []string{
+			SupplierName(file), file.SupplierGSTIN, file.InvoiceNumber, file.InvoiceDate,
+			amountText(file.InvoiceTotal), amountText(items), amountText(file.InvoiceTotal - items),
+			strconv.Itoa(len(file.Lines)), file.Status, file.ID,
+		})
+	}
+	return t
+}
+
+func amountText(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', 2, 64)
+}
+
+// SupplierName prefers the name of the supplier master, when the record was
+// loaded with it expanded, over the name read off the page
+func SupplierName(file *models.ExcelFile) string {
+	if file.Expand != nil && file.Expand.Supplier != nil {
+		return file.Expand.Supplier.Name
+	}
+	return file.SupplierName
+}
+
+// Value is the plain value of a cell for text formats: numbers as float64
+// or int64, percentages in percentage points and dates as YYYY-MM-DD. Text
+// that cannot be read as its kind is returned as is.
+func Value(kind normalise.Kind, raw string) interface{} {
+	if kind == normalise.KindPercent {
+		if n, ok := normalise.Percent(raw); ok {
+			return n
+		}
+		return strings.TrimSpace(raw)
+	}
+	if t, ok := normalise.Cell(kind, raw).(time.Time); ok {
+		return t.Format("2006-01-02")
+	}
+	return normalise.Cell(kind, raw)
+}
@@ -0,0 +1,99 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/ashX04/new_website/internal/models"
+	"github.com/ashX04/new_website/internal/normalise"
+)
+
+// WriteCSV writes a table as RFC 4180 CSV: a header row, CRLF line endings
+// and fields quoted where needed
+func WriteCSV(w io.Writer, t *Table) error {
+	cw := csv.NewWriter(w)
+	cw.UseCRLF = true
+
+	header := make([]string, len(t.Columns))
+	for i, col := range t.Columns {
+		header[i] = col.Name
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	record := make([]string, len(t.Columns))
+	for _, row := range t.Rows {
+		for i, col := range t.Columns {
+			record[i] = text(Value(col.Kind, row[i]))
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func text(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case string:
+		return v
+	}
+	return ""
+}
+
+// invoiceJSON is an invoice in the JSON export
+type invoiceJSON struct {
+	ID            string                   `json:"id"`
+	SupplierName  string                   `json:"supplier_name"`
+	SupplierGSTIN string                   `json:"supplier_gstin"`
+	InvoiceNumber string                   `json:"invoice_number"`
+	InvoiceDate   string                   `json:"invoice_date"`
+	InvoiceTotal  float64                  `json:"invoice_total"`
+	Status        string                   `json:"status"`
+	Columns       []models.TemplateColumn  `json:"columns"`
+	Lines         []map[string]interface{} `json:"lines"`
+}
+
+// WriteJSON writes invoices with their template columns and typed line
+// values keyed by field name
+func WriteJSON(w io.Writer, files []*models.ExcelFile) error {
+	invoices := make([]invoiceJSON, 0, len(files))
+	for _, file := range files {
+		inv := invoiceJSON{
+			ID:            file.ID,
+			SupplierName:  SupplierName(file),
+			SupplierGSTIN: file.SupplierGSTIN,
+			InvoiceNumber: file.InvoiceNumber,
+			InvoiceDate:   file.InvoiceDate,
+			InvoiceTotal:  file.InvoiceTotal,
+			Status:        file.Status,
+			Columns:       file.LineColumns(),
+			Lines:         make([]map[string]interface{}, 0, len(file.Lines)),
+		}
+		if t, ok := normalise.Date(file.InvoiceDate); ok {
+			inv.InvoiceDate = t.Format("2006-01-02")
+		}
+		for i := range file.Lines {
+			line := make(map[string]interface{}, len(inv.Columns)+1)
+			for _, col := range inv.Columns {
+				line[col.Field] = Value(normalise.Kind(col.Kind), file.Lines[i].Field(col.Field))
+			}
+			if file.Lines[i].ProductID != "" {
+				line["product_id"] = file.Lines[i].ProductID
+			}
+			inv.Lines = append(inv.Lines, line)
+		}
+		invoices = append(invoices, inv)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]interface{}{"invoices": invoices})
+}
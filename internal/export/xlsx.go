@@ -0,0 +1,110 @@
+package export
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ashX04/new_website/internal/normalise"
+	"github.com/xuri/excelize/v2"
+)
+
+// XLSXContentType is the media type of xlsx workbooks
+const XLSXContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// NumFmts are the number formats of typed spreadsheet cells
+var NumFmts = map[normalise.Kind]string{
+	normalise.KindInteger:  "0",
+	normalise.KindNumber:   "General",
+	normalise.KindQuantity: "General",
+	normalise.KindAmount:   "#,##0.00",
+	normalise.KindPercent:  "0.00%",
+	normalise.KindExpiry:   "mmm-yy",
+	normalise.KindDate:     "dd-mm-yyyy",
+}
+
+// columnWidths are the widths of wide columns; others are 12 wide
+var columnWidths = map[string]float64{
+	"supplier_name": 28, "supplier_gstin": 17, "invoice_number": 16, "product_name": 36,
+	"manufacturer": 20, "record_id": 17,
+}
+
+// WriteXLSX writes tables as the sheets of a workbook, each with a bold,
+// frozen header row and typed cells, straight to w. Rows are set in memory
+// rather than through excelize's stream writer, which spills large sheets
+// to temporary files.
+func WriteXLSX(w io.Writer, tables ...*Table) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	header, err := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{Bold: true},
+		Fill: excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"D9E1F2"}},
+	})
+	if err != nil {
+		return err
+	}
+	kinds := make(map[normalise.Kind]int, len(NumFmts))
+	for kind, numFmt := range NumFmts {
+		numFmt := numFmt
+		if kinds[kind], err = f.NewStyle(&excelize.Style{CustomNumFmt: &numFmt}); err != nil {
+			return err
+		}
+	}
+
+	for i, t := range tables {
+		if i == 0 {
+			err = f.SetSheetName("Sheet1", t.Name)
+		} else {
+			_, err = f.NewSheet(t.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if err := writeSheet(f, t, header, kinds); err != nil {
+			return fmt.Errorf("sheet %s: %w", t.Name, err)
+		}
+	}
+	return f.Write(w)
+}
+
+func writeSheet(f *excelize.File, t *Table, header int, kinds map[normalise.Kind]int) error {
+	names := make([]interface{}, len(t.Columns))
+	for i, col := range t.Columns {
+		names[i] = col.Name
+	}
+	if err := f.SetSheetRow(t.Name, "A1", &names); err != nil {
+		return err
+	}
+
+	for r, row := range t.Rows {
+		values := make([]interface{}, len(t.Columns))
+		for i, col := range t.Columns {
+			values[i] = normalise.Cell(col.Kind, row[i])
+		}
+		cell, _ := excelize.CoordinatesToCellName(1, r+2)
+		if err := f.SetSheetRow(t.Name, cell, &values); err != nil {
+			return err
+		}
+	}
+
+	for i, col := range t.Columns {
+		name, _ := excelize.ColumnNumberToName(i + 1)
+		width, ok := columnWidths[col.Field]
+		if !ok {
+			width = 12
+		}
+		if err := f.SetColWidth(t.Name, name, name, width); err != nil {
+			return err
+		}
+		if style, ok := kinds[col.Kind]; ok && len(t.Rows) > 0 {
+			if err := f.SetCellStyle(t.Name, name+"2", fmt.Sprintf("%s%d", name, len(t.Rows)+1), style); err != nil {
+				return err
+			}
+		}
+	}
+	last, _ := excelize.ColumnNumberToName(len(t.Columns))
+	if err := f.SetCellStyle(t.Name, "A1", last+"1", header); err != nil {
+		return err
+	}
+	return f.SetPanes(t.Name, &excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"})
+}
@@ -0,0 +1,96 @@
+// Package gst holds helpers for Indian GST: identifiers and state codes,
+// the tax on purchase invoices and GSTR-2B reconciliation.
+package gst
+
+import (
+	"sort"
+	"strings"
+)
+
+// states maps GST state codes to state and union territory names
+var states = map[string]string{
+	"01": "Jammu and Kashmir", "02": "Himachal Pradesh", "03": "Punjab",
+	"04": "Chandigarh", "05": "Uttarakhand", "06": "Haryana", "07": "Delhi",
+	"08": "Rajasthan", "09": "Uttar Pradesh", "10": "Bihar", "11": "Sikkim",
+	"12": "Arunachal Pradesh", "13": "Nagaland", "14": "Manipur", "15": "Mizoram",
+	"16": "Tripura", "17": "Meghalaya", "18": "Assam", "19": "West Bengal",
+	"20": "Jharkhand", "21": "Odisha", "22": "Chhattisgarh", "23": "Madhya Pradesh",
+	"24": "Gujarat", "26": "Dadra and Nagar Haveli and Daman and Diu",
+	"27": "Maharashtra", "29": "Karnataka", "30": "Goa", "31": "Lakshadweep",
+	"32": "Kerala", "33": "Tamil Nadu", "34": "Puducherry",
+	"35": "Andaman and Nicobar Islands", "36": "Telangana", "37": "Andhra Pradesh",
+	"38": "Ladakh", "97": "Other Territory",
+}
+
+const gstinCharset = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// NormaliseGSTIN upper-cases a GSTIN and strips spaces
+func NormaliseGSTIN(gstin string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(gstin), ""))
+}
+
+// ValidGSTIN checks the format and check digit of a GSTIN
+func ValidGSTIN(gstin string) bool {
+	gstin = NormaliseGSTIN(gstin)
+	if len(gstin) != 15 {
+		return false
+	}
+	if _, ok := states[gstin[:2]]; !ok {
+		return false
+	}
+	for _, r := range gstin {
+		if !strings.ContainsRune(gstinCharset, r) {
+			return false
+		}
+	}
+	return checkDigit(gstin[:14]) == gstin[14]
+}
+
+// checkDigit computes the GSTIN check character over the first 14 characters
+func checkDigit(body string) byte {
+	sum := 0
+	for i := 0; i < len(body); i++ {
+		value := strings.IndexByte(gstinCharset, body[i])
+		factor := 1
+		if i%2 == 1 {
+			factor = 2
+		}
+		product := value * factor
+		sum += product/36 + product%36
+	}
+	return gstinCharset[(36-sum%36)%36]
+}
+
+// StateCode returns the two digit state code of a GSTIN, or "" if it does
+// not start with a known code
+func StateCode(gstin string) string {
+	gstin = NormaliseGSTIN(gstin)
+	if len(gstin) < 2 {
+		return ""
+	}
+	if _, ok := states[gstin[:2]]; !ok {
+		return ""
+	}
+	return gstin[:2]
+}
+
+// StateName returns the name of a state code, or "" if it is unknown
+func StateName(code string) string {
+	return states[code]
+}
+
+// State is a GST state code with its name
+type State struct {
+	Code string
+	Name string
+}
+
+// States lists every known state ordered by code
+func States() []State {
+	list := make([]State, 0, len(states))
+	for code, name := range states {
+		list = append(list, State{Code: code, Name: name})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Code < list[j].Code })
+	return list
+}
@@ -0,0 +1,265 @@
+package gst
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ashX04/new_website/internal/normalise"
+)
+
+// ReconTolerance is the largest difference, in paise, between the books and
+// GSTR-2B that is put down to rounding
+const ReconTolerance = 100
+
+// Return2B is the part of a GSTR-2B return that reconciliation needs
+type Return2B struct {
+	// GSTIN is the recipient's GSTIN
+	GSTIN string
+	// Period is the first day of the return month, zero if not given
+	Period   time.Time
+	Invoices []PortalInvoice
+}
+
+// PortalInvoice is a supplier invoice as reported in GSTR-2B
+type PortalInvoice struct {
+	GSTIN    string
+	Supplier string
+	Number   string
+	// Date is zero when the portal's date could not be read
+	Date    time.Time
+	Value   int64
+	Taxable int64
+	CGST    int64
+	SGST    int64
+	IGST    int64
+	Cess    int64
+}
+
+// gstr2bData is the data object of the GSTR-2B JSON downloaded from the GST
+// portal. Only B2B invoices are read; credit notes and imports are not
+// purchase invoices of this app.
+type gstr2bData struct {
+	GSTIN   string `json:"gstin"`
+	RtnPrd  string `json:"rtnprd"`
+	DocData struct {
+		B2B []struct {
+			CTIN  string `json:"ctin"`
+			TrdNm string `json:"trdnm"`
+			Inv   []struct {
+				INum string  `json:"inum"`
+				Dt   string  `json:"dt"`
+				Val  float64 `json:"val"`
+				gstr2bAmounts
+				Items []gstr2bAmounts `json:"items"`
+			} `json:"inv"`
+		} `json:"b2b"`
+	} `json:"docdata"`
+}
+
+type gstr2bAmounts struct {
+	TxVal float64 `json:"txval"`
+	IGST  float64 `json:"igst"`
+	CGST  float64 `json:"cgst"`
+	SGST  float64 `json:"sgst"`
+	Cess  float64 `json:"cess"`
+}
+
+// ParseGSTR2B reads the GSTR-2B JSON downloaded from the GST portal. Both the
+// portal download, which wraps the return in a data object, and the bare
+// return are accepted.
+func ParseGSTR2B(r io.Reader) (*Return2B, error) {
+	var file struct {
+		Data *gstr2bData `json:"data"`
+		gstr2bData
+	}
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, fmt.Errorf("not a GSTR-2B JSON file: %w", err)
+	}
+	data := &file.gstr2bData
+	if file.Data != nil {
+		data = file.Data
+	}
+	if data.GSTIN == "" && len(data.DocData.B2B) == 0 {
+		return nil, fmt.Errorf("not a GSTR-2B JSON file: no GSTIN or B2B invoices")
+	}
+
+	ret := &Return2B{GSTIN: NormaliseGSTIN(data.GSTIN)}
+	if t, err := time.Parse("012006", data.RtnPrd); err == nil {
+		ret.Period = t
+	}
+	for _, supplier := range data.DocData.B2B {
+		for _, inv := range supplier.Inv {
+			amounts := inv.gstr2bAmounts
+			// Some returns only carry amounts per rate
+			if amounts.TxVal == 0 {
+				for _, item := range inv.Items {
+					amounts.TxVal += item.TxVal
+					amounts.IGST += item.IGST
+					amounts.CGST += item.CGST
+					amounts.SGST += item.SGST
+					amounts.Cess += item.Cess
+				}
+			}
+			p := PortalInvoice{
+				GSTIN:    NormaliseGSTIN(supplier.CTIN),
+				Supplier: supplier.TrdNm,
+				Number:   inv.INum,
+				Value:    Paise(inv.Val),
+				Taxable:  Paise(amounts.TxVal),
+				CGST:     Paise(amounts.CGST),
+				SGST:     Paise(amounts.SGST),
+				IGST:     Paise(amounts.IGST),
+				Cess:     Paise(amounts.Cess),
+			}
+			p.Date, _ = normalise.Date(inv.Dt)
+			ret.Invoices = append(ret.Invoices, p)
+		}
+	}
+	return ret, nil
+}
+
+// BookInvoice is a processed purchase invoice as recorded in the books
+type BookInvoice struct {
+	ID       string
+	GSTIN    string
+	Supplier string
+	Number   string
+	Date     time.Time
+	Rates    []RateTotal
+}
+
+// Total sums the amounts of the invoice's rates
+func (b *BookInvoice) Total() RateTotal {
+	var total RateTotal
+	for _, r := range b.Rates {
+		total.Add(r)
+	}
+	return total
+}
+
+// ReconStatus is the outcome of reconciling one invoice
+type ReconStatus string
+
+const (
+	ReconMatched    ReconStatus = "matched"
+	ReconMismatched ReconStatus = "mismatched"
+	// ReconMissing invoices are in GSTR-2B but not in the books
+	ReconMissing ReconStatus = "missing"
+	// ReconExtra invoices are in the books but not in GSTR-2B
+	ReconExtra ReconStatus = "extra"
+)
+
+// reconOrder lists problems first
+var reconOrder = map[ReconStatus]int{ReconMismatched: 0, ReconMissing: 1, ReconExtra: 2, ReconMatched: 3}
+
+// ReconRow is one invoice of a reconciliation. Portal or Book is nil when
+// the invoice is only on one side.
+type ReconRow struct {
+	Status      ReconStatus
+	Portal      *PortalInvoice
+	Book        *BookInvoice
+	Differences []string
+}
+
+// Reconcile matches GSTR-2B invoices against the books by supplier GSTIN and
+// invoice number. Book invoices without a GSTIN are matched on the invoice
+// number alone when only one portal invoice has it. Unmatched book invoices
+// are only reported as extra when dated within [from, to), since GSTR-2B
+// covers one return period.
+func Reconcile(portal []PortalInvoice, books []BookInvoice, from, to time.Time) []ReconRow {
+	byKey := make(map[string][]int)
+	byNumber := make(map[string][]int)
+	for i, p := range portal {
+		number := NormaliseInvoiceNumber(p.Number)
+		byKey[p.GSTIN+"|"+number] = append(byKey[p.GSTIN+"|"+number], i)
+		byNumber[number] = append(byNumber[number], i)
+	}
+
+	matched := make([]bool, len(portal))
+	take := func(candidates []int) int {
+		for _, i := range candidates {
+			if !matched[i] {
+				matched[i] = true
+				return i
+			}
+		}
+		return -1
+	}
+
+	var rows []ReconRow
+	for i := range books {
+		book := &books[i]
+		number := NormaliseInvoiceNumber(book.Number)
+		match := -1
+		if gstin := NormaliseGSTIN(book.GSTIN); gstin != "" {
+			match = take(byKey[gstin+"|"+number])
+		} else if len(byNumber[number]) == 1 {
+			match = take(byNumber[number])
+		}
+		if match < 0 {
+			if !book.Date.IsZero() && !book.Date.Before(from) && book.Date.Before(to) {
+				rows = append(rows, ReconRow{Status: ReconExtra, Book: book})
+			}
+			continue
+		}
+		row := ReconRow{Status: ReconMatched, Portal: &portal[match], Book: book}
+		row.Differences = differences(row.Portal, book)
+		if len(row.Differences) > 0 {
+			row.Status = ReconMismatched
+		}
+		rows = append(rows, row)
+	}
+	for i := range portal {
+		if !matched[i] {
+			rows = append(rows, ReconRow{Status: ReconMissing, Portal: &portal[i]})
+		}
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		return reconOrder[rows[i].Status] < reconOrder[rows[j].Status]
+	})
+	return rows
+}
+
+// differences describes how a book invoice differs from GSTR-2B
+func differences(p *PortalInvoice, b *BookInvoice) []string {
+	var diffs []string
+	if !p.Date.IsZero() && !b.Date.IsZero() && !p.Date.Equal(b.Date) {
+		diffs = append(diffs, fmt.Sprintf("Date %s in books, %s in GSTR-2B", b.Date.Format("02-01-2006"), p.Date.Format("02-01-2006")))
+	}
+	total := b.Total()
+	for _, amount := range []struct {
+		name       string
+		book, gstr int64
+	}{
+		{"Taxable value", total.Taxable, p.Taxable},
+		{"CGST", total.CGST, p.CGST},
+		{"SGST", total.SGST, p.SGST},
+		{"IGST", total.IGST, p.IGST},
+		{"Cess", total.Cess, p.Cess},
+	} {
+		if diff := amount.book - amount.gstr; diff > ReconTolerance || diff < -ReconTolerance {
+			diffs = append(diffs, fmt.Sprintf("%s %.2f in books, %.2f in GSTR-2B", amount.name, Rupees(amount.book), Rupees(amount.gstr)))
+		}
+	}
+	return diffs
+}
+
+var (
+	invoiceNumberJunk = regexp.MustCompile(`[^A-Z0-9]+`)
+	leadingZeros      = regexp.MustCompile(`(^|[^0-9])0+([0-9])`)
+)
+
+// NormaliseInvoiceNumber reduces an invoice number to the letters and digits
+// that identify it, so that "INV/0009" and "inv-9" compare equal. Leading
+// zeros are dropped per part before the separators go, so that the zeros of
+// "2026-27/0012" are not taken for part of 27.
+func NormaliseInvoiceNumber(number string) string {
+	n := leadingZeros.ReplaceAllString(strings.ToUpper(number), "$1$2")
+	return invoiceNumberJunk.ReplaceAllString(n, "")
+}
@@ -0,0 +1,145 @@
+package gst
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNormaliseInvoiceNumber(t *testing.T) {
+	tests := []struct {
+		number string
+		want   string
+	}{
+		{"INV/0009", "INV9"},
+		{"inv-9", "INV9"},
+		{" Inv 9 ", "INV9"},
+		{"0042", "42"},
+		{"100", "100"},
+		{"A-0", "A0"},
+		{"SP/2026-27/0012", "SP20262712"},
+		{"SP/2026-27/12", "SP20262712"},
+		{"GST/25-26/1050", "GST25261050"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := NormaliseInvoiceNumber(tt.number); got != tt.want {
+			t.Errorf("NormaliseInvoiceNumber(%q) = %q, want %q", tt.number, got, tt.want)
+		}
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, time.April, d, 0, 0, 0, 0, time.UTC) }
+	from, to := day(1), day(1).AddDate(0, 1, 0)
+
+	portal := func(gstin, number string) PortalInvoice {
+		return PortalInvoice{GSTIN: gstin, Number: number, Date: day(10), Taxable: 100000, CGST: 6000, SGST: 6000}
+	}
+	book := func(gstin, number string) BookInvoice {
+		return BookInvoice{GSTIN: gstin, Number: number, Date: day(10), Rates: []RateTotal{{Taxable: 100000, CGST: 6000, SGST: 6000}}}
+	}
+	const supplier, other = "27AAPFU0939F1ZV", "29AAGCB7383J1Z4"
+
+	tests := []struct {
+		name      string
+		portal    []PortalInvoice
+		books     []BookInvoice
+		want      []ReconStatus
+		wantDiffs []string
+	}{
+		{
+			name:   "same invoice written differently",
+			portal: []PortalInvoice{portal(supplier, "INV/0009")},
+			books:  []BookInvoice{book("27aapfu0939f1zv", "inv-9")},
+			want:   []ReconStatus{ReconMatched},
+		},
+		{
+			name:   "difference within the tolerance",
+			portal: []PortalInvoice{portal(supplier, "9")},
+			books: func() []BookInvoice {
+				b := book(supplier, "9")
+				b.Rates[0].CGST += ReconTolerance
+				return []BookInvoice{b}
+			}(),
+			want: []ReconStatus{ReconMatched},
+		},
+		{
+			name:   "taxable value beyond the tolerance",
+			portal: []PortalInvoice{portal(supplier, "9")},
+			books: func() []BookInvoice {
+				b := book(supplier, "9")
+				b.Rates[0].Taxable += ReconTolerance + 1
+				return []BookInvoice{b}
+			}(),
+			want:      []ReconStatus{ReconMismatched},
+			wantDiffs: []string{"Taxable value 1001.01 in books, 1000.00 in GSTR-2B"},
+		},
+		{
+			name:   "different date",
+			portal: []PortalInvoice{portal(supplier, "9")},
+			books: func() []BookInvoice {
+				b := book(supplier, "9")
+				b.Date = day(11)
+				return []BookInvoice{b}
+			}(),
+			want:      []ReconStatus{ReconMismatched},
+			wantDiffs: []string{"Date 11-04-2026 in books, 10-04-2026 in GSTR-2B"},
+		},
+		{
+			name:   "book without a GSTIN matched on a unique number",
+			portal: []PortalInvoice{portal(supplier, "9"), portal(other, "10")},
+			books:  []BookInvoice{book("", "9")},
+			want:   []ReconStatus{ReconMissing, ReconMatched},
+		},
+		{
+			name:   "book without a GSTIN is not guessed between suppliers",
+			portal: []PortalInvoice{portal(supplier, "9"), portal(other, "9")},
+			books:  []BookInvoice{book("", "9")},
+			want:   []ReconStatus{ReconMissing, ReconMissing, ReconExtra},
+		},
+		{
+			name:   "same number from another supplier",
+			portal: []PortalInvoice{portal(other, "9")},
+			books:  []BookInvoice{book(supplier, "9")},
+			want:   []ReconStatus{ReconMissing, ReconExtra},
+		},
+		{
+			name:   "books outside the period are not extra",
+			portal: []PortalInvoice{portal(supplier, "9")},
+			books: func() []BookInvoice {
+				b := book(supplier, "8")
+				b.Date = day(1).AddDate(0, 0, -1)
+				return []BookInvoice{b}
+			}(),
+			want: []ReconStatus{ReconMissing},
+		},
+		{
+			name:   "problems come first",
+			portal: []PortalInvoice{portal(supplier, "1"), portal(supplier, "2")},
+			books: func() []BookInvoice {
+				b := book(supplier, "2")
+				b.Rates[0].SGST = 0
+				return []BookInvoice{book(supplier, "1"), b, book(supplier, "3")}
+			}(),
+			want: []ReconStatus{ReconMismatched, ReconExtra, ReconMatched},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := Reconcile(tt.portal, tt.books, from, to)
+			var got []ReconStatus
+			for _, row := range rows {
+				got = append(got, row.Status)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("statuses = %v, want %v", got, tt.want)
+			}
+			if tt.wantDiffs != nil && !reflect.DeepEqual(rows[0].Differences, tt.wantDiffs) {
+				t.Errorf("differences = %q, want %q", rows[0].Differences, tt.wantDiffs)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package gst
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ashX04/new_website/internal/models"
+	"github.com/ashX04/new_website/internal/normalise"
+)
+
+// Supply is whether an invoice is a supply within one state, taxed with
+// CGST and SGST, or between states, taxed with IGST
+type Supply int
+
+const (
+	// SupplyUnknown is used when either state is not known
+	SupplyUnknown Supply = iota
+	SupplyIntraState
+	SupplyInterState
+)
+
+func (s Supply) String() string {
+	switch s {
+	case SupplyIntraState:
+		return "Intra-state"
+	case SupplyInterState:
+		return "Inter-state"
+	}
+	return "Unknown"
+}
+
+// SupplyBetween decides the supply from the state codes of the supplier and
+// the buyer
+func SupplyBetween(supplierState, buyerState string) Supply {
+	switch {
+	case supplierState == "" || buyerState == "":
+		return SupplyUnknown
+	case supplierState == buyerState:
+		return SupplyIntraState
+	}
+	return SupplyInterState
+}
+
+// LineProblems checks that the tax printed on a line fits the supply: CGST
+// and SGST in equal halves within a state, IGST alone between states, and
+// a split that adds up to the GST rate. Lines that print no split are not
+// checked, since their tax follows the supply.
+func LineProblems(v normalise.LineValues, supply Supply) []string {
+	split := v.CGST > 0 || v.SGST > 0
+	var problems []string
+	switch {
+	case split && v.IGST > 0:
+		problems = append(problems, "charges both IGST and CGST/SGST")
+	case split && supply == SupplyInterState:
+		problems = append(problems, "charges CGST/SGST on an inter-state supply")
+	case v.IGST > 0 && supply == SupplyIntraState:
+		problems = append(problems, "charges IGST on an intra-state supply")
+	}
+	if split && BasisPoints(v.CGST) != BasisPoints(v.SGST) {
+		problems = append(problems, "has unequal CGST and SGST")
+	}
+	if charged := BasisPoints(v.CGST + v.SGST + v.IGST); v.GSTRate > 0 && charged > 0 && charged != BasisPoints(v.GSTRate) {
+		problems = append(problems, fmt.Sprintf("splits %g%% GST as %g%%", v.GSTRate, Percent(charged)))
+	}
+	return problems
+}
+
+// InvoiceProblems checks the tax of every line of an invoice against the
+// supply, grouping lines with the same problem: "Lines 2, 5 charge IGST on
+// an intra-state supply"
+func InvoiceProblems(lines []models.InvoiceLine, supply Supply) []string {
+	var order []string
+	byProblem := make(map[string][]string)
+	for i, line := range lines {
+		for _, p := range LineProblems(normalise.Line(line), supply) {
+			if _, ok := byProblem[p]; !ok {
+				order = append(order, p)
+			}
+			byProblem[p] = append(byProblem[p], strconv.Itoa(i+1))
+		}
+	}
+
+	problems := make([]string, len(order))
+	for i, p := range order {
+		numbers := byProblem[p]
+		if len(numbers) == 1 {
+			problems[i] = fmt.Sprintf("Line %s %s", numbers[0], p)
+		} else {
+			problems[i] = fmt.Sprintf("Lines %s %s", strings.Join(numbers, ", "), plural(p))
+		}
+	}
+	return problems
+}
+
+// plural turns "charges ..." and "has ..." into their plural forms
+func plural(problem string) string {
+	verb, rest, _ := strings.Cut(problem, " ")
+	switch verb {
+	case "has":
+		verb = "have"
+	case "charges":
+		verb = "charge"
+	case "splits":
+		verb = "split"
+	}
+	return verb + " " + rest
+}
@@ -0,0 +1,178 @@
+package gst
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/ashX04/new_website/internal/models"
+	"github.com/ashX04/new_website/internal/normalise"
+)
+
+// Amounts are kept in paise and tax rates in basis points (1200 is 12%), so
+// that totals add up to the paisa.
+
+// TaxedLine is an invoice line with its taxable value and tax rates
+type TaxedLine struct {
+	// Index is the position of the line in the invoice
+	Index    int
+	Values   normalise.LineValues
+	Taxable  int64
+	CGSTRate int64
+	SGSTRate int64
+	IGSTRate int64
+	CessRate int64
+}
+
+// Rate is the combined GST rate of the line, without cess
+func (l TaxedLine) Rate() int64 {
+	return l.CGSTRate + l.SGSTRate + l.IGSTRate
+}
+
+// RateTotal is the taxable value and tax of an invoice, or of a register,
+// at one GST rate
+type RateTotal struct {
+	// Rate is the combined GST rate: CGSTRate and SGSTRate within a state,
+	// IGSTRate between states. Cess comes on top.
+	Rate     int64
+	CGSTRate int64
+	SGSTRate int64
+	IGSTRate int64
+	CessRate int64
+	Taxable  int64
+	CGST     int64
+	SGST     int64
+	IGST     int64
+	Cess     int64
+}
+
+// Tax is the total tax, cess included
+func (r RateTotal) Tax() int64 {
+	return r.CGST + r.SGST + r.IGST + r.Cess
+}
+
+// Add adds the amounts of o, keeping the rates of r
+func (r *RateTotal) Add(o RateTotal) {
+	r.Taxable += o.Taxable
+	r.CGST += o.CGST
+	r.SGST += o.SGST
+	r.IGST += o.IGST
+	r.Cess += o.Cess
+}
+
+// InvoiceTax is the tax worked out for the lines of an invoice
+type InvoiceTax struct {
+	Lines []TaxedLine
+	// Rates are the totals per rate, in ascending order of rate
+	Rates []RateTotal
+}
+
+// Total sums the amounts of all rates
+func (t *InvoiceTax) Total() RateTotal {
+	var total RateTotal
+	for _, r := range t.Rates {
+		total.Add(r)
+	}
+	return total
+}
+
+// ComputeInvoice works out the tax of invoice lines. Line amounts are taken
+// as taxable values, falling back to quantity times rate less discount.
+// CGST, SGST and IGST come from the line rates; where no split was printed
+// the GST rate is charged as IGST on inter-state supplies and as two halves
+// otherwise. Tax is worked out on each rate's total taxable value, as
+// accounting packages do. Blank lines are skipped; a product line without
+// an amount is an error.
+func ComputeInvoice(lines []models.InvoiceLine, supply Supply) (*InvoiceTax, error) {
+	t := &InvoiceTax{}
+	type split struct{ cgst, sgst, igst, cess int64 }
+	totals := make(map[split]*RateTotal)
+
+	for i, line := range lines {
+		v := normalise.Line(line)
+		taxable := v.Amount
+		if taxable == 0 && v.Rate > 0 && v.Quantity > 0 {
+			taxable = v.Quantity * v.Rate * (1 - v.Discount/100)
+		}
+		if taxable == 0 {
+			if strings.TrimSpace(line.ProductName) == "" {
+				continue
+			}
+			return nil, fmt.Errorf("line %d (%s) has no amount", i+1, line.ProductName)
+		}
+		cgst, sgst, igst := v.CGST, v.SGST, v.IGST
+		if cgst == 0 && sgst == 0 && igst == 0 && v.GSTRate > 0 {
+			if supply == SupplyInterState {
+				igst = v.GSTRate
+			} else {
+				cgst, sgst = v.GSTRate/2, v.GSTRate/2
+			}
+		}
+		l := TaxedLine{
+			Index:    i,
+			Values:   v,
+			Taxable:  Paise(taxable),
+			CGSTRate: BasisPoints(cgst),
+			SGSTRate: BasisPoints(sgst),
+			IGSTRate: BasisPoints(igst),
+			CessRate: BasisPoints(v.Cess),
+		}
+		t.Lines = append(t.Lines, l)
+
+		key := split{l.CGSTRate, l.SGSTRate, l.IGSTRate, l.CessRate}
+		if totals[key] == nil {
+			totals[key] = &RateTotal{Rate: l.Rate(), CGSTRate: l.CGSTRate, SGSTRate: l.SGSTRate, IGSTRate: l.IGSTRate, CessRate: l.CessRate}
+		}
+		totals[key].Taxable += l.Taxable
+	}
+	if len(t.Lines) == 0 {
+		return nil, fmt.Errorf("invoice has no lines with amounts")
+	}
+
+	for _, r := range totals {
+		r.CGST = TaxOn(r.Taxable, r.CGSTRate)
+		r.SGST = TaxOn(r.Taxable, r.SGSTRate)
+		r.IGST = TaxOn(r.Taxable, r.IGSTRate)
+		r.Cess = TaxOn(r.Taxable, r.CessRate)
+		t.Rates = append(t.Rates, *r)
+	}
+	sort.Slice(t.Rates, func(i, j int) bool {
+		if t.Rates[i].Rate != t.Rates[j].Rate {
+			return t.Rates[i].Rate < t.Rates[j].Rate
+		}
+		if t.Rates[i].IGSTRate != t.Rates[j].IGSTRate {
+			return t.Rates[i].IGSTRate < t.Rates[j].IGSTRate
+		}
+		if t.Rates[i].CGSTRate != t.Rates[j].CGSTRate {
+			return t.Rates[i].CGSTRate < t.Rates[j].CGSTRate
+		}
+		return t.Rates[i].CessRate < t.Rates[j].CessRate
+	})
+	return t, nil
+}
+
+// TaxOn is the tax at a rate on a taxable value, rounded to the paisa
+func TaxOn(taxable, rate int64) int64 {
+	return int64(math.Round(float64(taxable) * float64(rate) / 10000))
+}
+
+// Paise converts rupees to paise
+func Paise(rupees float64) int64 {
+	return int64(math.Round(rupees * 100))
+}
+
+// Rupees converts paise to rupees
+func Rupees(paise int64) float64 {
+	return float64(paise) / 100
+}
+
+// BasisPoints converts a percentage to basis points
+func BasisPoints(percent float64) int64 {
+	return int64(math.Round(percent * 100))
+}
+
+// Percent converts basis points to a percentage
+func Percent(basisPoints int64) float64 {
+	return float64(basisPoints) / 100
+}
@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ashX04/new_website/internal/inventory"
+	"github.com/ashX04/new_website/internal/models"
+	"github.com/ashX04/new_website/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// digestInterval is the least time between two expiry digests of a user
+const digestInterval = 20 * time.Hour
+
+// ExpiryView is an expiring batch together with its product name
+type ExpiryView struct {
+	inventory.ExpiringBatch
+	ProductName string
+}
+
+// WindowCount is the number of batches expiring within an alert window
+type WindowCount struct {
+	Days  int
+	Count int
+}
+
+// ExpirySummary is the dashboard widget of expired and expiring stock
+type ExpirySummary struct {
+	Expired int
+	Windows []WindowCount
+	// Soonest are the first few batches to expire
+	Soonest []ExpiryView
+}
+
+// expiringStock returns the user's batches that have expired or fall within
+// one of the alert windows, judged by today's date in the user's zone
+func expiringStock(userID string, settings *models.Settings, movements []models.StockMovement) ([]ExpiryView, error) {
+	products, err := listProducts(userID)
+	if err != nil {
+		return nil, err
+	}
+	names := productNames(products)
+
+	today := time.Now().In(settings.Location())
+	batches := inventory.Expiring(inventory.Balances(movements), today, settings.AlertWindows())
+	views := make([]ExpiryView, len(batches))
+	for i, b := range batches {
+		views[i] = ExpiryView{ExpiringBatch: b, ProductName: names[b.Product]}
+	}
+	return views, nil
+}
+
+// expirySummary counts expiring batches per window for the dashboard
+func expirySummary(userID string) (*ExpirySummary, error) {
+	settings, err := loadSettings(userID)
+	if err != nil {
+		return nil, err
+	}
+	movements, err := listMovements(userID)
+	if err != nil {
+		return nil, err
+	}
+	batches, err := expiringStock(userID, settings, movements)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &ExpirySummary{}
+	for _, days := range settings.AlertWindows() {
+		summary.Windows = append(summary.Windows, WindowCount{Days: days})
+	}
+	for _, b := range batches {
+		if b.Expired() {
+			summary.Expired++
+			continue
+		}
+		for i := range summary.Windows {
+			if summary.Windows[i].Days == b.Window {
+				summary.Windows[i].Count++
+			}
+		}
+	}
+	summary.Soonest = batches[:min(len(batches), 5)]
+	return summary, nil
+}
+
+// expiryDigest writes the text of a digest of expiring batches
+func expiryDigest(batches []ExpiryView) (string, string) {
+	expired := 0
+	for _, b := range batches {
+		if b.Expired() {
+			expired++
+		}
+	}
+	title := fmt.Sprintf("%d batch(es) expired, %d expiring soon", expired, len(batches)-expired)
+
+	var body strings.Builder
+	for _, b := range batches {
+		status := fmt.Sprintf("expires in %d days", b.DaysLeft)
+		if b.Expired() {
+			status = "EXPIRED"
+		}
+		fmt.Fprintf(&body, "%s, batch %s: %g in stock, expiry %s (%s)\n",
+			b.ProductName, b.Batch, b.Quantity, b.ExpiresOn.Format("Jan 2006"), status)
+	}
+	return title, body.String()
+}
+
+// lastNotification returns when the user was last sent a notification of a
+// kind, or the zero time
+func lastNotification(userID, kind string) (time.Time, error) {
+	params := url.Values{}
+	params.Set("filter", fmt.Sprintf("(user=%s && kind=%s)", utils.PBQuote(userID), utils.PBQuote(kind)))
+	params.Set("sort", "-created")
+	params.Set("perPage", "1")
+	resp, err := utils.PBListRecords[models.Notification]("notifications", params)
+	if err != nil || len(resp.Items) == 0 {
+		return time.Time{}, err
+	}
+	return utils.ParsePBTime(resp.Items[0].Created)
+}
+
+// sendExpiryDigests notifies every user holding expired or soon expiring
+// stock, at most once per digestInterval
+func sendExpiryDigests() error {
+	movements, err := utils.PBListAll[models.StockMovement]("stock_movements", url.Values{"sort": {"created"}})
+	if err != nil {
+		return fmt.Errorf("failed to list stock movements: %w", err)
+	}
+	byUser := make(map[string][]models.StockMovement)
+	for _, m := range movements {
+		byUser[m.User] = append(byUser[m.User], m)
+	}
+
+	for userID, userMovements := range byUser {
+		last, err := lastNotification(userID, models.NotificationExpiryDigest)
+		if err != nil {
+			log.Printf("Error checking last expiry digest of %s: %v", userID, err)
+			continue
+		}
+		if time.Since(last) < digestInterval {
+			continue
+		}
+
+		settings, err := loadSettings(userID)
+		if err != nil {
+			log.Printf("Error loading settings of %s: %v", userID, err)
+			continue
+		}
+		batches, err := expiringStock(userID, settings, userMovements)
+		if err != nil {
+			log.Printf("Error finding expiring stock of %s: %v", userID, err)
+			continue
+		}
+		if len(batches) == 0 {
+			continue
+		}
+
+		title, body := expiryDigest(batches)
+		if err := utils.PBCreateRecord("notifications", models.Notification{
+			User:  userID,
+			Kind:  models.NotificationExpiryDigest,
+			Title: title,
+			Body:  body,
+		}, nil); err != nil {
+			log.Printf("Error storing expiry digest of %s: %v", userID, err)
+			continue
+		}
+		if settings.NotifyEmail != "" {
+			err := utils.SendMail(settings.NotifyEmail, "Stock expiry alert: "+title, body)
+			if err != nil && !errors.Is(err, utils.ErrMailNotConfigured) {
+				log.Printf("Error emailing expiry digest of %s: %v", userID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// RunExpiryAlerts checks for expiring stock every interval and sends digests.
+// It blocks, so start it in its own goroutine.
+func RunExpiryAlerts(interval time.Duration) {
+	for {
+		if err := sendExpiryDigests(); err != nil {
+			log.Printf("Error sending expiry digests: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// ShowExpiry lists every expired and soon expiring batch
+func ShowExpiry(c *gin.Context) {
+	userID := currentUserID(c)
+
+	settings, err := loadSettings(userID)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "expiry.html", gin.H{
+			"error": "Failed to load settings",
+		})
+		return
+	}
+	movements, err := listMovements(userID)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "expiry.html", gin.H{
+			"error": "Failed to load stock",
+		})
+		return
+	}
+	batches, err := expiringStock(userID, settings, movements)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "expiry.html", gin.H{
+			"error": "Failed to load products",
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "expiry.html", gin.H{
+		"Batches": batches,
+		"Windows": settings.AlertWindows(),
+	})
+}
+
+// unreadNotifications counts the user's unread notifications
+func unreadNotifications(userID string) (int, error) {
+	params := url.Values{}
+	params.Set("filter", fmt.Sprintf("(user=%s && read=false)", utils.PBQuote(userID)))
+	params.Set("fields", "id")
+	params.Set("perPage", "1")
+	resp, err := utils.PBListRecords[models.Notification]("notifications", params)
+	if err != nil {
+		return 0, err
+	}
+	return resp.TotalItems, nil
+}
+
+// ShowNotifications lists the user's most recent notifications
+func ShowNotifications(c *gin.Context) {
+	userID := currentUserID(c)
+	loc := userLocation(userID)
+
+	params := url.Values{}
+	params.Set("filter", fmt.Sprintf("(user=%s)", utils.PBQuote(userID)))
+	params.Set("sort", "-created")
+	params.Set("perPage", "50")
+	resp, err := utils.PBListRecords[models.Notification]("notifications", params)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "notifications.html", gin.H{
+			"error": "Failed to load notifications",
+		})
+		return
+	}
+	for i := range resp.Items {
+		if t, err := utils.ParsePBTime(resp.Items[i].Created); err == nil {
+			resp.Items[i].Created = t.In(loc).Format("2006-01-02 15:04")
+		}
+	}
+
+	c.HTML(http.StatusOK, "notifications.html", gin.H{
+		"Notifications": resp.Items,
+	})
+}
+
+// MarkNotificationsRead marks all of the user's notifications as read
+func MarkNotificationsRead(c *gin.Context) {
+	userID := currentUserID(c)
+
+	params := url.Values{}
+	params.Set("filter", fmt.Sprintf("(user=%s && read=false)", utils.PBQuote(userID)))
+	params.Set("fields", "id")
+	unread, err := utils.PBListAll[models.Notification]("notifications", params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load notifications"})
+		return
+	}
+	for _, n := range unread {
+		if err := utils.PBUpdateRecord("notifications", n.ID, map[string]interface{}{
+			"read": true,
+		}, nil); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notifications"})
+			return
+		}
+	}
+
+	c.Redirect(http.StatusSeeOther, "/notifications")
+}
@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ashX04/new_website/internal/analytics"
+	"github.com/ashX04/new_website/internal/gst"
+	"github.com/gin-gonic/gin"
+)
+
+// maxAnalyticsMonths caps the months one analytics page covers
+const maxAnalyticsMonths = 60
+
+// RankedView is a supplier or product on the analytics page
+type RankedView struct {
+	Name     string
+	Spend    string
+	Invoices int
+	Quantity float64
+	// Share is the width of its bar, as a percentage of the largest
+	Share float64
+	Href  string
+}
+
+// RateView is the tax paid at one GST rate
+type RateView struct {
+	Rate    float64
+	Taxable string
+	CGST    string
+	SGST    string
+	IGST    string
+	Cess    string
+	Tax     string
+}
+
+// PurchaseView is an invoice listed on the analytics page
+type PurchaseView struct {
+	ID       string
+	Date     string
+	Number   string
+	Supplier string
+	Spend    string
+}
+
+// FilterView is an active drill-down with the link that clears it
+type FilterView struct {
+	Label    string
+	ClearURL string
+}
+
+// analyticsURL links to the analytics page with one query parameter
+// changed, or removed when value is empty
+func analyticsURL(query url.Values, key, value string) string {
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	if value == "" {
+		q.Del(key)
+	} else {
+		q.Set(key, value)
+	}
+	if len(q) == 0 {
+		return "/analytics"
+	}
+	return "/analytics?" + q.Encode()
+}
+
+// analyticsPurchases turns the purchase books into the purchases analytics
+// aggregates, naming linked products after the product master
+func analyticsPurchases(books *purchaseBooks, productNames map[string]string) []analytics.Purchase {
+	purchases := make([]analytics.Purchase, 0, len(books.invoices))
+	for i := range books.invoices {
+		invoice := &books.invoices[i]
+		p := analytics.Purchase{
+			ID:           invoice.ID,
+			Number:       invoice.Number,
+			Date:         invoice.Date,
+			Supplier:     supplierKey(invoice),
+			SupplierName: invoice.Supplier,
+			Rates:        invoice.Rates,
+		}
+		lines := books.lines[invoice.ID]
+		for _, l := range books.taxes[invoice.ID].Lines {
+			line := lines[l.Index]
+			name := productNames[line.ProductID]
+			if name == "" {
+				name = line.ProductName
+			}
+			p.Lines = append(p.Lines, analytics.Line{
+				Index:       l.Index,
+				Product:     analytics.ProductKey(line.ProductID, line.ProductName),
+				ProductName: name,
+				Quantity:    l.Values.Quantity,
+				Taxable:     l.Taxable,
+				Rate:        gst.Paise(l.Values.Rate),
+				MRP:         gst.Paise(l.Values.MRP),
+			})
+		}
+		purchases = append(purchases, p)
+	}
+	return purchases
+}
+
+// rankedViews lays out ranked suppliers or products as bars relative to the
+// first, linking each to the page filtered by it
+func rankedViews(entries []analytics.Ranked, query url.Values, key string) []RankedView {
+	views := make([]RankedView, len(entries))
+	for i, e := range entries {
+		views[i] = RankedView{
+			Name:     e.Name,
+			Spend:    analytics.Rupees(e.Spend),
+			Invoices: e.Invoices,
+			Quantity: e.Quantity,
+			Href:     analyticsURL(query, key, e.Key),
+		}
+		if entries[0].Spend > 0 {
+			views[i].Share = float64(e.Spend) * 100 / float64(entries[0].Spend)
+		}
+	}
+	return views
+}
+
+// ShowAnalytics renders purchase analytics: spend by month, top suppliers
+// and products, tax by rate and, for one product, its average price over
+// time. ?from= and ?to= (YYYY-MM) choose the months, the twelve up to the
+// current one by default; ?supplier=, ?product= and ?month= drill down to
+// the invoices behind a figure.
+func ShowAnalytics(c *gin.Context) {
+	userID := currentUserID(c)
+	settings, err := loadSettings(userID)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "analytics.html", gin.H{
+			"error": "Failed to load settings",
+		})
+		return
+	}
+	loc := settings.Location()
+
+	to := parseMonth(c.Query("to"), loc)
+	from := to.AddDate(0, -11, 0)
+	if c.Query("from") != "" {
+		from = parseMonth(c.Query("from"), loc)
+	}
+	if from.After(to) {
+		from, to = to, from
+	}
+	if limit := to.AddDate(0, -(maxAnalyticsMonths - 1), 0); from.Before(limit) {
+		from = limit
+	}
+	filter := analytics.Filter{
+		From:     from,
+		To:       to,
+		Supplier: c.Query("supplier"),
+		Product:  c.Query("product"),
+	}
+	if month := c.Query("month"); month != "" {
+		filter.Month = parseMonth(month, loc)
+	}
+
+	books, err := loadPurchaseBooks(userID, settings)
+	if err != nil {
+		log.Printf("Error loading purchase books: %v", err)
+		c.HTML(http.StatusInternalServerError, "analytics.html", gin.H{
+			"error": "Failed to load invoices",
+		})
+		return
+	}
+	products, err := listProducts(userID)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "analytics.html", gin.H{
+			"error": "Failed to load products",
+		})
+		return
+	}
+	report := analytics.Build(analyticsPurchases(books, productNames(products)), filter)
+
+	query := c.Request.URL.Query()
+	query.Set("from", from.Format("2006-01"))
+	query.Set("to", to.Format("2006-01"))
+
+	count := 0
+	monthData := make([]analytics.Datum, len(report.Months))
+	for i, m := range report.Months {
+		count += m.Invoices
+		monthData[i] = analytics.Datum{
+			Label: m.Month.Format("Jan 06"),
+			Value: gst.Rupees(m.Spend),
+			Title: fmt.Sprintf("%s: %s in %d invoice(s), %s tax", m.Month.Format("January 2006"), analytics.Rupees(m.Spend), m.Invoices, analytics.Rupees(m.Tax)),
+			Href:  analyticsURL(query, "month", m.Month.Format("2006-01")),
+		}
+	}
+
+	var priceChart *analytics.Chart
+	if filter.Product != "" && len(report.Prices) > 0 {
+		priceData := make([]analytics.Datum, len(report.Prices))
+		for i, p := range report.Prices {
+			average := p.Average() / 100
+			priceData[i] = analytics.Datum{
+				Label: p.Month.Format("Jan 06"),
+				Value: average,
+				Title: fmt.Sprintf("%s: %.2f per unit over %g unit(s)", p.Month.Format("January 2006"), average, p.Quantity),
+				Href:  analyticsURL(query, "month", p.Month.Format("2006-01")),
+			}
+		}
+		chart := analytics.LineChart(priceData, analytics.Compact)
+		priceChart = &chart
+	}
+	// Products linked to the master have a price history per invoice
+	priceHistory := ""
+	if filter.Product != "" && !strings.HasPrefix(filter.Product, "name:") {
+		priceHistory = "/products/" + url.PathEscape(filter.Product) + "/prices"
+	}
+
+	rates := make([]RateView, len(report.Rates))
+	for i, r := range report.Rates {
+		rates[i] = RateView{
+			Rate:    gst.Percent(r.Rate),
+			Taxable: analytics.Rupees(r.Taxable),
+			CGST:    analytics.Rupees(r.CGST),
+			SGST:    analytics.Rupees(r.SGST),
+			IGST:    analytics.Rupees(r.IGST),
+			Cess:    analytics.Rupees(r.Cess),
+			Tax:     analytics.Rupees(r.Tax()),
+		}
+	}
+	invoices := make([]PurchaseView, len(report.Invoices))
+	for i, p := range report.Invoices {
+		invoices[i] = PurchaseView{
+			ID:       p.ID,
+			Date:     p.Date.Format("02-01-2006"),
+			Number:   p.Number,
+			Supplier: p.SupplierName,
+			Spend:    analytics.Rupees(p.Spend()),
+		}
+	}
+
+	var filters []FilterView
+	if filter.Supplier != "" {
+		name := filter.Supplier
+		for _, s := range report.Suppliers {
+			if s.Key == filter.Supplier {
+				name = s.Name
+			}
+		}
+		filters = append(filters, FilterView{Label: "Supplier: " + name, ClearURL: analyticsURL(query, "supplier", "")})
+	}
+	if filter.Product != "" {
+		name := report.ProductName
+		if name == "" {
+			name = filter.Product
+		}
+		filters = append(filters, FilterView{Label: "Product: " + name, ClearURL: analyticsURL(query, "product", "")})
+	}
+	if !filter.Month.IsZero() {
+		filters = append(filters, FilterView{Label: "Invoices of " + filter.Month.Format("January 2006"), ClearURL: analyticsURL(query, "month", "")})
+	}
+
+	total := report.Total
+	c.HTML(http.StatusOK, "analytics.html", gin.H{
+		"From":         from.Format("2006-01"),
+		"To":           to.Format("2006-01"),
+		"Filters":      filters,
+		"Spend":        analytics.Rupees(total.Taxable + total.Tax()),
+		"Taxable":      analytics.Rupees(total.Taxable),
+		"Tax":          analytics.Rupees(total.Tax()),
+		"Count":        count,
+		"MonthChart":   analytics.BarChart(monthData, analytics.Compact),
+		"PriceChart":   priceChart,
+		"ProductName":  report.ProductName,
+		"PriceHistory": priceHistory,
+		"Suppliers":    rankedViews(report.Suppliers, query, "supplier"),
+		"Products":     rankedViews(report.Products, query, "product"),
+		"Rates":        rates,
+		"Invoices":     invoices,
+		"Supplier":     filter.Supplier,
+		"Product":      filter.Product,
+	})
+}
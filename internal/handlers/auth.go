@@ -133,6 +133,12 @@ type AuthResponse struct {
 	} `json:"record"`
 }
 
+// currentUserID returns the ID of the logged in user, or "" if there is none
+func currentUserID(c *gin.Context) string {
+	userID, _ := sessions.Default(c).Get("userID").(string)
+	return userID
+}
+
 // RequireAuth middleware for authentication
 func RequireAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/ashX04/new_website/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// ServeBlob serves blobs of the filesystem store to holders of a signed URL.
+// The signature replaces the session check, so this route is public.
+func ServeBlob(c *gin.Context) {
+	fsStore, ok := storage.Default.(*storage.FSStore)
+	if !ok {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	name := c.Query("name")
+	if !fsStore.Verify(key, c.Query("expires"), name, c.Query("sig")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Link is invalid or has expired"})
+		return
+	}
+
+	blob, err := fsStore.Get(c.Request.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		}
+		return
+	}
+	defer blob.Close()
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Cache-Control", "private, no-store")
+	if name != "" {
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	}
+	c.Status(http.StatusOK)
+	io.Copy(c.Writer, blob)
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ashX04/new_website/internal/export"
+	"github.com/ashX04/new_website/internal/models"
+	"github.com/ashX04/new_website/internal/storage"
+)
+
+// maxSelection is the most files one bulk download or export may select
+const maxSelection = 200
+
+// unsafeNameChars are replaced in zip entry names
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// bundleEntry is a file included in a bulk zip
+type bundleEntry struct {
+	ID            string `json:"id"`
+	Supplier      string `json:"supplier,omitempty"`
+	InvoiceNumber string `json:"invoice_number,omitempty"`
+	InvoiceDate   string `json:"invoice_date,omitempty"`
+	Workbook      string `json:"workbook"`
+	Source        string `json:"source,omitempty"`
+	// SourceError says why the source image is missing when it was asked for
+	SourceError string `json:"source_error,omitempty"`
+}
+
+// bundleManifest is the manifest.json of a bulk zip
+type bundleManifest struct {
+	GeneratedAt string        `json:"generated_at"`
+	Included    []bundleEntry `json:"included"`
+	Skipped     []skippedFile `json:"skipped"`
+}
+
+// writeBundle streams a zip of the workbooks of files, and their source
+// images if asked for, followed by manifest.json and, if anything went
+// wrong, errors.txt. Files that cannot be fetched are listed as skipped
+// rather than failing the download.
+func writeBundle(ctx context.Context, w io.Writer, files []*models.ExcelFile, skipped []skippedFile, withSources bool) error {
+	zw := zip.NewWriter(w)
+	manifest := bundleManifest{
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+		Included:    []bundleEntry{},
+		Skipped:     append([]skippedFile{}, skipped...),
+	}
+
+	used := make(map[string]bool)
+	for _, file := range files {
+		base := uniqueName(used, entryBase(file))
+		entry := bundleEntry{
+			ID:            file.ID,
+			Supplier:      export.SupplierName(file),
+			InvoiceNumber: file.InvoiceNumber,
+			InvoiceDate:   file.InvoiceDate,
+			Workbook:      base + ".xlsx",
+		}
+		if err := addZipEntry(zw, entry.Workbook, func() (io.ReadCloser, error) { return openExcel(ctx, file) }); err != nil {
+			manifest.Skipped = append(manifest.Skipped, skippedFile{ID: file.ID, Reason: "workbook: " + err.Error()})
+			continue
+		}
+
+		if withSources {
+			if ext := sourceExt(file); ext == "" {
+				entry.SourceError = "no source image"
+			} else {
+				name := "sources/" + base + ext
+				if err := addZipEntry(zw, name, func() (io.ReadCloser, error) { return openSource(ctx, file) }); err != nil {
+					entry.SourceError = err.Error()
+				} else {
+					entry.Source = name
+				}
+			}
+		}
+		manifest.Included = append(manifest.Included, entry)
+	}
+
+	mw, err := zw.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(mw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return err
+	}
+
+	var problems []string
+	for _, s := range manifest.Skipped {
+		problems = append(problems, fmt.Sprintf("%s: skipped, %s", s.ID, s.Reason))
+	}
+	for _, e := range manifest.Included {
+		if e.SourceError != "" {
+			problems = append(problems, fmt.Sprintf("%s: source image missing, %s", e.ID, e.SourceError))
+		}
+	}
+	if len(problems) > 0 {
+		ew, err := zw.Create("errors.txt")
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(ew, strings.Join(problems, "\r\n")+"\r\n"); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// addZipEntry copies an artifact into the zip. The artifact is opened before
+// the entry is created, so that a missing file leaves no empty entry behind.
+func addZipEntry(zw *zip.Writer, name string, open func() (io.ReadCloser, error)) error {
+	src, err := open()
+	if err != nil {
+		return fmt.Errorf("failed to fetch: %w", err)
+	}
+	defer src.Close()
+
+	dst, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		return fmt.Errorf("incomplete: %w", err)
+	}
+	return nil
+}
+
+// entryBase names a file in the zip after its supplier and invoice number
+func entryBase(file *models.ExcelFile) string {
+	var parts []string
+	for _, part := range []string{export.SupplierName(file), file.InvoiceNumber} {
+		if part = strings.Trim(unsafeNameChars.ReplaceAllString(part, "_"), "_."); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return "invoice_" + file.ID
+	}
+	return strings.Join(parts, "_")
+}
+
+// uniqueName numbers names already used in the zip: name, name_2, name_3
+func uniqueName(used map[string]bool, name string) string {
+	unique := name
+	for n := 2; used[strings.ToLower(unique)]; n++ {
+		unique = fmt.Sprintf("%s_%d", name, n)
+	}
+	used[strings.ToLower(unique)] = true
+	return unique
+}
+
+// sourceExt is the extension of a record's source image, or "" if it has
+// none
+func sourceExt(file *models.ExcelFile) string {
+	if file.ImageKey != "" {
+		return strings.ToLower(path.Ext(file.ImageKey))
+	}
+	return strings.ToLower(path.Ext(file.Image))
+}
+
+// openSource opens a record's source image from the blob store, or from
+// PocketBase for legacy records
+func openSource(ctx context.Context, file *models.ExcelFile) (io.ReadCloser, error) {
+	if file.ImageKey != "" {
+		return storage.Default.Get(ctx, file.ImageKey)
+	}
+	return openPBFile(file.ID, file.Image)
+}
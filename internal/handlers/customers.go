@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ashX04/new_website/internal/gst"
+	"github.com/ashX04/new_website/internal/models"
+	"github.com/ashX04/new_website/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// listCustomers returns the customer master of a user by name
+func listCustomers(userID string) ([]models.Customer, error) {
+	params := url.Values{}
+	params.Set("filter", fmt.Sprintf("(user=%s)", utils.PBQuote(userID)))
+	params.Set("sort", "name")
+	return utils.PBListAll[models.Customer]("customers", params)
+}
+
+// ownedCustomer fetches a customer and checks that it belongs to userID
+func ownedCustomer(userID, id string) (*models.Customer, error) {
+	var customer models.Customer
+	if err := utils.PBGetRecord("customers", id, &customer); err != nil {
+		return nil, err
+	}
+	if customer.User != userID {
+		return nil, utils.ErrRecordNotFound
+	}
+	return &customer, nil
+}
+
+// ShowCustomers renders the customer master. With ?edit=<id> the form is
+// filled in for that customer.
+func ShowCustomers(c *gin.Context) {
+	userID := currentUserID(c)
+
+	customers, err := listCustomers(userID)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "customers.html", gin.H{
+			"error": "Failed to load customers",
+		})
+		return
+	}
+
+	edit := &models.Customer{}
+	if id := c.Query("edit"); id != "" {
+		if customer, err := ownedCustomer(userID, id); err == nil {
+			edit = customer
+		}
+	}
+
+	c.HTML(http.StatusOK, "customers.html", gin.H{
+		"Customers": customers,
+		"Edit":      edit,
+		"States":    gst.States(),
+	})
+}
+
+// SaveCustomer creates a customer, or updates it when the form carries an
+// ID. Invoices already issued keep the details they were issued with.
+func SaveCustomer(c *gin.Context) {
+	userID := currentUserID(c)
+
+	customer := &models.Customer{User: userID}
+	if id := c.PostForm("id"); id != "" {
+		existing, err := ownedCustomer(userID, id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+			return
+		}
+		customer = existing
+	}
+
+	customer.Name = strings.TrimSpace(c.PostForm("name"))
+	customer.GSTIN = gst.NormaliseGSTIN(c.PostForm("gstin"))
+	customer.Address = strings.TrimSpace(c.PostForm("address"))
+	customer.State = c.PostForm("state")
+	customer.Phone = strings.TrimSpace(c.PostForm("phone"))
+
+	if customer.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Customer name is required"})
+		return
+	}
+	if customer.GSTIN != "" {
+		if !gst.ValidGSTIN(customer.GSTIN) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid GSTIN"})
+			return
+		}
+		// The GSTIN is authoritative for the state of registration
+		customer.State = gst.StateCode(customer.GSTIN)
+	}
+	if gst.StateName(customer.State) == "" {
+		customer.State = ""
+	}
+
+	var err error
+	if customer.ID == "" {
+		err = utils.PBCreateRecord("customers", customer, nil)
+	} else {
+		err = utils.PBUpdateRecord("customers", customer.ID, customer, nil)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save customer"})
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, "/customers")
+}
+
+// DeleteCustomer removes a customer that has not been invoiced
+func DeleteCustomer(c *gin.Context) {
+	userID := currentUserID(c)
+
+	customer, err := ownedCustomer(userID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	}
+	invoices, err := listSales(userID, fmt.Sprintf("customer=%s", utils.PBQuote(customer.ID)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load sales invoices"})
+		return
+	}
+	if len(invoices) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Customers with sales invoices cannot be deleted"})
+		return
+	}
+	if err := utils.PBDeleteRecord("customers", customer.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete customer"})
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, "/customers")
+}
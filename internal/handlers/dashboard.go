@@ -1,18 +1,19 @@
 package handlers
 
 import (
-	"archive/zip"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"html"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
-	"os"
 	"sort"
-	"strings"
+	"strconv"
 	"time"
 
+	"github.com/ashX04/new_website/internal/models"
+	"github.com/ashX04/new_website/internal/storage"
 	"github.com/ashX04/new_website/internal/utils"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -22,6 +23,19 @@ type DashboardData struct {
 	Title      string
 	FileGroups []FileGroup
 	Error      string
+
+	Filters    DashboardFilters
+	Page       int
+	TotalPages int
+	TotalItems int
+	PrevURL    string
+	NextURL    string
+
+	// Expiry summarises expired and soon expiring stock; nil if it could
+	// not be loaded
+	Expiry *ExpirySummary
+	// Unread is the number of unread notifications
+	Unread int
 }
 
 type FileGroup struct {
@@ -35,20 +49,25 @@ type FileData struct {
 	CreatedAt time.Time
 	Image     string
 	ExcelFile string
+	IsPDF     bool
+	Pages     int
+	Processed bool
+	// Approved invoices can be exported to Tally
+	Approved bool
+
+	SupplierName    string
+	InvoiceNumber   string
+	DuplicateOf     string
+	DuplicateReason string
 }
 
-type PocketBaseResponse struct {
-	Page       int `json:"page"`
-	PerPage    int `json:"perPage"`
-	TotalItems int `json:"totalItems"`
-	Items      []struct {
-		ID      string `json:"id"`
-		Created string `json:"created"`
-		Excel   string `json:"excel"`
-		Image   string `json:"image"`
-		User    string `json:"user"`
-	} `json:"items"`
-}
+// dashboardFields are the record fields the dashboard needs
+const dashboardFields = "id,created,user,excel,image,image_key,processed_key,excel_key,pages," +
+	"supplier_name,supplier,invoice_number,invoice_total,status,duplicate_of,duplicate_reason," +
+	"expand.supplier.name"
+
+// signedURLTTL is how long download links handed out by the app stay valid
+const signedURLTTL = 5 * time.Minute
 
 func ShowDashboard(c *gin.Context) {
 	session := sessions.Default(c)
@@ -61,33 +80,26 @@ func ShowDashboard(c *gin.Context) {
 		return
 	}
 
-	// Sanitize user ID
-	userIDStr := html.EscapeString(fmt.Sprintf("%v", userID))
+	filters := parseDashboardFilters(c)
+	loc := userLocation(userID.(string))
 
-	// Create safe URL with proper escaping
-	baseURL := "http://127.0.0.1:8090/api/collections/excel_files/records"
+	// Fetch one page of the user's files, newest first, leaving out the
+	// bulky line items
 	params := url.Values{}
-	params.Add("filter", fmt.Sprintf("(user='%s')", url.QueryEscape(userIDStr)))
-
-	// Make HTTP request with secure client and timeout
-	resp, err := utils.SecureClient.Get(baseURL + "?" + params.Encode())
+	params.Set("filter", filters.pbFilter(userID.(string), loc))
+	params.Set("sort", "-created")
+	params.Set("page", strconv.Itoa(filters.Page))
+	params.Set("perPage", strconv.Itoa(dashboardPageSize))
+	params.Set("fields", dashboardFields)
+	params.Set("expand", "supplier")
+
+	pbResp, err := utils.PBListRecords[models.ExcelFile]("excel_files", params)
 	if err != nil {
 		c.HTML(http.StatusOK, "dashboard.html", DashboardData{
 			Title:      "Dashboard",
 			Error:      "Failed to fetch files",
 			FileGroups: []FileGroup{},
-		})
-		return
-	}
-	defer resp.Body.Close()
-
-	// Parse response
-	var pbResp PocketBaseResponse
-	if err := json.NewDecoder(resp.Body).Decode(&pbResp); err != nil {
-		c.HTML(http.StatusOK, "dashboard.html", DashboardData{
-			Title:      "Dashboard",
-			Error:      "Failed to parse response: " + err.Error(),
-			FileGroups: []FileGroup{},
+			Filters:    filters,
 		})
 		return
 	}
@@ -100,29 +112,36 @@ func ShowDashboard(c *gin.Context) {
 			continue
 		}
 
-		createdTime, err := time.Parse("2006-01-02 15:04:05.999Z", item.Created)
+		createdTime, err := utils.ParsePBTime(item.Created)
 		if err != nil {
 			continue
 		}
 
 		fileData := FileData{
-			ID:        item.ID,
-			Created:   createdTime.Format("2006-01-02 15:04:05"),
-			CreatedAt: createdTime, // Store the time.Time for sorting
+			ID:              item.ID,
+			Created:         createdTime.In(loc).Format("2006-01-02 15:04 MST"),
+			CreatedAt:       createdTime, // Store the time.Time for sorting
+			SupplierName:    item.SupplierName,
+			InvoiceNumber:   item.InvoiceNumber,
+			DuplicateOf:     item.DuplicateOf,
+			DuplicateReason: item.DuplicateReason,
+			Approved:        item.Status == models.StatusApproved,
 		}
-
-		// Set Excel file URL
-		if item.Excel != "" {
-			fileData.ExcelFile = fmt.Sprintf("http://127.0.0.1:8090/api/files/excel_files/%s/%s",
-				item.ID,
-				item.Excel)
+		// Prefer the supplier master's name over the one read off the page
+		if item.Expand != nil && item.Expand.Supplier != nil {
+			fileData.SupplierName = item.Expand.Supplier.Name
 		}
 
-		// Set Image URL
-		if item.Image != "" {
-			fileData.Image = fmt.Sprintf("http://127.0.0.1:8090/api/files/excel_files/%s/%s",
-				item.ID,
-				item.Image)
+		// Artifacts are only reachable through the authenticated routes,
+		// which hand out short-lived signed URLs
+		if item.ExcelKey != "" || item.Excel != "" {
+			fileData.ExcelFile = "/download/" + item.ID
+		}
+		if item.ImageKey != "" || item.Image != "" {
+			fileData.Image = "/preview/" + item.ID
+			fileData.IsPDF = utils.IsPDF(item.ImageKey) || utils.IsPDF(item.Image)
+			fileData.Pages = item.Pages
+			fileData.Processed = item.ProcessedKey != ""
 		}
 
 		files = append(files, fileData)
@@ -133,269 +152,320 @@ func ShowDashboard(c *gin.Context) {
 		return files[i].CreatedAt.After(files[j].CreatedAt)
 	})
 
-	// Group files by date
-	fileGroups := groupFilesByDate(files)
+	// Group files by date in the user's time zone. Groups are per page, so a
+	// day that spans two pages is continued at the top of the next one.
+	fileGroups := groupFilesByDate(files, loc)
 
-	c.HTML(http.StatusOK, "dashboard.html", DashboardData{
+	data := DashboardData{
 		Title:      "Dashboard",
 		FileGroups: fileGroups,
-	})
+		Filters:    filters,
+		Page:       pbResp.Page,
+		TotalPages: pbResp.TotalPages,
+		TotalItems: pbResp.TotalItems,
+	}
+	if pbResp.Page > 1 {
+		data.PrevURL = filters.PageURL(pbResp.Page - 1)
+	}
+	if pbResp.Page < pbResp.TotalPages {
+		data.NextURL = filters.PageURL(pbResp.Page + 1)
+	}
+
+	// The widgets are secondary: the file list is shown even if they fail
+	if summary, err := expirySummary(userID.(string)); err != nil {
+		log.Printf("Error loading expiry summary: %v", err)
+	} else {
+		data.Expiry = summary
+	}
+	if unread, err := unreadNotifications(userID.(string)); err != nil {
+		log.Printf("Error counting notifications: %v", err)
+	} else {
+		data.Unread = unread
+	}
+
+	c.HTML(http.StatusOK, "dashboard.html", data)
 }
 
-// Helper function to group files by date
-func groupFilesByDate(files []FileData) []FileGroup {
+// groupFilesByDate buckets files by calendar day in loc, so that an upload
+// at 1 AM local time lands on that day rather than on the previous UTC day.
+// Groups and the files within them are ordered newest first.
+func groupFilesByDate(files []FileData, loc *time.Location) []FileGroup {
 	groups := make(map[string][]FileData)
+	labels := make(map[string]string)
 
 	for _, file := range files {
-		date := file.CreatedAt.Format("January 2, 2006") // Format date as "Month Day, Year"
-		groups[date] = append(groups[date], file)
+		local := file.CreatedAt.In(loc)
+		key := local.Format("2006-01-02") // Sortable day key
+		groups[key] = append(groups[key], file)
+		labels[key] = local.Format("January 2, 2006") // Format date as "Month Day, Year"
 	}
 
-	// Convert map to sorted slice
-	var fileGroups []FileGroup
-	for date, files := range groups {
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	// Sort groups by date (newest first)
+	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+
+	fileGroups := make([]FileGroup, 0, len(keys))
+	for _, key := range keys {
+		groupFiles := groups[key]
+		sort.SliceStable(groupFiles, func(i, j int) bool {
+			return groupFiles[i].CreatedAt.After(groupFiles[j].CreatedAt)
+		})
 		fileGroups = append(fileGroups, FileGroup{
-			Date:  date,
-			Files: files,
+			Date:  labels[key],
+			Files: groupFiles,
 		})
 	}
 
-	// Sort groups by date (newest first)
-	sort.Slice(fileGroups, func(i, j int) bool {
-		dateI, _ := time.Parse("January 2, 2006", fileGroups[i].Date)
-		dateJ, _ := time.Parse("January 2, 2006", fileGroups[j].Date)
-		return dateI.After(dateJ)
-	})
-
 	return fileGroups
 }
 
-// DownloadFile handles file downloads
+// DownloadFile serves the stored workbook of an invoice, or its extraction
+// data in another format chosen with ?format= or the Accept header
 func DownloadFile(c *gin.Context) {
 	id := c.Param("id")
 
-	// Get the file info first
-	infoURL := fmt.Sprintf("http://127.0.0.1:8090/api/collections/excel_files/records/%s", id)
-	resp, err := utils.SecureClient.Get(infoURL)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get file info"})
+	fileInfo, ok := ownedFile(c, id)
+	if !ok {
 		return
 	}
-	defer resp.Body.Close()
 
-	var fileInfo struct {
-		Excel string `json:"excel"`
+	// Other formats are generated from the extraction data
+	format, ok := downloadFormat(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown format"})
+		return
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&fileInfo); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse file info"})
+	if format != formatXLSX {
+		sendExport(c, format, "invoice_"+fileInfo.ID, []*models.ExcelFile{fileInfo})
 		return
 	}
 
-	// Construct the correct download URL with the filename
-	fileURL := fmt.Sprintf("http://127.0.0.1:8090/api/files/excel_files/%s/%s", id, fileInfo.Excel)
-	c.Redirect(http.StatusFound, fileURL)
-}
+	if fileInfo.ExcelKey == "" {
+		// Records created before the blob store keep the file in PocketBase
+		fileURL := fmt.Sprintf("http://127.0.0.1:8090/api/files/excel_files/%s/%s", id, fileInfo.Excel)
+		c.Redirect(http.StatusFound, fileURL)
+		return
+	}
 
-// DeleteFile handles file deletion
-func DeleteFile(c *gin.Context) {
-	id := c.Param("id")
+	signedURL, err := storage.Default.SignedURL(c.Request.Context(), fileInfo.ExcelKey, downloadName(fileInfo), signedURLTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create download link"})
+		return
+	}
+	c.Redirect(http.StatusFound, signedURL)
+}
 
+// ownedFile fetches an excel_files record and checks that it belongs to the
+// session user. It writes the error response itself and reports whether the
+// caller may continue.
+func ownedFile(c *gin.Context, id string) (*models.ExcelFile, bool) {
 	// Validate file ID
 	if !utils.ValidateFileID(id) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file ID"})
-		return
+		return nil, false
 	}
 
 	session := sessions.Default(c)
-	userID := session.Get("userID")
-
-	if userID == nil {
+	userID, _ := session.Get("userID").(string)
+	if userID == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
-		return
+		return nil, false
 	}
 
-	// Create safe URL using the sanitized ID directly
-	safeURL, err := utils.SanitizeURL(fmt.Sprintf("http://127.0.0.1:8090/api/collections/excel_files/records/%s", url.QueryEscape(id)))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid URL"})
-		return
+	var fileInfo models.ExcelFile
+	if err := utils.PBGetRecord("excel_files", id, &fileInfo); err != nil {
+		if errors.Is(err, utils.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get file info"})
+		}
+		return nil, false
 	}
 
-	// Use secure client for requests
-	resp, err := utils.SecureClient.Get(safeURL)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify file ownership"})
-		return
+	// Check if the file belongs to the user
+	if fileInfo.User != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to access this file"})
+		return nil, false
 	}
-	defer resp.Body.Close()
 
-	var fileRecord struct {
-		User string `json:"user"`
+	return &fileInfo, true
+}
+
+// downloadName is the filename offered to the browser for a workbook
+func downloadName(file *models.ExcelFile) string {
+	if file.ExcelKey == "" {
+		return file.Excel
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&fileRecord); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify file ownership"})
-		return
+	return fmt.Sprintf("invoice_%s.xlsx", file.ID)
+}
+
+// openExcel opens a record's workbook from the blob store, or from
+// PocketBase for legacy records
+func openExcel(ctx context.Context, file *models.ExcelFile) (io.ReadCloser, error) {
+	if file.ExcelKey != "" {
+		return storage.Default.Get(ctx, file.ExcelKey)
 	}
 
-	// Check if the file belongs to the user
-	if fileRecord.User != userID.(string) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to delete this file"})
+	return openPBFile(file.ID, file.Excel)
+}
+
+// openPBFile opens a file field of a legacy excel_files record
+func openPBFile(id, name string) (io.ReadCloser, error) {
+	if name == "" {
+		return nil, fmt.Errorf("record has no such file")
+	}
+	fileURL := fmt.Sprintf("http://127.0.0.1:8090/api/files/excel_files/%s/%s", id, name)
+	resp, err := utils.SecureClient.Get(fileURL)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("PocketBase returned status %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// deleteBlobs removes a record's artifacts from the blob store
+func deleteBlobs(ctx context.Context, file *models.ExcelFile) {
+	for _, key := range []string{file.ImageKey, file.ProcessedKey, file.OCRKey, file.ExcelKey} {
+		if key == "" {
+			continue
+		}
+		if err := storage.Default.Delete(ctx, key); err != nil {
+			log.Printf("Error deleting blob %s: %v", key, err)
+		}
+	}
+}
+
+// DeleteFile handles file deletion
+func DeleteFile(c *gin.Context) {
+	id := c.Param("id")
+
+	fileRecord, ok := ownedFile(c, id)
+	if !ok {
 		return
 	}
 
-	// Use secure client for deletion
-	req, err := http.NewRequest("DELETE", safeURL, nil)
+	// Payments would be left pointing at nothing and drop off the account
+	payments, err := listPayments(fileRecord.User, fmt.Sprintf("invoice=%s", utils.PBQuote(fileRecord.ID)))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create delete request"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load payments"})
+		return
+	}
+	if len(payments) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Remove the payments recorded against this invoice first"})
 		return
 	}
 
-	deleteResp, err := utils.SecureClient.Do(req)
-	if err != nil {
+	// Take an approved invoice back out of stock before it disappears
+	if fileRecord.Status == models.StatusApproved {
+		if err := reverseInvoiceStock(fileRecord); err != nil {
+			reverseStockFailed(c, err)
+			return
+		}
+	}
+
+	if err := utils.PBDeleteRecord("excel_files", id); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete file"})
 		return
 	}
-	defer deleteResp.Body.Close()
+
+	// The record is gone, so failing to clean up a blob only leaks storage
+	deleteBlobs(c.Request.Context(), fileRecord)
+	if err := refreshOrderStatus(fileRecord.User, fileRecord.PurchaseOrder); err != nil {
+		log.Printf("Error updating status of purchase order %s: %v", fileRecord.PurchaseOrder, err)
+	}
 
 	c.Status(http.StatusOK)
 }
 
-// PreviewImage handles image preview
+// PreviewImage handles image preview. With ?variant=processed it shows the
+// cleaned up image that was sent to OCR instead of the original.
 func PreviewImage(c *gin.Context) {
 	id := c.Param("id")
 
-	// Validate file ID
-	if !utils.ValidateFileID(id) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file ID"})
+	fileInfo, ok := ownedFile(c, id)
+	if !ok {
 		return
 	}
 
-	session := sessions.Default(c)
-	userID := session.Get("userID")
-
-	if userID == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+	if c.Query("variant") == "processed" {
+		if fileInfo.ProcessedKey == "" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No processed image for this file"})
+			return
+		}
+		signedURL, err := storage.Default.SignedURL(c.Request.Context(), fileInfo.ProcessedKey, "", signedURLTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create preview link"})
+			return
+		}
+		c.Redirect(http.StatusFound, signedURL)
 		return
 	}
 
-	// Get the file info first
-	infoURL := fmt.Sprintf("http://127.0.0.1:8090/api/collections/excel_files/records/%s", id)
-	resp, err := utils.SecureClient.Get(infoURL)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get file info"})
+	if fileInfo.ImageKey == "" {
+		// Records created before the blob store keep the image in PocketBase
+		imageURL := fmt.Sprintf("http://127.0.0.1:8090/api/files/excel_files/%s/%s", id, fileInfo.Image)
+		c.Redirect(http.StatusFound, imageURL)
 		return
 	}
-	defer resp.Body.Close()
 
-	var fileInfo struct {
-		User  string `json:"user"`
-		Image string `json:"image"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&fileInfo); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse file info"})
+	signedURL, err := storage.Default.SignedURL(c.Request.Context(), fileInfo.ImageKey, "", signedURLTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create preview link"})
 		return
 	}
+	c.Redirect(http.StatusFound, signedURL)
+}
 
-	// Check if the file belongs to the user
-	if fileInfo.User != userID.(string) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to view this file"})
+// DownloadMultipleFiles zips the workbooks of the selected files, or renders
+// their extraction data as one file in another format. The zip is streamed
+// to the response with a manifest.json of what it holds, and errors.txt when
+// files had to be left out; ?images=1 adds the source images.
+func DownloadMultipleFiles(c *gin.Context) {
+	userID := currentUserID(c)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
 		return
 	}
 
-	// Construct the correct image URL with the filename
-	imageURL := fmt.Sprintf("http://127.0.0.1:8090/api/files/excel_files/%s/%s", id, fileInfo.Image)
-	c.Redirect(http.StatusFound, imageURL)
-}
-
-// Add this new function to handle multiple downloads
-func DownloadMultipleFiles(c *gin.Context) {
-	// Get file IDs from query parameter
-	fileIDs := c.Query("files")
-	if fileIDs == "" {
+	ids := selectionIDs(c)
+	if len(ids) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No files selected"})
 		return
 	}
-
-	// Get user session
-	session := sessions.Default(c)
-	userID := session.Get("userID")
-	if userID == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+	if len(ids) > maxSelection {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Select at most %d files", maxSelection)})
 		return
 	}
-
-	// Split file IDs
-	ids := strings.Split(fileIDs, ",")
-
-	// Create a zip file
-	tmpfile, err := os.CreateTemp("", "download-*.zip")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create temporary file"})
+	format, ok := downloadFormat(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown format"})
 		return
 	}
-	defer os.Remove(tmpfile.Name())
-
-	zipWriter := zip.NewWriter(tmpfile)
-	defer zipWriter.Close()
-
-	// Process each file
-	for _, id := range ids {
-		// Validate file ID
-		if !utils.ValidateFileID(id) {
-			continue
-		}
-
-		// Get file info
-		infoURL := fmt.Sprintf("http://127.0.0.1:8090/api/collections/excel_files/records/%s", id)
-		resp, err := utils.SecureClient.Get(infoURL)
-		if err != nil {
-			continue
-		}
-
-		var fileInfo struct {
-			User  string `json:"user"`
-			Excel string `json:"excel"`
-		}
-		if err := json.NewDecoder(resp.Body).Decode(&fileInfo); err != nil {
-			resp.Body.Close()
-			continue
-		}
-		resp.Body.Close()
-
-		// Verify ownership
-		if fileInfo.User != userID.(string) {
-			continue
-		}
 
-		// Download the file
-		fileURL := fmt.Sprintf("http://127.0.0.1:8090/api/files/excel_files/%s/%s", id, fileInfo.Excel)
-		fileResp, err := utils.SecureClient.Get(fileURL)
-		if err != nil {
-			continue
-		}
-
-		// Create file in zip
-		f, err := zipWriter.Create(fileInfo.Excel)
-		if err != nil {
-			fileResp.Body.Close()
-			continue
-		}
+	files, skipped := loadSelection(userID, ids)
+	if len(files) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No files found"})
+		return
+	}
 
-		// Copy file content to zip
-		_, err = io.Copy(f, fileResp.Body)
-		fileResp.Body.Close()
-		if err != nil {
-			continue
+	if format != formatXLSX {
+		for _, s := range skipped {
+			log.Printf("Leaving %s out of %s export: %s", s.ID, format, s.Reason)
 		}
+		sendExport(c, format, "invoices", files)
+		return
 	}
 
-	// Close the zip writer before reading
-	zipWriter.Close()
-
-	// Set headers for download
 	c.Header("Content-Type", "application/zip")
-	c.Header("Content-Disposition", "attachment; filename=excel_files.zip")
-
-	// Send the file
-	c.File(tmpfile.Name())
+	c.Header("Content-Disposition", "attachment; filename=invoices.zip")
+	c.Status(http.StatusOK)
+	if err := writeBundle(c.Request.Context(), c.Writer, files, skipped, c.Query("images") != ""); err != nil {
+		log.Printf("Error writing bulk download: %v", err)
+	}
 }
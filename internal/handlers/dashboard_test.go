@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestGroupFilesByDate(t *testing.T) {
+	type group struct {
+		Date string
+		IDs  []string
+	}
+	tests := []struct {
+		name    string
+		zone    string
+		uploads map[string]string // file ID to upload time in UTC
+		want    []group
+	}{
+		{
+			name: "Kolkata shortly after midnight lands on the local day",
+			zone: "Asia/Kolkata",
+			uploads: map[string]string{
+				"before": "2026-03-09T18:29:00Z", // 23:59 IST on 9 March
+				"after":  "2026-03-09T19:00:00Z", // 00:30 IST on 10 March
+			},
+			want: []group{
+				{"March 10, 2026", []string{"after"}},
+				{"March 9, 2026", []string{"before"}},
+			},
+		},
+		{
+			name: "Kolkata files of one day newest first",
+			zone: "Asia/Kolkata",
+			uploads: map[string]string{
+				"morning": "2026-03-10T03:30:00Z", // 09:00 IST
+				"night":   "2026-03-10T18:00:00Z", // 23:30 IST
+				"early":   "2026-03-09T19:00:00Z", // 00:30 IST
+			},
+			want: []group{
+				{"March 10, 2026", []string{"night", "morning", "early"}},
+			},
+		},
+		{
+			name: "New York around the start of daylight saving time",
+			zone: "America/New_York",
+			uploads: map[string]string{
+				"est-late":  "2026-03-08T04:30:00Z", // 23:30 EST on 7 March
+				"est-early": "2026-03-08T05:30:00Z", // 00:30 EST on 8 March
+				"edt-late":  "2026-03-09T03:30:00Z", // 23:30 EDT on 8 March
+				"edt-early": "2026-03-09T04:30:00Z", // 00:30 EDT on 9 March
+			},
+			want: []group{
+				{"March 9, 2026", []string{"edt-early"}},
+				{"March 8, 2026", []string{"edt-late", "est-early"}},
+				{"March 7, 2026", []string{"est-late"}},
+			},
+		},
+		{
+			name: "New York around the end of daylight saving time",
+			zone: "America/New_York",
+			uploads: map[string]string{
+				"edt-late":  "2026-11-01T03:30:00Z", // 23:30 EDT on 31 October
+				"edt-early": "2026-11-01T04:30:00Z", // 00:30 EDT on 1 November
+				"est-late":  "2026-11-02T04:30:00Z", // 23:30 EST on 1 November
+				"est-early": "2026-11-02T05:30:00Z", // 00:30 EST on 2 November
+			},
+			want: []group{
+				{"November 2, 2026", []string{"est-early"}},
+				{"November 1, 2026", []string{"est-late", "edt-early"}},
+				{"October 31, 2026", []string{"edt-late"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := time.LoadLocation(tt.zone)
+			if err != nil {
+				t.Fatalf("loading %s: %v", tt.zone, err)
+			}
+			var files []FileData
+			for id, uploaded := range tt.uploads {
+				created, err := time.Parse(time.RFC3339, uploaded)
+				if err != nil {
+					t.Fatalf("parsing %s: %v", uploaded, err)
+				}
+				files = append(files, FileData{ID: id, CreatedAt: created})
+			}
+
+			var got []group
+			for _, g := range groupFilesByDate(files, loc) {
+				ids := make([]string, len(g.Files))
+				for i, f := range g.Files {
+					ids[i] = f.ID
+				}
+				got = append(got, group{g.Date, ids})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("groupFilesByDate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/ashX04/new_website/internal/imageproc"
+	"github.com/ashX04/new_website/internal/models"
+	"github.com/ashX04/new_website/internal/utils"
+)
+
+// duplicateHashDistance is the largest number of differing hash bits for two
+// images to be treated as photos of the same document
+const duplicateHashDistance = 6
+
+// findDuplicate looks for an earlier record of the user that matches the new
+// one, first on the extracted invoice header and then on the image hash. It
+// returns the ID of the original and the reason, or empty strings.
+func findDuplicate(userID string, record *models.ExcelFile) (string, string, error) {
+	params := url.Values{}
+	params.Set("filter", fmt.Sprintf("(user=%s)", utils.PBQuote(userID)))
+	params.Set("fields", "id,phash,supplier_gstin,invoice_number,invoice_date,invoice_total")
+	params.Set("sort", "created")
+
+	existing, err := utils.PBListAll[models.ExcelFile]("excel_files", params)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to list existing files: %w", err)
+	}
+
+	for _, other := range existing {
+		if sameInvoice(&record.InvoiceHeader, &other.InvoiceHeader) {
+			return other.ID, fmt.Sprintf("Same supplier GSTIN, invoice number %s, date and total", record.InvoiceNumber), nil
+		}
+	}
+
+	hash, err := strconv.ParseUint(record.PHash, 16, 64)
+	if record.PHash == "" || err != nil {
+		return "", "", nil
+	}
+	for _, other := range existing {
+		otherHash, err := strconv.ParseUint(other.PHash, 16, 64)
+		if other.PHash == "" || err != nil {
+			continue
+		}
+		if imageproc.HammingDistance(hash, otherHash) <= duplicateHashDistance {
+			return other.ID, "The image looks the same as an earlier upload", nil
+		}
+	}
+
+	return "", "", nil
+}
+
+// sameInvoice compares the identifying header fields of two invoices. Both
+// need a GSTIN and invoice number, otherwise nothing is matched.
+func sameInvoice(a, b *models.InvoiceHeader) bool {
+	if a.SupplierGSTIN == "" || a.InvoiceNumber == "" {
+		return false
+	}
+	return strings.EqualFold(a.SupplierGSTIN, b.SupplierGSTIN) &&
+		normaliseReference(a.InvoiceNumber) == normaliseReference(b.InvoiceNumber) &&
+		normaliseReference(a.InvoiceDate) == normaliseReference(b.InvoiceDate) &&
+		math.Abs(a.InvoiceTotal-b.InvoiceTotal) < 1
+}
+
+// normaliseReference drops punctuation and case so that "INV/23-24/101" and
+// "inv 23 24 101" compare equal
+func normaliseReference(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(unicode.ToUpper(r))
+		}
+	}
+	return b.String()
+}
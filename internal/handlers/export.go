@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ashX04/new_website/internal/export"
+	"github.com/ashX04/new_website/internal/models"
+	"github.com/ashX04/new_website/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// Download formats. xlsx serves the stored workbooks; the others are
+// generated from the extraction data of the records.
+const (
+	formatXLSX = "xlsx"
+	formatCSV  = "csv"
+	formatJSON = "json"
+	formatODS  = "ods"
+	// formatConsolidated is one workbook with a summary sheet of the
+	// invoices and a sheet of all their line items
+	formatConsolidated = "consolidated"
+)
+
+// formatContentTypes are the media types of the generated formats
+var formatContentTypes = map[string]string{
+	formatCSV:          "text/csv; charset=utf-8",
+	formatJSON:         "application/json; charset=utf-8",
+	formatODS:          export.ODSContentType,
+	formatConsolidated: export.XLSXContentType,
+}
+
+// formatExtensions are the file extensions of the generated formats
+var formatExtensions = map[string]string{
+	formatCSV:          ".csv",
+	formatJSON:         ".json",
+	formatODS:          ".ods",
+	formatConsolidated: ".xlsx",
+}
+
+// downloadFormat reads the requested format from ?format=, or failing that
+// from the Accept header. Browsers accept anything and get the stored
+// workbook.
+func downloadFormat(c *gin.Context) (string, bool) {
+	if format := strings.ToLower(strings.TrimSpace(c.Query("format"))); format != "" {
+		if format == formatXLSX {
+			return format, true
+		}
+		_, ok := formatContentTypes[format]
+		return format, ok
+	}
+	switch c.NegotiateFormat(export.XLSXContentType, "text/csv", "application/json", export.ODSContentType) {
+	case "text/csv":
+		return formatCSV, true
+	case "application/json":
+		return formatJSON, true
+	case export.ODSContentType:
+		return formatODS, true
+	}
+	return formatXLSX, true
+}
+
+// skippedFile is a selected file left out of a download, with the reason
+type skippedFile struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+// selectionIDs splits the comma separated ?files= selection
+func selectionIDs(c *gin.Context) []string {
+	var ids []string
+	for _, id := range strings.Split(c.Query("files"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// selectionBatch is how many records are fetched per PocketBase request
+// when loading a selection
+const selectionBatch = 50
+
+// loadSelection fetches the selected records of a user, expanded with their
+// supplier, in the order given. Files that cannot be loaded are skipped with
+// the reason; records of other users are reported as not found.
+func loadSelection(userID string, ids []string) ([]*models.ExcelFile, []skippedFile) {
+	var valid []string
+	var skipped []skippedFile
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if !utils.ValidateFileID(id) {
+			skipped = append(skipped, skippedFile{ID: id, Reason: "invalid file ID"})
+			continue
+		}
+		valid = append(valid, id)
+	}
+
+	found := make(map[string]*models.ExcelFile, len(valid))
+	failed := make(map[string]bool)
+	for start := 0; start < len(valid); start += selectionBatch {
+		batch := valid[start:min(start+selectionBatch, len(valid))]
+		clauses := make([]string, len(batch))
+		for i, id := range batch {
+			clauses[i] = "id=" + utils.PBQuote(id)
+		}
+		params := url.Values{}
+		params.Set("filter", fmt.Sprintf("(user=%s && (%s))", utils.PBQuote(userID), strings.Join(clauses, " || ")))
+		params.Set("expand", "supplier")
+		records, err := utils.PBListAll[models.ExcelFile]("excel_files", params)
+		if err != nil {
+			log.Printf("Error loading selected files: %v", err)
+			for _, id := range batch {
+				failed[id] = true
+			}
+			continue
+		}
+		for i := range records {
+			found[records[i].ID] = &records[i]
+		}
+	}
+
+	files := make([]*models.ExcelFile, 0, len(found))
+	for _, id := range valid {
+		switch {
+		case found[id] != nil:
+			files = append(files, found[id])
+		case failed[id]:
+			skipped = append(skipped, skippedFile{ID: id, Reason: "failed to load record"})
+		default:
+			skipped = append(skipped, skippedFile{ID: id, Reason: "not found"})
+		}
+	}
+	return files, skipped
+}
+
+// sendExport streams invoices in a generated format, without temporary
+// files. Headers are written before the body, so failures part way are only
+// logged.
+func sendExport(c *gin.Context, format, name string, files []*models.ExcelFile) {
+	c.Header("Content-Type", formatContentTypes[format])
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s%s", name, formatExtensions[format]))
+	c.Status(http.StatusOK)
+
+	var err error
+	switch format {
+	case formatCSV:
+		err = export.WriteCSV(c.Writer, export.LineItems(files))
+	case formatJSON:
+		err = export.WriteJSON(c.Writer, files)
+	case formatODS:
+		err = export.WriteODS(c.Writer, export.Invoices(files), export.LineItems(files))
+	case formatConsolidated:
+		err = export.WriteXLSX(c.Writer, export.Invoices(files), export.LineItems(files))
+	}
+	if err != nil {
+		log.Printf("Error writing %s export %s: %v", format, name, err)
+	}
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ashX04/new_website/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// dashboardPageSize is the number of files shown per dashboard page
+const dashboardPageSize = 24
+
+// DashboardFilters holds the search and filter settings of the dashboard.
+// They round-trip through the query string so that links can be shared and
+// pagination keeps them.
+type DashboardFilters struct {
+	Query     string
+	From      string // YYYY-MM-DD
+	To        string // YYYY-MM-DD
+	Status    string
+	Supplier  string
+	MinAmount string
+	MaxAmount string
+	Page      int
+}
+
+// parseFinite reads a number typed into a form. NaN and infinities, which
+// strconv accepts, are rejected.
+func parseFinite(value string) (float64, bool) {
+	n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+		return 0, false
+	}
+	return n, true
+}
+
+// parseDashboardFilters reads the filters from the request, ignoring values
+// that do not parse
+func parseDashboardFilters(c *gin.Context) DashboardFilters {
+	f := DashboardFilters{
+		Query:    strings.TrimSpace(c.Query("q")),
+		Status:   c.Query("status"),
+		Supplier: strings.TrimSpace(c.Query("supplier")),
+		Page:     1,
+	}
+	if _, err := time.Parse("2006-01-02", c.Query("from")); err == nil {
+		f.From = c.Query("from")
+	}
+	if _, err := time.Parse("2006-01-02", c.Query("to")); err == nil {
+		f.To = c.Query("to")
+	}
+	// Amounts are written back in plain decimal form, since they go into
+	// the filter expression unquoted
+	if amount, ok := parseFinite(c.Query("min")); ok {
+		f.MinAmount = strconv.FormatFloat(amount, 'f', -1, 64)
+	}
+	if amount, ok := parseFinite(c.Query("max")); ok {
+		f.MaxAmount = strconv.FormatFloat(amount, 'f', -1, 64)
+	}
+	if page, err := strconv.Atoi(c.Query("page")); err == nil && page > 0 {
+		f.Page = page
+	}
+	return f
+}
+
+// pbFilter builds the PocketBase filter expression for a user's files. The
+// date range is read as whole days in loc.
+func (f DashboardFilters) pbFilter(userID string, loc *time.Location) string {
+	clauses := []string{fmt.Sprintf("user=%s", utils.PBQuote(userID))}
+
+	if f.Query != "" {
+		clauses = append(clauses, fmt.Sprintf("search_text~%s", utils.PBQuote(strings.ToLower(f.Query))))
+	}
+	if f.From != "" {
+		from, _ := time.ParseInLocation("2006-01-02", f.From, loc)
+		clauses = append(clauses, fmt.Sprintf("created>=%s", utils.PBQuote(utils.PBTime(from))))
+	}
+	if f.To != "" {
+		// Include the whole of the last day
+		to, _ := time.ParseInLocation("2006-01-02", f.To, loc)
+		clauses = append(clauses, fmt.Sprintf("created<%s", utils.PBQuote(utils.PBTime(to.AddDate(0, 0, 1)))))
+	}
+	switch f.Status {
+	case "duplicate":
+		clauses = append(clauses, "duplicate_of!=''")
+	case "":
+	default:
+		clauses = append(clauses, fmt.Sprintf("status=%s", utils.PBQuote(f.Status)))
+	}
+	if f.Supplier != "" {
+		clauses = append(clauses, fmt.Sprintf("(supplier_name~%[1]s || supplier.name~%[1]s)", utils.PBQuote(f.Supplier)))
+	}
+	if f.MinAmount != "" {
+		clauses = append(clauses, "invoice_total>="+f.MinAmount)
+	}
+	if f.MaxAmount != "" {
+		clauses = append(clauses, "invoice_total<="+f.MaxAmount)
+	}
+
+	return "(" + strings.Join(clauses, " && ") + ")"
+}
+
+// Values encodes the filters as query parameters, leaving out the page
+func (f DashboardFilters) Values() url.Values {
+	v := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			v.Set(key, value)
+		}
+	}
+	set("q", f.Query)
+	set("from", f.From)
+	set("to", f.To)
+	set("status", f.Status)
+	set("supplier", f.Supplier)
+	set("min", f.MinAmount)
+	set("max", f.MaxAmount)
+	return v
+}
+
+// PageURL returns the dashboard URL for another page with the same filters
+func (f DashboardFilters) PageURL(page int) string {
+	v := f.Values()
+	if page > 1 {
+		v.Set("page", strconv.Itoa(page))
+	}
+	if len(v) == 0 {
+		return "/dashboard"
+	}
+	return "/dashboard?" + v.Encode()
+}
+
+// Active reports whether any filter is set
+func (f DashboardFilters) Active() bool {
+	return len(f.Values()) > 0
+}
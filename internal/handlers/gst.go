@@ -0,0 +1,501 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ashX04/new_website/internal/export"
+	"github.com/ashX04/new_website/internal/gst"
+	"github.com/ashX04/new_website/internal/models"
+	"github.com/ashX04/new_website/internal/normalise"
+	"github.com/ashX04/new_website/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// maxGSTR2BSize caps uploaded GSTR-2B files
+const maxGSTR2BSize = 20 << 20
+
+// bookFields are the record fields the GST books need
+const bookFields = "id,created,supplier_name,supplier_gstin,invoice_number,invoice_date,lines,duplicate_of," +
+	"buyer_gstin,supplier,expand.supplier.name,expand.supplier.gstin,expand.supplier.state"
+
+// GSTAmounts are the amounts of a register row in rupees
+type GSTAmounts struct {
+	Taxable float64
+	CGST    float64
+	SGST    float64
+	IGST    float64
+	Cess    float64
+	Tax     float64
+}
+
+func gstAmounts(r gst.RateTotal) GSTAmounts {
+	return GSTAmounts{
+		Taxable: gst.Rupees(r.Taxable),
+		CGST:    gst.Rupees(r.CGST),
+		SGST:    gst.Rupees(r.SGST),
+		IGST:    gst.Rupees(r.IGST),
+		Cess:    gst.Rupees(r.Cess),
+		Tax:     gst.Rupees(r.Tax()),
+	}
+}
+
+// invoiceSupply decides whether an invoice is intra- or inter-state. The
+// supplier's state comes from its master record, if given or expanded, or
+// the GSTIN on the invoice; the buyer's from the account's GSTIN, or the
+// buyer GSTIN printed on the invoice when the account has not set one.
+func invoiceSupply(accountGSTIN string, file *models.ExcelFile, supplier *models.Supplier) gst.Supply {
+	if supplier == nil && file.Expand != nil {
+		supplier = file.Expand.Supplier
+	}
+	supplierState := gst.StateCode(file.SupplierGSTIN)
+	if supplier != nil {
+		if supplier.State != "" {
+			supplierState = supplier.State
+		} else if state := gst.StateCode(supplier.GSTIN); state != "" {
+			supplierState = state
+		}
+	}
+	buyerState := gst.StateCode(accountGSTIN)
+	if buyerState == "" {
+		buyerState = gst.StateCode(file.BuyerGSTIN)
+	}
+	return gst.SupplyBetween(supplierState, buyerState)
+}
+
+// RegisterLine is one rate of one invoice in the purchase register
+type RegisterLine struct {
+	ID       string
+	Date     string
+	Number   string
+	Supplier string
+	GSTIN    string
+	Rate     float64
+	GSTAmounts
+}
+
+// RegisterRate is the register total at one GST rate
+type RegisterRate struct {
+	Rate float64
+	GSTAmounts
+}
+
+// RegisterSupplier is the register total of one supplier
+type RegisterSupplier struct {
+	GSTIN    string
+	Supplier string
+	Invoices int
+	GSTAmounts
+}
+
+// BookProblem is an invoice left out of the books or booked on a guess
+type BookProblem struct {
+	ID     string
+	Label  string
+	Reason string
+}
+
+// purchaseBooks holds the purchase invoices of an account for GST
+type purchaseBooks struct {
+	invoices []gst.BookInvoice
+	// taxes and lines are the worked out tax and extracted lines of each
+	// booked invoice by ID
+	taxes    map[string]*gst.InvoiceTax
+	lines    map[string][]models.InvoiceLine
+	problems []BookProblem
+	// duplicates counts records left out as duplicates of earlier ones
+	duplicates int
+}
+
+// loadPurchaseBooks works out the GST of every invoice of a user. Invoices
+// flagged as duplicates are left out, as are invoices whose tax cannot be
+// worked out; an unreadable invoice date is replaced by the upload date.
+// Invoices whose tax does not fit their supply are booked as printed and
+// listed as problems.
+func loadPurchaseBooks(userID string, settings *models.Settings) (*purchaseBooks, error) {
+	loc := settings.Location()
+	params := url.Values{}
+	params.Set("filter", fmt.Sprintf("user=%s", utils.PBQuote(userID)))
+	params.Set("fields", bookFields)
+	params.Set("expand", "supplier")
+	params.Set("sort", "created")
+	files, err := utils.PBListAll[models.ExcelFile]("excel_files", params)
+	if err != nil {
+		return nil, err
+	}
+
+	books := &purchaseBooks{
+		taxes: make(map[string]*gst.InvoiceTax),
+		lines: make(map[string][]models.InvoiceLine),
+	}
+	for i := range files {
+		file := &files[i]
+		if file.DuplicateOf != "" {
+			books.duplicates++
+			continue
+		}
+		label := file.InvoiceNumber
+		if label == "" {
+			label = file.ID
+		}
+		supply := invoiceSupply(settings.GSTIN, file, nil)
+		tax, err := gst.ComputeInvoice(file.Lines, supply)
+		if err != nil {
+			books.problems = append(books.problems, BookProblem{ID: file.ID, Label: label, Reason: "Left out: " + err.Error()})
+			continue
+		}
+		for _, p := range gst.InvoiceProblems(file.Lines, supply) {
+			books.problems = append(books.problems, BookProblem{ID: file.ID, Label: label, Reason: fmt.Sprintf("%s supply: %s", supply, p)})
+		}
+
+		invoice := gst.BookInvoice{
+			ID:       file.ID,
+			GSTIN:    file.SupplierGSTIN,
+			Supplier: export.SupplierName(file),
+			Number:   file.InvoiceNumber,
+			Rates:    tax.Rates,
+		}
+		if file.Expand != nil && file.Expand.Supplier != nil && file.Expand.Supplier.GSTIN != "" {
+			invoice.GSTIN = file.Expand.Supplier.GSTIN
+		}
+		invoice.GSTIN = gst.NormaliseGSTIN(invoice.GSTIN)
+		if date, ok := normalise.Date(file.InvoiceDate); ok {
+			invoice.Date = date
+		} else if created, err := utils.ParsePBTime(file.Created); err == nil {
+			created = created.In(loc)
+			invoice.Date = time.Date(created.Year(), created.Month(), created.Day(), 0, 0, 0, 0, time.UTC)
+			books.problems = append(books.problems, BookProblem{ID: file.ID, Label: label, Reason: "Invoice date unreadable, upload date used"})
+		}
+		books.invoices = append(books.invoices, invoice)
+		books.taxes[file.ID] = tax
+		books.lines[file.ID] = file.Lines
+	}
+	return books, nil
+}
+
+// supplierKey identifies the supplier of an invoice in totals: its GSTIN,
+// or its name for suppliers without one
+func supplierKey(invoice *gst.BookInvoice) string {
+	if invoice.GSTIN != "" {
+		return invoice.GSTIN
+	}
+	return "name:" + strings.ToLower(strings.Join(strings.Fields(invoice.Supplier), " "))
+}
+
+// parseMonth reads a YYYY-MM month as its first day, at midnight UTC like
+// invoice dates, defaulting to the current month in loc
+func parseMonth(value string, loc *time.Location) time.Time {
+	if t, err := time.Parse("2006-01", value); err == nil {
+		return t
+	}
+	now := time.Now().In(loc)
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// inMonth reports whether date falls in the month starting at month
+func inMonth(date, month time.Time) bool {
+	return !date.Before(month) && date.Before(month.AddDate(0, 1, 0))
+}
+
+// ShowPurchaseRegister renders the purchase register of a month, given as
+// ?month=YYYY-MM: the taxable value and tax of every invoice by rate, with
+// totals by rate and by supplier. ?format=csv downloads the invoice rows.
+func ShowPurchaseRegister(c *gin.Context) {
+	userID := currentUserID(c)
+	settings, err := loadSettings(userID)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "gst_register.html", gin.H{
+			"error": "Failed to load settings",
+		})
+		return
+	}
+	month := parseMonth(c.Query("month"), settings.Location())
+
+	books, err := loadPurchaseBooks(userID, settings)
+	if err != nil {
+		log.Printf("Error loading purchase books: %v", err)
+		c.HTML(http.StatusInternalServerError, "gst_register.html", gin.H{
+			"error": "Failed to load invoices",
+		})
+		return
+	}
+
+	var lines []RegisterLine
+	var total gst.RateTotal
+	rates := make(map[int64]*gst.RateTotal)
+	suppliers := make(map[string]*RegisterSupplier)
+	supplierTotals := make(map[string]*gst.RateTotal)
+	var supplierOrder []string
+	inPeriod := make(map[string]bool)
+	for _, invoice := range books.invoices {
+		if !inMonth(invoice.Date, month) {
+			continue
+		}
+		inPeriod[invoice.ID] = true
+
+		key := supplierKey(&invoice)
+		if suppliers[key] == nil {
+			suppliers[key] = &RegisterSupplier{GSTIN: invoice.GSTIN, Supplier: invoice.Supplier}
+			supplierTotals[key] = &gst.RateTotal{}
+			supplierOrder = append(supplierOrder, key)
+		}
+		suppliers[key].Invoices++
+
+		for _, r := range invoice.Rates {
+			lines = append(lines, RegisterLine{
+				ID:         invoice.ID,
+				Date:       invoice.Date.Format("02-01-2006"),
+				Number:     invoice.Number,
+				Supplier:   invoice.Supplier,
+				GSTIN:      invoice.GSTIN,
+				Rate:       gst.Percent(r.Rate),
+				GSTAmounts: gstAmounts(r),
+			})
+			if rates[r.Rate] == nil {
+				rates[r.Rate] = &gst.RateTotal{Rate: r.Rate}
+			}
+			rates[r.Rate].Add(r)
+			supplierTotals[key].Add(r)
+			total.Add(r)
+		}
+	}
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].Date < lines[j].Date })
+
+	if c.Query("format") == formatCSV {
+		sendRegisterCSV(c, month, lines)
+		return
+	}
+
+	rateViews := make([]RegisterRate, 0, len(rates))
+	for _, r := range rates {
+		rateViews = append(rateViews, RegisterRate{Rate: gst.Percent(r.Rate), GSTAmounts: gstAmounts(*r)})
+	}
+	sort.Slice(rateViews, func(i, j int) bool { return rateViews[i].Rate < rateViews[j].Rate })
+	supplierViews := make([]RegisterSupplier, 0, len(supplierOrder))
+	for _, key := range supplierOrder {
+		s := suppliers[key]
+		s.GSTAmounts = gstAmounts(*supplierTotals[key])
+		supplierViews = append(supplierViews, *s)
+	}
+	sort.SliceStable(supplierViews, func(i, j int) bool { return supplierViews[i].Taxable > supplierViews[j].Taxable })
+
+	// Date fallbacks only matter for the month they landed in
+	var problems []BookProblem
+	for _, p := range books.problems {
+		if inPeriod[p.ID] || strings.HasPrefix(p.Reason, "Left out") {
+			problems = append(problems, p)
+		}
+	}
+
+	c.HTML(http.StatusOK, "gst_register.html", gin.H{
+		"Month":      month.Format("2006-01"),
+		"MonthName":  month.Format("January 2006"),
+		"Prev":       month.AddDate(0, -1, 0).Format("2006-01"),
+		"Next":       month.AddDate(0, 1, 0).Format("2006-01"),
+		"Lines":      lines,
+		"Rates":      rateViews,
+		"Suppliers":  supplierViews,
+		"Total":      gstAmounts(total),
+		"Problems":   problems,
+		"Duplicates": books.duplicates,
+	})
+}
+
+// sendRegisterCSV downloads the register rows of a month
+func sendRegisterCSV(c *gin.Context, month time.Time, lines []RegisterLine) {
+	table := &export.Table{
+		Name: "Purchase Register",
+		Columns: []export.Column{
+			{Field: "invoice_date", Name: "Invoice Date"},
+			{Field: "invoice_number", Name: "Invoice Number"},
+			{Field: "supplier_name", Name: "Supplier"},
+			{Field: "supplier_gstin", Name: "Supplier GSTIN"},
+			{Field: "gst_rate", Name: "GST Rate", Kind: normalise.KindNumber},
+			{Field: "taxable", Name: "Taxable Value", Kind: normalise.KindAmount},
+			{Field: "cgst", Name: "CGST", Kind: normalise.KindAmount},
+			{Field: "sgst", Name: "SGST", Kind: normalise.KindAmount},
+			{Field: "igst", Name: "IGST", Kind: normalise.KindAmount},
+			{Field: "cess", Name: "Cess", Kind: normalise.KindAmount},
+			{Field: "record_id", Name: "Record ID"},
+		},
+	}
+	for _, l := range lines {
+		table.Rows = append(table.Rows, []string{
+			l.Date, l.Number, l.Supplier, l.GSTIN, fmt.Sprintf("%g", l.Rate),
+			fmt.Sprintf("%.2f", l.Taxable), fmt.Sprintf("%.2f", l.CGST),
+			fmt.Sprintf("%.2f", l.SGST), fmt.Sprintf("%.2f", l.IGST), fmt.Sprintf("%.2f", l.Cess), l.ID,
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := export.WriteCSV(&buf, table); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write register"})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=purchase_register_%s.csv", month.Format("2006-01")))
+	c.Data(http.StatusOK, formatContentTypes[formatCSV], buf.Bytes())
+}
+
+// ReconRowView is one invoice of a GSTR-2B reconciliation
+type ReconRowView struct {
+	Status      string
+	Label       string
+	Badge       string
+	Supplier    string
+	GSTIN       string
+	Number      string
+	Date        string
+	BookID      string
+	InPortal    bool
+	InBooks     bool
+	PortalTotal GSTAmounts
+	BookTotal   GSTAmounts
+	Differences []string
+}
+
+// reconLabels are the headings and badge classes of reconciliation statuses
+var reconLabels = map[gst.ReconStatus][2]string{
+	gst.ReconMatched:    {"Matched", "success"},
+	gst.ReconMismatched: {"Mismatched", "warning"},
+	gst.ReconMissing:    {"Missing in books", "error"},
+	gst.ReconExtra:      {"Not in GSTR-2B", "warning"},
+}
+
+func reconRowView(row gst.ReconRow) ReconRowView {
+	view := ReconRowView{
+		Status:      string(row.Status),
+		Label:       reconLabels[row.Status][0],
+		Badge:       reconLabels[row.Status][1],
+		Differences: row.Differences,
+	}
+	if p := row.Portal; p != nil {
+		view.InPortal = true
+		view.Supplier, view.GSTIN, view.Number = p.Supplier, p.GSTIN, p.Number
+		if !p.Date.IsZero() {
+			view.Date = p.Date.Format("02-01-2006")
+		}
+		view.PortalTotal = gstAmounts(gst.RateTotal{Taxable: p.Taxable, CGST: p.CGST, SGST: p.SGST, IGST: p.IGST, Cess: p.Cess})
+	}
+	if b := row.Book; b != nil {
+		view.InBooks = true
+		view.BookID = b.ID
+		view.BookTotal = gstAmounts(b.Total())
+		// The supplier's own name and number are shown where the books have them
+		if b.Supplier != "" {
+			view.Supplier = b.Supplier
+		}
+		if view.GSTIN == "" {
+			view.GSTIN = b.GSTIN
+		}
+		if b.Number != "" {
+			view.Number = b.Number
+		}
+		if view.Date == "" && !b.Date.IsZero() {
+			view.Date = b.Date.Format("02-01-2006")
+		}
+	}
+	return view
+}
+
+// ShowReconcile renders the GSTR-2B upload form
+func ShowReconcile(c *gin.Context) {
+	c.HTML(http.StatusOK, "gst_reconcile.html", gin.H{})
+}
+
+// ReconcileGSTR2B matches an uploaded GSTR-2B JSON against the processed
+// invoices. The return is only read, not stored. The return period comes from
+// the file unless a month is chosen on the form.
+func ReconcileGSTR2B(c *gin.Context) {
+	userID := currentUserID(c)
+	settings, err := loadSettings(userID)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "gst_reconcile.html", gin.H{
+			"error": "Failed to load settings",
+		})
+		return
+	}
+
+	header, err := c.FormFile("gstr2b")
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "gst_reconcile.html", gin.H{
+			"error": "Choose a GSTR-2B JSON file",
+		})
+		return
+	}
+	if header.Size > maxGSTR2BSize {
+		c.HTML(http.StatusBadRequest, "gst_reconcile.html", gin.H{
+			"error": fmt.Sprintf("GSTR-2B files may be at most %d MB", maxGSTR2BSize>>20),
+		})
+		return
+	}
+	f, err := header.Open()
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "gst_reconcile.html", gin.H{
+			"error": "Failed to read the uploaded file",
+		})
+		return
+	}
+	defer f.Close()
+	ret, err := gst.ParseGSTR2B(f)
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "gst_reconcile.html", gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Every invoice would show as missing or extra against another
+	// registration's return
+	if ret.GSTIN != "" && settings.GSTIN != "" && ret.GSTIN != settings.GSTIN {
+		c.HTML(http.StatusBadRequest, "gst_reconcile.html", gin.H{
+			"error": fmt.Sprintf("The file is the GSTR-2B of %s, but your GSTIN is %s", ret.GSTIN, settings.GSTIN),
+		})
+		return
+	}
+
+	period := ret.Period
+	if month := c.PostForm("month"); month != "" {
+		period = parseMonth(month, settings.Location())
+	}
+	if period.IsZero() {
+		c.HTML(http.StatusBadRequest, "gst_reconcile.html", gin.H{
+			"error": "The file has no return period; choose the month it covers",
+		})
+		return
+	}
+
+	books, err := loadPurchaseBooks(userID, settings)
+	if err != nil {
+		log.Printf("Error loading purchase books: %v", err)
+		c.HTML(http.StatusInternalServerError, "gst_reconcile.html", gin.H{
+			"error": "Failed to load invoices",
+		})
+		return
+	}
+
+	rows := gst.Reconcile(ret.Invoices, books.invoices, period, period.AddDate(0, 1, 0))
+	views := make([]ReconRowView, len(rows))
+	counts := make(map[string]int)
+	for i, row := range rows {
+		views[i] = reconRowView(row)
+		counts[string(row.Status)]++
+	}
+
+	c.HTML(http.StatusOK, "gst_reconcile.html", gin.H{
+		"Rows":       views,
+		"Counts":     counts,
+		"GSTIN":      ret.GSTIN,
+		"MonthName":  period.Format("January 2006"),
+		"Month":      period.Format("2006-01"),
+		"FileName":   header.Filename,
+		"Portal":     len(ret.Invoices),
+		"Problems":   books.problems,
+		"Duplicates": books.duplicates,
+	})
+}
@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/ashX04/new_website/internal/inventory"
+	"github.com/ashX04/new_website/internal/models"
+	"github.com/ashX04/new_website/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// BalanceView is the stock of a batch together with its product name
+type BalanceView struct {
+	inventory.Balance
+	ProductName string
+}
+
+// MovementView is a ledger entry together with its product name and time
+// in the user's zone
+type MovementView struct {
+	models.StockMovement
+	ProductName string
+	When        string
+}
+
+// listMovements returns the user's ledger entries matching the extra filter
+// clauses, oldest first
+func listMovements(userID string, clauses ...string) ([]models.StockMovement, error) {
+	clauses = append([]string{fmt.Sprintf("user=%s", utils.PBQuote(userID))}, clauses...)
+	params := url.Values{}
+	params.Set("filter", "("+strings.Join(clauses, " && ")+")")
+	params.Set("sort", "created")
+	return utils.PBListAll[models.StockMovement]("stock_movements", params)
+}
+
+// stockLocks serialises the handlers that check a user's stock before taking
+// it out, so that two requests cannot both sell or write off the same batch.
+// Sales invoice numbering is taken under the same lock.
+var stockLocks = struct {
+	sync.Mutex
+	users map[string]*sync.Mutex
+}{users: make(map[string]*sync.Mutex)}
+
+// lockStock takes the stock lock of a user and returns its release
+func lockStock(userID string) func() {
+	stockLocks.Lock()
+	mu, ok := stockLocks.users[userID]
+	if !ok {
+		mu = &sync.Mutex{}
+		stockLocks.users[userID] = mu
+	}
+	stockLocks.Unlock()
+	mu.Lock()
+	return mu.Unlock
+}
+
+// postMovements writes movements to the ledger. If one fails, those already
+// written are removed again so that an invoice is posted whole or not at all.
+func postMovements(movements []models.StockMovement) error {
+	var posted []string
+	for _, m := range movements {
+		var created models.StockMovement
+		if err := utils.PBCreateRecord("stock_movements", m, &created); err != nil {
+			for _, id := range posted {
+				if err := utils.PBDeleteRecord("stock_movements", id); err != nil {
+					log.Printf("Error rolling back stock movement %s: %v", id, err)
+				}
+			}
+			return err
+		}
+		posted = append(posted, created.ID)
+	}
+	return nil
+}
+
+// reverseInvoiceStock posts movements cancelling whatever an invoice still
+// contributes to stock. It fails with an inventory.ShortBatchesError when
+// part of that stock has since been sold or written off.
+func reverseInvoiceStock(file *models.ExcelFile) error {
+	defer lockStock(file.User)()
+	movements, err := listMovements(file.User)
+	if err != nil {
+		return err
+	}
+	var posted []models.StockMovement
+	for _, m := range movements {
+		if m.Invoice == file.ID {
+			posted = append(posted, m)
+		}
+	}
+	reversals := inventory.Reversals(file, posted)
+	if err := inventory.CheckStock(inventory.Balances(movements), reversals); err != nil {
+		return err
+	}
+	return postMovements(reversals)
+}
+
+// reverseStockFailed writes the response for a failed reverseInvoiceStock
+func reverseStockFailed(c *gin.Context, err error) {
+	var short *inventory.ShortBatchesError
+	if errors.As(err, &short) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Stock received on this invoice has since gone out: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reverse stock movements"})
+}
+
+// ApproveInvoice posts a processed invoice to inventory as stock-in
+// movements per product batch
+func ApproveInvoice(c *gin.Context) {
+	file, ok := ownedFile(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if file.Status == models.StatusApproved {
+		c.JSON(http.StatusConflict, gin.H{"error": "Invoice is already approved"})
+		return
+	}
+
+	movements, err := inventory.PurchaseMovements(file)
+	var unlinked *inventory.UnlinkedLinesError
+	if errors.As(err, &unlinked) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Link or review every line before approving: " + err.Error()})
+		return
+	}
+	if err := postMovements(movements); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to post stock movements"})
+		return
+	}
+
+	if err := utils.PBUpdateRecord("excel_files", file.ID, map[string]interface{}{
+		"status": models.StatusApproved,
+	}, nil); err != nil {
+		// Keep the ledger consistent with the invoice status
+		if err := reverseInvoiceStock(file); err != nil {
+			log.Printf("Error reversing stock of invoice %s: %v", file.ID, err)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve invoice"})
+		return
+	}
+	if err := refreshOrderStatus(file.User, file.PurchaseOrder); err != nil {
+		log.Printf("Error updating status of purchase order %s: %v", file.PurchaseOrder, err)
+	}
+
+	c.Redirect(http.StatusSeeOther, "/invoices/"+file.ID)
+}
+
+// ReverseInvoice takes an approved invoice back out of inventory and returns
+// it to review
+func ReverseInvoice(c *gin.Context) {
+	file, ok := ownedFile(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if file.Status != models.StatusApproved {
+		c.JSON(http.StatusConflict, gin.H{"error": "Invoice is not approved"})
+		return
+	}
+
+	if err := reverseInvoiceStock(file); err != nil {
+		reverseStockFailed(c, err)
+		return
+	}
+	if err := utils.PBUpdateRecord("excel_files", file.ID, map[string]interface{}{
+		"status": models.StatusProcessed,
+	}, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update invoice"})
+		return
+	}
+	if err := refreshOrderStatus(file.User, file.PurchaseOrder); err != nil {
+		log.Printf("Error updating status of purchase order %s: %v", file.PurchaseOrder, err)
+	}
+
+	c.Redirect(http.StatusSeeOther, "/invoices/"+file.ID)
+}
+
+// productNames maps the IDs of the user's products to their names
+func productNames(products []models.Product) map[string]string {
+	names := make(map[string]string, len(products))
+	for _, p := range products {
+		names[p.ID] = p.Name
+	}
+	return names
+}
+
+// ShowInventory renders current stock per product batch. Batches that are
+// used up are hidden unless ?all=1 is given; ?product=<id> narrows the list.
+func ShowInventory(c *gin.Context) {
+	userID := currentUserID(c)
+
+	products, err := listProducts(userID)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "inventory.html", gin.H{
+			"error": "Failed to load products",
+		})
+		return
+	}
+	var clauses []string
+	product := c.Query("product")
+	if product != "" {
+		clauses = append(clauses, fmt.Sprintf("product=%s", utils.PBQuote(product)))
+	}
+	movements, err := listMovements(userID, clauses...)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "inventory.html", gin.H{
+			"error": "Failed to load stock",
+		})
+		return
+	}
+
+	names := productNames(products)
+	showAll := c.Query("all") == "1"
+	var balances []BalanceView
+	for _, b := range inventory.Balances(movements) {
+		if b.Quantity == 0 && !showAll {
+			continue
+		}
+		balances = append(balances, BalanceView{Balance: b, ProductName: names[b.Product]})
+	}
+
+	c.HTML(http.StatusOK, "inventory.html", gin.H{
+		"Balances": balances,
+		"Products": products,
+		"Product":  product,
+		"ShowAll":  showAll,
+	})
+}
+
+// ShowLedger renders the movement ledger, newest first, optionally narrowed
+// to one product and batch
+func ShowLedger(c *gin.Context) {
+	userID := currentUserID(c)
+	loc := userLocation(userID)
+
+	products, err := listProducts(userID)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "ledger.html", gin.H{
+			"error": "Failed to load products",
+		})
+		return
+	}
+	var clauses []string
+	if product := c.Query("product"); product != "" {
+		clauses = append(clauses, fmt.Sprintf("product=%s", utils.PBQuote(product)))
+	}
+	if batch := inventory.NormaliseBatch(c.Query("batch")); batch != "" {
+		clauses = append(clauses, fmt.Sprintf("batch=%s", utils.PBQuote(batch)))
+	}
+	movements, err := listMovements(userID, clauses...)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "ledger.html", gin.H{
+			"error": "Failed to load ledger",
+		})
+		return
+	}
+
+	names := productNames(products)
+	views := make([]MovementView, 0, len(movements))
+	for i := len(movements) - 1; i >= 0; i-- {
+		m := movements[i]
+		view := MovementView{StockMovement: m, ProductName: names[m.Product]}
+		if t, err := utils.ParsePBTime(m.Created); err == nil {
+			view.When = t.In(loc).Format("2006-01-02 15:04")
+		}
+		views = append(views, view)
+	}
+
+	c.HTML(http.StatusOK, "ledger.html", gin.H{
+		"Movements": views,
+		"Product":   names[c.Query("product")],
+		"Batch":     c.Query("batch"),
+	})
+}
+
+// RecordMovement books a manual adjustment or stock-out. Adjustments carry
+// their own sign; stock-outs are entered as positive quantities and may not
+// take a batch below zero.
+func RecordMovement(c *gin.Context) {
+	userID := currentUserID(c)
+
+	product, err := ownedProduct(userID, c.PostForm("product_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Product not found"})
+		return
+	}
+	quantity, ok := parseFinite(c.PostForm("quantity"))
+	if !ok || quantity == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Enter a quantity"})
+		return
+	}
+
+	movement := models.StockMovement{
+		User:     userID,
+		Product:  product.ID,
+		Batch:    inventory.NormaliseBatch(c.PostForm("batch")),
+		Expiry:   strings.TrimSpace(c.PostForm("expiry")),
+		Quantity: quantity,
+		Kind:     c.PostForm("kind"),
+		Note:     strings.TrimSpace(c.PostForm("note")),
+	}
+
+	switch movement.Kind {
+	case models.MovementAdjustment:
+	case models.MovementStockOut:
+		if quantity < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Enter stock-out quantities as positive numbers"})
+			return
+		}
+		movement.Quantity = -quantity
+
+		defer lockStock(userID)()
+		existing, err := listMovements(userID,
+			fmt.Sprintf("product=%s", utils.PBQuote(product.ID)),
+			fmt.Sprintf("batch=%s", utils.PBQuote(movement.Batch)))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load stock"})
+			return
+		}
+		onHand := 0.0
+		for _, b := range inventory.Balances(existing) {
+			onHand += b.Quantity
+		}
+		if quantity > onHand {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Only %g in stock for this batch", onHand)})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid movement type"})
+		return
+	}
+
+	if err := utils.PBCreateRecord("stock_movements", movement, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record movement"})
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, "/inventory")
+}
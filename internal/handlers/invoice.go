@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/ashX04/new_website/internal/catalog"
+	"github.com/ashX04/new_website/internal/gst"
+	"github.com/ashX04/new_website/internal/models"
+	"github.com/ashX04/new_website/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// InvoiceLineView is an extracted line together with its product match
+type InvoiceLineView struct {
+	Index int
+	models.InvoiceLine
+	MatchedName string
+	ScorePct    int
+}
+
+// ShowInvoice renders the review page of a processed invoice: the extracted
+// header and lines, and the product each line is linked to
+func ShowInvoice(c *gin.Context) {
+	file, ok := ownedFile(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	products, err := listProducts(file.User)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "invoice.html", gin.H{
+			"error": "Failed to load products",
+		})
+		return
+	}
+	names := productNames(products)
+
+	suppliers, err := listSuppliers(file.User)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "invoice.html", gin.H{
+			"error": "Failed to load suppliers",
+		})
+		return
+	}
+	var supplier *models.Supplier
+	for i := range suppliers {
+		if suppliers[i].ID == file.Supplier {
+			supplier = &suppliers[i]
+		}
+	}
+
+	settings, err := loadSettings(file.User)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "invoice.html", gin.H{
+			"error": "Failed to load settings",
+		})
+		return
+	}
+	supply := invoiceSupply(settings.GSTIN, file, supplier)
+
+	order, match, orderChoices, err := invoiceOrder(file, names)
+	if err != nil {
+		log.Printf("Error matching invoice %s to its purchase order: %v", file.ID, err)
+	}
+
+	lines := make([]InvoiceLineView, len(file.Lines))
+	for i, line := range file.Lines {
+		lines[i] = InvoiceLineView{
+			Index:       i,
+			InvoiceLine: line,
+			MatchedName: names[line.ProductID],
+			ScorePct:    int(line.MatchScore * 100),
+		}
+	}
+
+	c.HTML(http.StatusOK, "invoice.html", gin.H{
+		"File":      file,
+		"Lines":     lines,
+		"Products":  products,
+		"Suppliers": suppliers,
+		"Supplier":  supplier,
+		"Supply":    supply.String(),
+		"Known":     supply != gst.SupplyUnknown,
+		"Problems":  gst.InvoiceProblems(file.Lines, supply),
+		"Order":     order,
+		"Match":     match,
+		"Orders":    orderChoices,
+	})
+}
+
+// ConfirmMatch links an invoice line to the product picked by the reviewer.
+// The extracted name is learned as an alias of the product so that future
+// invoices match it directly.
+func ConfirmMatch(c *gin.Context) {
+	file, ok := ownedFile(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	// Stock was posted against the current links when the invoice was approved
+	if file.Status == models.StatusApproved {
+		c.JSON(http.StatusConflict, gin.H{"error": "Reverse the invoice before changing its product links"})
+		return
+	}
+
+	index, err := strconv.Atoi(c.Param("line"))
+	if err != nil || index < 0 || index >= len(file.Lines) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid line"})
+		return
+	}
+	line := &file.Lines[index]
+
+	productID := c.PostForm("product_id")
+	if productID == "" {
+		// Clearing the link marks the line as reviewed with no product
+		line.ProductID = ""
+		line.MatchScore = 0
+		line.MatchConfirmed = true
+	} else {
+		product, err := ownedProduct(file.User, productID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Product not found"})
+			return
+		}
+
+		line.ProductID = product.ID
+		line.MatchScore = 1
+		line.MatchConfirmed = true
+
+		if !catalog.HasAlias(product, line.ProductName) {
+			product.Aliases = append(product.Aliases, line.ProductName)
+			if err := utils.PBUpdateRecord("products", product.ID, map[string]interface{}{
+				"aliases": product.Aliases,
+			}, nil); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to learn product alias"})
+				return
+			}
+		}
+	}
+
+	if err := utils.PBUpdateRecord("excel_files", file.ID, map[string]interface{}{
+		"lines": file.Lines,
+	}, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save match"})
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/invoices/%s#line-%d", file.ID, index))
+}
+
+// RematchInvoice runs the matcher again over the unconfirmed lines of an
+// invoice, picking up products added to the master since it was processed
+func RematchInvoice(c *gin.Context) {
+	file, ok := ownedFile(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	// Stock was posted against the current links when the invoice was approved
+	if file.Status == models.StatusApproved {
+		c.JSON(http.StatusConflict, gin.H{"error": "Reverse the invoice before changing its product links"})
+		return
+	}
+
+	products, err := listProducts(file.User)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load products"})
+		return
+	}
+	matchLines(file.Lines, products)
+
+	if err := utils.PBUpdateRecord("excel_files", file.ID, map[string]interface{}{
+		"lines": file.Lines,
+	}, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save matches"})
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, "/invoices/"+file.ID)
+}
+
+// matchNewLines links freshly extracted lines to the user's product master.
+// Failing to load the master is not fatal: lines stay unlinked.
+func matchNewLines(userID string, lines []models.InvoiceLine) {
+	products, err := listProducts(userID)
+	if err != nil {
+		log.Printf("Error loading products for matching: %v", err)
+		return
+	}
+	matchLines(lines, products)
+}
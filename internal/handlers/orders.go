@@ -0,0 +1,458 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ashX04/new_website/internal/models"
+	"github.com/ashX04/new_website/internal/normalise"
+	"github.com/ashX04/new_website/internal/orders"
+	"github.com/ashX04/new_website/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// orderFormRows is the least number of line rows the order form offers
+const orderFormRows = 8
+
+// OrderView is a purchase order in the list of orders
+type OrderView struct {
+	models.PurchaseOrder
+	SupplierName string
+	StatusLabel  string
+	Value        float64
+}
+
+// OrderLineView is an ordered product with what has been received of it
+type OrderLineView struct {
+	models.OrderLine
+	Received    float64
+	Outstanding float64
+}
+
+// OrderInvoiceView is an invoice delivered against an order, with its
+// variances
+type OrderInvoiceView struct {
+	ID       string
+	Number   string
+	Date     string
+	Approved bool
+	Problems []string
+}
+
+// listOrders returns the user's purchase orders matching the extra filter
+// clauses, newest first
+func listOrders(userID string, clauses ...string) ([]models.PurchaseOrder, error) {
+	clauses = append([]string{fmt.Sprintf("user=%s", utils.PBQuote(userID))}, clauses...)
+	params := url.Values{}
+	params.Set("filter", "("+strings.Join(clauses, " && ")+")")
+	params.Set("sort", "-date,-created")
+	return utils.PBListAll[models.PurchaseOrder]("purchase_orders", params)
+}
+
+// ownedOrder fetches a purchase order and checks that it belongs to userID
+func ownedOrder(userID, id string) (*models.PurchaseOrder, error) {
+	var order models.PurchaseOrder
+	if err := utils.PBGetRecord("purchase_orders", id, &order); err != nil {
+		return nil, err
+	}
+	if order.User != userID {
+		return nil, utils.ErrRecordNotFound
+	}
+	return &order, nil
+}
+
+// orderInvoices returns the invoices delivered against an order, oldest
+// first
+func orderInvoices(userID, orderID string) ([]models.ExcelFile, error) {
+	params := url.Values{}
+	params.Set("filter", fmt.Sprintf("(user=%s && purchase_order=%s)", utils.PBQuote(userID), utils.PBQuote(orderID)))
+	params.Set("sort", "created")
+	return utils.PBListAll[models.ExcelFile]("excel_files", params)
+}
+
+// refreshOrderStatus recomputes an order's status from the approved invoices
+// delivered against it
+func refreshOrderStatus(userID, orderID string) error {
+	if orderID == "" {
+		return nil
+	}
+	order, err := ownedOrder(userID, orderID)
+	if err != nil {
+		return err
+	}
+	invoices, err := orderInvoices(userID, orderID)
+	if err != nil {
+		return err
+	}
+	status := orders.Status(order, orders.Received(invoices, ""))
+	if status == order.Status {
+		return nil
+	}
+	return utils.PBUpdateRecord("purchase_orders", order.ID, map[string]interface{}{
+		"status": status,
+	}, nil)
+}
+
+// pickOrder finds the open purchase order a newly processed invoice most
+// likely delivers against. Failures are logged and leave the invoice
+// unmatched.
+func pickOrder(userID string, file *models.ExcelFile) string {
+	if file.Supplier == "" {
+		return ""
+	}
+	candidates, err := listOrders(userID,
+		fmt.Sprintf("supplier=%s", utils.PBQuote(file.Supplier)),
+		fmt.Sprintf("status!=%s", utils.PBQuote(models.OrderClosed)))
+	if err != nil {
+		log.Printf("Error listing purchase orders: %v", err)
+		return ""
+	}
+	if order := orders.Pick(candidates, file); order != nil {
+		return order.ID
+	}
+	return ""
+}
+
+// invoiceOrder compares an invoice with the order it is linked to, and
+// lists the orders it could be linked to instead
+func invoiceOrder(file *models.ExcelFile, names map[string]string) (*models.PurchaseOrder, *orders.Match, []models.PurchaseOrder, error) {
+	var choices []models.PurchaseOrder
+	if file.Supplier != "" {
+		var err error
+		choices, err = listOrders(file.User, fmt.Sprintf("supplier=%s", utils.PBQuote(file.Supplier)))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if file.PurchaseOrder == "" {
+		return nil, nil, choices, nil
+	}
+	order, err := ownedOrder(file.User, file.PurchaseOrder)
+	if err != nil {
+		return nil, nil, choices, err
+	}
+	invoices, err := orderInvoices(file.User, order.ID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	match := orders.MatchInvoice(order, orders.Received(invoices, file.ID), withProductNames(file.Lines, names))
+	return order, match, choices, nil
+}
+
+// withProductNames copies invoice lines with linked lines named after the
+// product master, so that variances name products the way orders do
+func withProductNames(lines []models.InvoiceLine, names map[string]string) []models.InvoiceLine {
+	named := append([]models.InvoiceLine(nil), lines...)
+	for i := range named {
+		if name := names[named[i].ProductID]; name != "" {
+			named[i].ProductName = name
+		}
+	}
+	return named
+}
+
+// nextOrderNumber numbers a new order after the user's existing ones:
+// PO-0001, PO-0002 and so on
+func nextOrderNumber(existing []models.PurchaseOrder) string {
+	taken := make(map[string]bool)
+	for _, o := range existing {
+		taken[o.Number] = true
+	}
+	for n := len(existing) + 1; ; n++ {
+		if number := fmt.Sprintf("PO-%04d", n); !taken[number] {
+			return number
+		}
+	}
+}
+
+// ShowOrders lists the user's purchase orders with the order form. With
+// ?edit=<id> the form is filled in for that order.
+func ShowOrders(c *gin.Context) {
+	userID := currentUserID(c)
+
+	list, err := listOrders(userID)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "orders.html", gin.H{
+			"error": "Failed to load purchase orders",
+		})
+		return
+	}
+	suppliers, err := listSuppliers(userID)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "orders.html", gin.H{
+			"error": "Failed to load suppliers",
+		})
+		return
+	}
+	products, err := listProducts(userID)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "orders.html", gin.H{
+			"error": "Failed to load products",
+		})
+		return
+	}
+	supplierNames := make(map[string]string)
+	for _, s := range suppliers {
+		supplierNames[s.ID] = s.Name
+	}
+
+	views := make([]OrderView, len(list))
+	for i, o := range list {
+		views[i] = OrderView{
+			PurchaseOrder: o,
+			SupplierName:  supplierNames[o.Supplier],
+			StatusLabel:   orders.StatusLabel(o.Status),
+		}
+		for _, l := range o.Lines {
+			views[i].Value += l.Quantity * l.Rate
+		}
+	}
+
+	edit := &models.PurchaseOrder{Date: time.Now().In(userLocation(userID)).Format("2006-01-02")}
+	if id := c.Query("edit"); id != "" {
+		if o, err := ownedOrder(userID, id); err == nil {
+			edit = o
+		}
+	}
+	rows := append([]models.OrderLine(nil), edit.Lines...)
+	for len(rows) < max(orderFormRows, len(edit.Lines)+2) {
+		rows = append(rows, models.OrderLine{})
+	}
+
+	c.HTML(http.StatusOK, "orders.html", gin.H{
+		"Orders":    views,
+		"Edit":      edit,
+		"Rows":      rows,
+		"Suppliers": suppliers,
+		"Products":  products,
+	})
+}
+
+// SaveOrder creates a purchase order, or updates it when the form carries
+// an ID. Lines come as parallel product, quantity and rate fields; rows
+// without a product are ignored.
+func SaveOrder(c *gin.Context) {
+	userID := currentUserID(c)
+
+	order := &models.PurchaseOrder{User: userID, Status: models.OrderOpen}
+	if id := c.PostForm("id"); id != "" {
+		existing, err := ownedOrder(userID, id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Purchase order not found"})
+			return
+		}
+		order = existing
+	}
+
+	order.Supplier = c.PostForm("supplier_id")
+	if _, err := ownedSupplier(userID, order.Supplier); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Choose a supplier"})
+		return
+	}
+	date, ok := normalise.Date(c.PostForm("date"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Enter the order date"})
+		return
+	}
+	order.Date = date.Format("2006-01-02")
+	order.Note = strings.TrimSpace(c.PostForm("note"))
+
+	products, err := listProducts(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load products"})
+		return
+	}
+	names := productNames(products)
+
+	productIDs := c.PostFormArray("product")
+	quantities := c.PostFormArray("quantity")
+	rates := c.PostFormArray("rate")
+	order.Lines = nil
+	seen := make(map[string]bool)
+	for i, productID := range productIDs {
+		if productID == "" {
+			continue
+		}
+		if names[productID] == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Product not found"})
+			return
+		}
+		if seen[productID] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": names[productID] + " is on the order twice"})
+			return
+		}
+		seen[productID] = true
+		line := models.OrderLine{Product: productID, ProductName: names[productID]}
+		quantityOK, rateOK := false, false
+		if i < len(quantities) {
+			line.Quantity, quantityOK = parseFinite(quantities[i])
+		}
+		if i < len(rates) {
+			line.Rate, rateOK = parseFinite(rates[i])
+		}
+		if !quantityOK || !rateOK || line.Quantity <= 0 || line.Rate < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Enter a quantity and rate for " + line.ProductName})
+			return
+		}
+		order.Lines = append(order.Lines, line)
+	}
+	if len(order.Lines) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Add at least one product"})
+		return
+	}
+
+	order.Number = strings.TrimSpace(c.PostForm("number"))
+	if order.Number == "" {
+		existing, err := listOrders(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to number the order"})
+			return
+		}
+		order.Number = nextOrderNumber(existing)
+	}
+
+	if order.ID == "" {
+		err = utils.PBCreateRecord("purchase_orders", order, nil)
+	} else {
+		err = utils.PBUpdateRecord("purchase_orders", order.ID, order, nil)
+		if err == nil {
+			// Changed quantities may close or reopen the order
+			err = refreshOrderStatus(userID, order.ID)
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save purchase order"})
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, "/orders")
+}
+
+// ShowOrder renders a purchase order with what has been received of each
+// line and the invoices delivered against it
+func ShowOrder(c *gin.Context) {
+	userID := currentUserID(c)
+
+	order, err := ownedOrder(userID, c.Param("id"))
+	if err != nil {
+		c.HTML(http.StatusNotFound, "order.html", gin.H{
+			"error": "Purchase order not found",
+		})
+		return
+	}
+	supplier, err := ownedSupplier(userID, order.Supplier)
+	if err != nil {
+		supplier = &models.Supplier{}
+	}
+	invoices, err := orderInvoices(userID, order.ID)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "order.html", gin.H{
+			"error": "Failed to load invoices",
+		})
+		return
+	}
+	products, err := listProducts(userID)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "order.html", gin.H{
+			"error": "Failed to load products",
+		})
+		return
+	}
+	names := productNames(products)
+
+	received := orders.Received(invoices, "")
+	lines := make([]OrderLineView, len(order.Lines))
+	for i, l := range order.Lines {
+		lines[i] = OrderLineView{
+			OrderLine:   l,
+			Received:    received[l.Product],
+			Outstanding: max(l.Quantity-received[l.Product], 0),
+		}
+	}
+
+	views := make([]OrderInvoiceView, len(invoices))
+	for i := range invoices {
+		file := &invoices[i]
+		match := orders.MatchInvoice(order, orders.Received(invoices, file.ID), withProductNames(file.Lines, names))
+		views[i] = OrderInvoiceView{
+			ID:       file.ID,
+			Number:   file.InvoiceNumber,
+			Date:     file.InvoiceDate,
+			Approved: file.Status == models.StatusApproved,
+			Problems: match.Problems,
+		}
+	}
+
+	c.HTML(http.StatusOK, "order.html", gin.H{
+		"Order":       order,
+		"StatusLabel": orders.StatusLabel(order.Status),
+		"Supplier":    supplier,
+		"Lines":       lines,
+		"Invoices":    views,
+	})
+}
+
+// DeleteOrder removes a purchase order nothing has been delivered against
+func DeleteOrder(c *gin.Context) {
+	userID := currentUserID(c)
+
+	order, err := ownedOrder(userID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Purchase order not found"})
+		return
+	}
+	invoices, err := orderInvoices(userID, order.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load invoices"})
+		return
+	}
+	if len(invoices) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Unlink the invoices delivered against this order first"})
+		return
+	}
+	if err := utils.PBDeleteRecord("purchase_orders", order.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete purchase order"})
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, "/orders")
+}
+
+// LinkInvoiceOrder changes the purchase order an invoice delivers against,
+// updating the status of both orders
+func LinkInvoiceOrder(c *gin.Context) {
+	file, ok := ownedFile(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	orderID := c.PostForm("order_id")
+	if orderID != "" {
+		order, err := ownedOrder(file.User, orderID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Purchase order not found"})
+			return
+		}
+		if order.Supplier != file.Supplier {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The purchase order is for another supplier"})
+			return
+		}
+	}
+	if err := utils.PBUpdateRecord("excel_files", file.ID, map[string]interface{}{
+		"purchase_order": orderID,
+	}, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link purchase order"})
+		return
+	}
+	for _, id := range []string{file.PurchaseOrder, orderID} {
+		if err := refreshOrderStatus(file.User, id); err != nil {
+			log.Printf("Error updating status of purchase order %s: %v", id, err)
+		}
+	}
+
+	c.Redirect(http.StatusSeeOther, "/invoices/"+file.ID)
+}
@@ -0,0 +1,530 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ashX04/new_website/internal/analytics"
+	"github.com/ashX04/new_website/internal/gst"
+	"github.com/ashX04/new_website/internal/models"
+	"github.com/ashX04/new_website/internal/normalise"
+	"github.com/ashX04/new_website/internal/payables"
+	"github.com/ashX04/new_website/internal/sales"
+	"github.com/ashX04/new_website/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// billFields are the excel_files fields payables need
+const billFields = "id,created,invoice_number,invoice_date,invoice_total,lines,duplicate_of,supplier"
+
+// PayableView is what is owed to one supplier
+type PayableView struct {
+	SupplierID  string
+	Name        string
+	OpenBills   int
+	Outstanding string
+	Overdue     string
+	Buckets     []string
+	// Credit is paid on account beyond every bill
+	Credit string
+}
+
+// BillView is an invoice on a supplier's account
+type BillView struct {
+	ID          string
+	Number      string
+	Date        string
+	Due         string
+	Amount      string
+	Paid        string
+	Outstanding string
+	DaysOverdue int
+	Settled     bool
+}
+
+// PaymentView is a payment on a supplier's account
+type PaymentView struct {
+	ID        string
+	Date      string
+	Amount    string
+	Mode      string
+	Reference string
+	Invoice   string
+	Note      string
+}
+
+// EntryView is a line of a supplier statement
+type EntryView struct {
+	Date      string
+	Bill      bool
+	Reference string
+	Due       string
+	Debit     string
+	Credit    string
+	Balance   string
+}
+
+// billAmount is what an invoice is for: its printed total, or the total of
+// its lines when none was read
+func billAmount(file *models.ExcelFile) int64 {
+	if total := gst.Paise(file.InvoiceTotal); total > 0 {
+		return total
+	}
+	tax, err := gst.ComputeInvoice(file.Lines, gst.SupplyUnknown)
+	if err != nil {
+		return 0
+	}
+	total := tax.Total()
+	return total.Taxable + total.Tax()
+}
+
+// invoiceDay is the date of an invoice, or its upload date in loc when the
+// printed date cannot be read
+func invoiceDay(file *models.ExcelFile, loc *time.Location) time.Time {
+	if date, ok := normalise.Date(file.InvoiceDate); ok {
+		return date
+	}
+	created, err := utils.ParsePBTime(file.Created)
+	if err != nil {
+		return time.Time{}
+	}
+	created = created.In(loc)
+	return time.Date(created.Year(), created.Month(), created.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// listBills returns the bills of the user's invoices by supplier ID, due
+// after the supplier's payment terms, and counts the invoices not linked to
+// a supplier. Duplicates are left out.
+func listBills(userID string, loc *time.Location, suppliers []models.Supplier, clauses ...string) (map[string][]payables.Bill, int, error) {
+	terms := make(map[string]int, len(suppliers))
+	for _, s := range suppliers {
+		terms[s.ID] = s.PaymentTermsDays
+	}
+	clauses = append([]string{fmt.Sprintf("user=%s", utils.PBQuote(userID))}, clauses...)
+	params := url.Values{}
+	params.Set("filter", "("+strings.Join(clauses, " && ")+")")
+	params.Set("fields", billFields)
+	params.Set("sort", "created")
+	files, err := utils.PBListAll[models.ExcelFile]("excel_files", params)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	bills := make(map[string][]payables.Bill)
+	unlinked := 0
+	for i := range files {
+		file := &files[i]
+		if file.DuplicateOf != "" {
+			continue
+		}
+		if file.Supplier == "" {
+			unlinked++
+			continue
+		}
+		date := invoiceDay(file, loc)
+		bills[file.Supplier] = append(bills[file.Supplier], payables.Bill{
+			ID:     file.ID,
+			Number: file.InvoiceNumber,
+			Date:   date,
+			Due:    payables.DueDate(date, terms[file.Supplier]),
+			Amount: billAmount(file),
+		})
+	}
+	return bills, unlinked, nil
+}
+
+// listPayments returns the user's payments matching the extra filter
+// clauses, oldest first
+func listPayments(userID string, clauses ...string) ([]models.Payment, error) {
+	clauses = append([]string{fmt.Sprintf("user=%s", utils.PBQuote(userID))}, clauses...)
+	params := url.Values{}
+	params.Set("filter", "("+strings.Join(clauses, " && ")+")")
+	params.Set("sort", "date,created")
+	return utils.PBListAll[models.Payment]("payments", params)
+}
+
+// toPayables converts payment records for allocation
+func toPayables(records []models.Payment) []payables.Payment {
+	payments := make([]payables.Payment, 0, len(records))
+	for _, p := range records {
+		date, _ := normalise.Date(p.Date)
+		payments = append(payments, payables.Payment{
+			ID:        p.ID,
+			Date:      date,
+			Amount:    gst.Paise(p.Amount),
+			Invoice:   p.Invoice,
+			Mode:      p.Mode,
+			Reference: p.Reference,
+		})
+	}
+	return payments
+}
+
+// today is the current date in loc, at midnight UTC like invoice dates
+func today(loc *time.Location) time.Time {
+	now := time.Now().In(loc)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// ShowPayables lists what is owed to each supplier, aged by invoice date
+func ShowPayables(c *gin.Context) {
+	userID := currentUserID(c)
+	loc := userLocation(userID)
+
+	suppliers, err := listSuppliers(userID)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "payables.html", gin.H{
+			"error": "Failed to load suppliers",
+		})
+		return
+	}
+	bills, unlinked, err := listBills(userID, loc, suppliers)
+	if err != nil {
+		log.Printf("Error loading bills: %v", err)
+		c.HTML(http.StatusInternalServerError, "payables.html", gin.H{
+			"error": "Failed to load invoices",
+		})
+		return
+	}
+	records, err := listPayments(userID)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "payables.html", gin.H{
+			"error": "Failed to load payments",
+		})
+		return
+	}
+	payments := make(map[string][]payables.Payment)
+	for i, p := range toPayables(records) {
+		payments[records[i].Supplier] = append(payments[records[i].Supplier], p)
+	}
+
+	day := today(loc)
+	var views []PayableView
+	var total payables.Ageing
+	for _, s := range suppliers {
+		supplierBills := bills[s.ID]
+		if len(supplierBills) == 0 && len(payments[s.ID]) == 0 {
+			continue
+		}
+		credit := payables.Allocate(supplierBills, payments[s.ID])
+		var ageing payables.Ageing
+		open := 0
+		for _, b := range supplierBills {
+			ageing.Add(b, day)
+			if b.Outstanding() > 0 {
+				open++
+			}
+		}
+		total.Merge(ageing)
+		view := PayableView{
+			SupplierID:  s.ID,
+			Name:        s.Name,
+			OpenBills:   open,
+			Outstanding: analytics.Rupees(ageing.Total),
+			Overdue:     analytics.Rupees(ageing.Overdue),
+		}
+		for _, amount := range ageing.Buckets {
+			view.Buckets = append(view.Buckets, analytics.Rupees(amount))
+		}
+		if credit > 0 {
+			view.Credit = analytics.Rupees(credit)
+		}
+		views = append(views, view)
+	}
+	sort.SliceStable(views, func(i, j int) bool { return views[i].Name < views[j].Name })
+
+	totals := make([]string, len(total.Buckets))
+	for i, amount := range total.Buckets {
+		totals[i] = analytics.Rupees(amount)
+	}
+	c.HTML(http.StatusOK, "payables.html", gin.H{
+		"Suppliers":    views,
+		"BucketLabels": payables.BucketLabels,
+		"Totals":       totals,
+		"Outstanding":  analytics.Rupees(total.Total),
+		"Overdue":      analytics.Rupees(total.Overdue),
+		"Unlinked":     unlinked,
+	})
+}
+
+// supplierAccount loads the bills and payments of one supplier, with the
+// bills settled by the payments
+func supplierAccount(userID string, supplier *models.Supplier, loc *time.Location) ([]payables.Bill, []models.Payment, int64, error) {
+	bills, _, err := listBills(userID, loc, []models.Supplier{*supplier}, fmt.Sprintf("supplier=%s", utils.PBQuote(supplier.ID)))
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	records, err := listPayments(userID, fmt.Sprintf("supplier=%s", utils.PBQuote(supplier.ID)))
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	supplierBills := bills[supplier.ID]
+	credit := payables.Allocate(supplierBills, toPayables(records))
+	return supplierBills, records, credit, nil
+}
+
+// ShowSupplierAccount renders a supplier's bills with their due dates and
+// what is paid on them, the payments made and the payment form
+func ShowSupplierAccount(c *gin.Context) {
+	userID := currentUserID(c)
+	loc := userLocation(userID)
+
+	supplier, err := ownedSupplier(userID, c.Param("id"))
+	if err != nil {
+		c.HTML(http.StatusNotFound, "payables_supplier.html", gin.H{
+			"error": "Supplier not found",
+		})
+		return
+	}
+	bills, records, credit, err := supplierAccount(userID, supplier, loc)
+	if err != nil {
+		log.Printf("Error loading account of supplier %s: %v", supplier.ID, err)
+		c.HTML(http.StatusInternalServerError, "payables_supplier.html", gin.H{
+			"error": "Failed to load the supplier's account",
+		})
+		return
+	}
+
+	day := today(loc)
+	var ageing payables.Ageing
+	numbers := make(map[string]string, len(bills))
+	views := make([]BillView, len(bills))
+	var open []BillView
+	for i, b := range bills {
+		ageing.Add(b, day)
+		numbers[b.ID] = b.Number
+		views[i] = BillView{
+			ID:          b.ID,
+			Number:      b.Number,
+			Date:        b.Date.Format("02-01-2006"),
+			Due:         b.Due.Format("02-01-2006"),
+			Amount:      analytics.Rupees(b.Amount),
+			Paid:        analytics.Rupees(b.Paid),
+			Outstanding: analytics.Rupees(b.Outstanding()),
+			DaysOverdue: b.DaysOverdue(day),
+			Settled:     b.Outstanding() <= 0,
+		}
+		if !views[i].Settled {
+			open = append(open, views[i])
+		}
+	}
+
+	payments := make([]PaymentView, len(records))
+	for i, p := range records {
+		payments[i] = PaymentView{
+			ID:        p.ID,
+			Date:      p.Date,
+			Amount:    analytics.Rupees(gst.Paise(p.Amount)),
+			Mode:      p.Mode,
+			Reference: p.Reference,
+			Invoice:   numbers[p.Invoice],
+			Note:      p.Note,
+		}
+		if t, ok := normalise.Date(p.Date); ok {
+			payments[i].Date = t.Format("02-01-2006")
+		}
+		if p.Invoice != "" && payments[i].Invoice == "" {
+			payments[i].Invoice = "(no number)"
+		}
+	}
+
+	buckets := make([]string, len(ageing.Buckets))
+	for i, amount := range ageing.Buckets {
+		buckets[i] = analytics.Rupees(amount)
+	}
+	creditText := ""
+	if credit > 0 {
+		creditText = analytics.Rupees(credit)
+	}
+	c.HTML(http.StatusOK, "payables_supplier.html", gin.H{
+		"Supplier":     supplier,
+		"Bills":        views,
+		"OpenBills":    open,
+		"Payments":     payments,
+		"Outstanding":  analytics.Rupees(ageing.Total),
+		"Overdue":      analytics.Rupees(ageing.Overdue),
+		"BucketLabels": payables.BucketLabels,
+		"Buckets":      buckets,
+		"Credit":       creditText,
+		"Modes":        models.PaymentModes,
+		"Today":        day.Format("2006-01-02"),
+	})
+}
+
+// RecordPayment records a payment to a supplier, against one of its
+// invoices or on account. Against an invoice, an empty amount pays what is
+// outstanding on it in full.
+func RecordPayment(c *gin.Context) {
+	userID := currentUserID(c)
+	loc := userLocation(userID)
+
+	supplier, err := ownedSupplier(userID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Supplier not found"})
+		return
+	}
+	date, ok := normalise.Date(c.PostForm("date"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Enter the payment date"})
+		return
+	}
+	mode := c.PostForm("mode")
+	known := false
+	for _, m := range models.PaymentModes {
+		known = known || m == mode
+	}
+	if !known {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Choose a payment mode"})
+		return
+	}
+
+	payment := models.Payment{
+		User:      userID,
+		Supplier:  supplier.ID,
+		Invoice:   c.PostForm("invoice_id"),
+		Date:      date.Format("2006-01-02"),
+		Mode:      mode,
+		Reference: strings.TrimSpace(c.PostForm("reference")),
+		Note:      strings.TrimSpace(c.PostForm("note")),
+	}
+	amount := strings.TrimSpace(c.PostForm("amount"))
+	if amount != "" {
+		var ok bool
+		payment.Amount, ok = parseFinite(amount)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid amount %q", amount)})
+			return
+		}
+	}
+
+	if payment.Invoice != "" || payment.Amount == 0 {
+		bills, _, _, err := supplierAccount(userID, supplier, loc)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load the supplier's account"})
+			return
+		}
+		var bill *payables.Bill
+		for i := range bills {
+			if bills[i].ID == payment.Invoice {
+				bill = &bills[i]
+			}
+		}
+		if payment.Invoice != "" && bill == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invoice not found on this supplier's account"})
+			return
+		}
+		if payment.Amount == 0 && bill != nil {
+			payment.Amount = gst.Rupees(bill.Outstanding())
+		}
+	}
+	if payment.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Enter an amount greater than zero"})
+		return
+	}
+
+	if err := utils.PBCreateRecord("payments", payment, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record payment"})
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, "/payables/"+supplier.ID)
+}
+
+// DeletePayment removes a payment entered by mistake
+func DeletePayment(c *gin.Context) {
+	userID := currentUserID(c)
+
+	var payment models.Payment
+	if err := utils.PBGetRecord("payments", c.Param("payment"), &payment); err != nil || payment.User != userID || payment.Supplier != c.Param("id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
+	}
+	if err := utils.PBDeleteRecord("payments", payment.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete payment"})
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, "/payables/"+payment.Supplier)
+}
+
+// ShowStatement renders a printable statement of a supplier's account.
+// ?from= and ?to= (YYYY-MM-DD) choose the period, the current financial
+// year up to today by default.
+func ShowStatement(c *gin.Context) {
+	userID := currentUserID(c)
+	settings, err := loadSettings(userID)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "statement.html", gin.H{
+			"error": "Failed to load settings",
+		})
+		return
+	}
+	loc := settings.Location()
+
+	supplier, err := ownedSupplier(userID, c.Param("id"))
+	if err != nil {
+		c.HTML(http.StatusNotFound, "statement.html", gin.H{
+			"error": "Supplier not found",
+		})
+		return
+	}
+	bills, records, _, err := supplierAccount(userID, supplier, loc)
+	if err != nil {
+		log.Printf("Error loading account of supplier %s: %v", supplier.ID, err)
+		c.HTML(http.StatusInternalServerError, "statement.html", gin.H{
+			"error": "Failed to load the supplier's account",
+		})
+		return
+	}
+
+	to := today(loc)
+	if t, ok := normalise.Date(c.Query("to")); ok {
+		to = t
+	}
+	from := sales.YearStart(to)
+	if t, ok := normalise.Date(c.Query("from")); ok {
+		from = t
+	}
+	if from.After(to) {
+		from, to = to, from
+	}
+
+	opening, entries := payables.Statement(bills, toPayables(records), from, to)
+	views := make([]EntryView, len(entries))
+	closing := opening
+	for i, e := range entries {
+		views[i] = EntryView{
+			Date:      e.Date.Format("02-01-2006"),
+			Bill:      e.Bill,
+			Reference: e.Reference,
+			Balance:   analytics.Rupees(e.Balance),
+		}
+		if e.Bill {
+			views[i].Credit = analytics.Rupees(e.Credit)
+			views[i].Due = e.Due.Format("02-01-2006")
+			if views[i].Reference == "" {
+				views[i].Reference = "(no number)"
+			}
+		} else {
+			views[i].Debit = analytics.Rupees(e.Debit)
+		}
+		closing = e.Balance
+	}
+
+	c.HTML(http.StatusOK, "statement.html", gin.H{
+		"Supplier": supplier,
+		"Account":  settings.GSTIN,
+		"From":     from.Format("2006-01-02"),
+		"To":       to.Format("2006-01-02"),
+		"Period":   from.Format("02-01-2006") + " to " + to.Format("02-01-2006"),
+		"Opening":  analytics.Rupees(opening),
+		"Closing":  analytics.Rupees(closing),
+		"Entries":  views,
+		"Printed":  time.Now().In(loc).Format("02-01-2006 15:04"),
+	})
+}
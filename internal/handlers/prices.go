@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ashX04/new_website/internal/analytics"
+	"github.com/ashX04/new_website/internal/gst"
+	"github.com/ashX04/new_website/internal/models"
+	"github.com/ashX04/new_website/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// PricePointView is an invoice line in a product's price history
+type PricePointView struct {
+	InvoiceID string
+	Number    string
+	Date      string
+	Supplier  string
+	Rate      string
+	MRP       string
+	// Change is the increase on the supplier's previous rate, empty for
+	// the supplier's first invoice
+	Change string
+	// Raised is set when the change is above the alert threshold
+	Raised bool
+}
+
+// SupplierPriceView is what one supplier charged for a product
+type SupplierPriceView struct {
+	Name     string
+	Latest   string
+	LastDate string
+	Lowest   string
+	Highest  string
+	Lines    int
+	Href     string
+}
+
+// alertPriceChanges notifies the user of lines of a newly processed invoice
+// whose rate went up by more than the account's threshold. Invoices left
+// out of the purchase books, such as duplicates, raise no alerts.
+func alertPriceChanges(userID string, settings *models.Settings, fileID string) error {
+	books, err := loadPurchaseBooks(userID, settings)
+	if err != nil {
+		return err
+	}
+	products, err := listProducts(userID)
+	if err != nil {
+		return err
+	}
+	purchases := analyticsPurchases(books, productNames(products))
+
+	var invoice *analytics.Purchase
+	for i := range purchases {
+		if purchases[i].ID == fileID {
+			invoice = &purchases[i]
+		}
+	}
+	if invoice == nil {
+		return nil
+	}
+	alerts := analytics.PriceAlerts(invoice, purchases, settings.PriceAlertThreshold())
+	if len(alerts) == 0 {
+		return nil
+	}
+
+	number := invoice.Number
+	if number == "" {
+		number = "without a number"
+	}
+	title := fmt.Sprintf("%d price increase(s) on invoice %s from %s", len(alerts), number, invoice.SupplierName)
+	var body strings.Builder
+	for _, a := range alerts {
+		fmt.Fprintf(&body, "Line %d, %s\n", a.Line+1, a)
+	}
+	fmt.Fprintf(&body, "Flagged at more than %g%% above the previous or cheapest rate.\n", settings.PriceAlertThreshold())
+
+	if err := utils.PBCreateRecord("notifications", models.Notification{
+		User:  userID,
+		Kind:  models.NotificationPriceChange,
+		Title: title,
+		Body:  body.String(),
+	}, nil); err != nil {
+		return fmt.Errorf("failed to store price alert: %w", err)
+	}
+	if settings.NotifyEmail != "" {
+		err := utils.SendMail(settings.NotifyEmail, "Price alert: "+title, body.String())
+		if err != nil && !errors.Is(err, utils.ErrMailNotConfigured) {
+			log.Printf("Error emailing price alert of %s: %v", userID, err)
+		}
+	}
+	return nil
+}
+
+// ShowPriceHistory charts the rates a product was bought at, per invoice
+// line, with what each supplier charged. ?supplier= narrows the chart and
+// the history to one supplier.
+func ShowPriceHistory(c *gin.Context) {
+	userID := currentUserID(c)
+	product, err := ownedProduct(userID, c.Param("id"))
+	if err != nil {
+		c.HTML(http.StatusNotFound, "price_history.html", gin.H{
+			"error": "Product not found",
+		})
+		return
+	}
+	settings, err := loadSettings(userID)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "price_history.html", gin.H{
+			"error": "Failed to load settings",
+		})
+		return
+	}
+	books, err := loadPurchaseBooks(userID, settings)
+	if err != nil {
+		log.Printf("Error loading purchase books: %v", err)
+		c.HTML(http.StatusInternalServerError, "price_history.html", gin.H{
+			"error": "Failed to load invoices",
+		})
+		return
+	}
+	purchases := analyticsPurchases(books, map[string]string{product.ID: product.Name})
+	history := analytics.PriceHistory(purchases, product.ID)
+	base := "/products/" + product.ID + "/prices"
+
+	supplier := c.Query("supplier")
+	var suppliers []SupplierPriceView
+	supplierName := ""
+	for _, s := range analytics.SupplierPrices(history) {
+		suppliers = append(suppliers, SupplierPriceView{
+			Name:     s.SupplierName,
+			Latest:   analytics.Rupees(s.Latest.Rate),
+			LastDate: s.Latest.Date.Format("02-01-2006"),
+			Lowest:   analytics.Rupees(s.Lowest),
+			Highest:  analytics.Rupees(s.Highest),
+			Lines:    s.Lines,
+			Href:     base + "?" + url.Values{"supplier": {s.Supplier}}.Encode(),
+		})
+		if s.Supplier == supplier {
+			supplierName = s.SupplierName
+		}
+	}
+
+	threshold := settings.PriceAlertThreshold()
+	previous := make(map[string]int64)
+	var data []analytics.Datum
+	var points []PricePointView
+	for _, pt := range history {
+		last, seen := previous[pt.Supplier]
+		previous[pt.Supplier] = pt.Rate
+		if supplier != "" && pt.Supplier != supplier {
+			continue
+		}
+		view := PricePointView{
+			InvoiceID: pt.InvoiceID,
+			Number:    pt.Number,
+			Date:      pt.Date.Format("02-01-2006"),
+			Supplier:  pt.SupplierName,
+			Rate:      analytics.Rupees(pt.Rate),
+		}
+		if pt.MRP > 0 {
+			view.MRP = analytics.Rupees(pt.MRP)
+		}
+		if seen && last != pt.Rate {
+			change := analytics.Change(last, pt.Rate)
+			view.Change = fmt.Sprintf("%+.1f%%", change)
+			view.Raised = change > threshold
+		}
+		points = append(points, view)
+		data = append(data, analytics.Datum{
+			Label: pt.Date.Format("Jan 06"),
+			Value: gst.Rupees(pt.Rate),
+			Title: fmt.Sprintf("%s, %s: %s", pt.Date.Format("02-01-2006"), pt.SupplierName, analytics.Rupees(pt.Rate)),
+			Href:  "/invoices/" + pt.InvoiceID,
+		})
+	}
+	// The history is listed newest first
+	for i, j := 0, len(points)-1; i < j; i, j = i+1, j-1 {
+		points[i], points[j] = points[j], points[i]
+	}
+
+	var chart *analytics.Chart
+	if len(data) > 0 {
+		ch := analytics.LineChart(data, analytics.Compact)
+		chart = &ch
+	}
+	c.HTML(http.StatusOK, "price_history.html", gin.H{
+		"Product":      product,
+		"Chart":        chart,
+		"Points":       points,
+		"Suppliers":    suppliers,
+		"Supplier":     supplier,
+		"SupplierName": supplierName,
+		"ClearURL":     base,
+		"Threshold":    threshold,
+	})
+}
@@ -2,28 +2,50 @@ package handlers
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
 	"log"
-	"mime/multipart"
-	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
-	"time"
 
+	"github.com/ashX04/new_website/internal/export"
+	"github.com/ashX04/new_website/internal/imageproc"
+	"github.com/ashX04/new_website/internal/models"
+	"github.com/ashX04/new_website/internal/storage"
 	"github.com/ashX04/new_website/internal/utils"
-	"github.com/xuri/excelize/v2"
 )
 
 // ProcessImage handles sending the image to Azure Vision API and processing the response with OpenAI
 func ProcessImage(filePath string, userID string, imageID string) (string, error) {
+	keys := uploadKeys(userID, filePath)
+	ctx := context.Background()
+
+	// Clean up photographed images before OCR. PDFs are sent as they are.
+	ocrPath := filePath
+	processedKey := ""
+	phash := ""
+	if !utils.IsPDF(filePath) {
+		processedPath, hash, err := preprocessImage(filePath)
+		if err != nil {
+			// OCR may still cope with the original, so carry on without it
+			log.Printf("Error preprocessing image %s: %v", filePath, err)
+		} else {
+			defer os.Remove(processedPath)
+			if err := putBlobFile(keys.Processed, processedPath); err != nil {
+				return "", fmt.Errorf("failed to store processed image: %w", err)
+			}
+			ocrPath = processedPath
+			processedKey = keys.Processed
+			phash = fmt.Sprintf("%016x", hash)
+		}
+	}
+
 	// Send the image to the Azure Vision API
-	resp, err := utils.SendImageToAPI(filePath)
+	resp, err := utils.SendImageToAPI(ocrPath)
 	if err != nil {
 		return "", fmt.Errorf("failed to send image to API: %w", err)
 	}
-	time.Sleep(2 * time.Second)
 
 	// Handle the API response
 	responseData, err := utils.HandleAPIResponse(resp)
@@ -31,38 +53,22 @@ func ProcessImage(filePath string, userID string, imageID string) (string, error
 		return "", fmt.Errorf("failed to handle API response: %w", err)
 	}
 
+	// Keep the raw OCR response alongside the source image
+	if err := storage.Default.Put(ctx, keys.OCR, strings.NewReader(responseData), "application/json"); err != nil {
+		return "", fmt.Errorf("failed to store OCR response: %w", err)
+	}
+
 	// Parse the JSON response
-	var result map[string]interface{}
-	if err := json.Unmarshal([]byte(responseData), &result); err != nil {
+	readResult, err := utils.ParseReadResult(responseData)
+	if err != nil {
 		log.Printf("Error parsing JSON: %v", err)
-		// If parsing fails, try sending the raw response to OpenAI
-		//csvData, err := utils.SendJSONToOpenAI(responseData)
-		// if err != nil {
-		// 	return "", fmt.Errorf("failed to process text with OpenAI: %w", err)
-		// }
 		csvData := "error true"
 		return csvData, nil
 	}
 
-	// Extract text from the Azure Vision API response
-	var extractedText string
-	if analyzeResult, ok := result["analyzeResult"].(map[string]interface{}); ok {
-		if readResults, ok := analyzeResult["readResults"].([]interface{}); ok {
-			for _, page := range readResults {
-				if pageObj, ok := page.(map[string]interface{}); ok {
-					if lines, ok := pageObj["lines"].([]interface{}); ok {
-						for _, line := range lines {
-							if lineObj, ok := line.(map[string]interface{}); ok {
-								if text, ok := lineObj["text"].(string); ok {
-									extractedText += text + " "
-								}
-							}
-						}
-					}
-				}
-			}
-		}
-	}
+	// Extract text from every page of the Azure Vision API response
+	extractedText := readResult.Text()
+	pages := readResult.PageCount()
 
 	// If no text was extracted, use the raw response
 	if extractedText == "" {
@@ -71,13 +77,18 @@ func ProcessImage(filePath string, userID string, imageID string) (string, error
 
 	log.Printf("Extracted Text: %s", extractedText)
 
-	// Process the extracted text with OpenAI
-	csvData, err := utils.SendJSONToOpenAI(extractedText)
+	// Process the extracted text with OpenAI, asking for the columns of the
+	// account's output template
+	columns := activeColumns(userID)
+	csvData, err := utils.SendJSONToOpenAI(extractedText, pages, columns)
 	if err != nil {
 		return "", fmt.Errorf("failed to process text with OpenAI: %w", err)
 	}
 	log.Printf("CSV Data: %s", csvData)
 
+	// The header block follows the CSV in the same response
+	header := utils.ParseInvoiceHeader(csvData)
+
 	// Extract text between <*> tags
 	startIndex := strings.Index(csvData, "<*>")
 	endIndex := strings.LastIndex(csvData, "<*>")
@@ -89,131 +100,144 @@ func ProcessImage(filePath string, userID string, imageID string) (string, error
 	}
 	// Remove all <*> from csvData
 	csvData = strings.ReplaceAll(csvData, "<*>", "")
-	// Create a new Excel file
-	f := excelize.NewFile()
+	// Split the CSV data into rows, dropping headers repeated on later pages
+	rows := mergeContinuedRows(strings.Split(strings.TrimSpace(csvData), "\n"))
+
+	var table [][]string
+	for _, row := range rows {
+		table = append(table, utils.SplitCSVRow(row))
+	}
+	lines := utils.ParseInvoiceLines(table, columns)
+	matchNewLines(userID, lines)
+
+	// Assemble the excel_files record pointing at the stored artifacts. Its
+	// ID is chosen up front so that the workbook can refer back to it.
+	record := models.ExcelFile{
+		ID:            utils.NewRecordID(),
+		User:          userID,
+		ImageKey:      keys.Source,
+		ProcessedKey:  processedKey,
+		OCRKey:        keys.OCR,
+		ExcelKey:      keys.Excel,
+		Pages:         pages,
+		InvoiceHeader: header,
+		Supplier:      recogniseSupplier(userID, &header),
+		PHash:         phash,
+		Status:        models.StatusProcessed,
+		Lines:         lines,
+		Columns:       columns,
+		SearchText:    utils.SearchText(header, lines),
+	}
+
+	// Flag likely duplicates rather than refusing them, so that a reviewer
+	// can decide which copy to keep
+	duplicateOf, reason, err := findDuplicate(userID, &record)
+	if err != nil {
+		log.Printf("Error checking for duplicates: %v", err)
+	} else if duplicateOf != "" {
+		log.Printf("Upload %s looks like a duplicate of %s: %s", filePath, duplicateOf, reason)
+		record.DuplicateOf = duplicateOf
+		record.DuplicateReason = reason
+	}
+
+	// Link the invoice to the open purchase order it most likely delivers
+	// against, for the reviewer to check on the invoice page
+	record.PurchaseOrder = pickOrder(userID, &record)
+
+	// The account's GSTIN decides whether the invoice is intra- or
+	// inter-state, which the workbook checks its tax against
+	accountGSTIN := ""
+	settings, err := loadSettings(userID)
+	if err != nil {
+		log.Printf("Error loading settings for supply type: %v", err)
+	} else {
+		accountGSTIN = settings.GSTIN
+	}
+
+	// Build the workbook and store it in the blob store
+	f, err := buildWorkbook(&record, invoiceSupply(accountGSTIN, &record, nil))
+	if err != nil {
+		log.Printf("Error building Excel file: %v", err)
+		return "", fmt.Errorf("failed to build Excel file: %w", err)
+	}
 	defer func() {
 		if err := f.Close(); err != nil {
 			log.Printf("Error closing Excel file: %v", err)
 		}
 	}()
-
-	// Set the active sheet
-	sheetName := "Sheet1"
-	index, err := f.GetSheetIndex(sheetName)
+	buf, err := f.WriteToBuffer()
 	if err != nil {
-		log.Printf("Error getting sheet index: %v", err)
-		return "", fmt.Errorf("failed to get sheet index: %w", err)
-	}
-	f.SetActiveSheet(index)
-
-	// Split the CSV data into rows
-	rows := strings.Split(strings.TrimSpace(csvData), "\n")
-
-	// Write each row to the Excel file
-	for i, row := range rows {
-		cols := strings.Split(row, ",")
-		for j, col := range cols {
-			cell, err := excelize.CoordinatesToCellName(j+1, i+1)
-			if err != nil {
-				log.Printf("Error converting coordinates to cell name: %v", err)
-				continue
-			}
-			f.SetCellValue(sheetName, cell, strings.TrimSpace(col))
-		}
-	}
-
-	// Save the Excel file
-	fileName := fmt.Sprintf("uploads/output_%d.xlsx", time.Now().Unix())
-	// Create uploads directory if it doesn't exist
-	if err := os.MkdirAll("uploads", 0755); err != nil {
-		log.Printf("Error creating uploads directory: %v", err)
-		return "", fmt.Errorf("failed to create uploads directory: %w", err)
+		log.Printf("Error writing Excel file: %v", err)
+		return "", fmt.Errorf("failed to write Excel file: %w", err)
 	}
-	if err := f.SaveAs(fileName); err != nil {
-		log.Printf("Error saving Excel file: %v", err)
-		return "", fmt.Errorf("failed to save Excel file: %w", err)
+	if err := storage.Default.Put(ctx, keys.Excel, buf, export.XLSXContentType); err != nil {
+		log.Printf("Error storing Excel file: %v", err)
+		return "", fmt.Errorf("failed to store Excel file: %w", err)
 	}
 
-	// After Excel file is created, prepare multipart form data
-	fileData := &bytes.Buffer{}
-	writer := multipart.NewWriter(fileData)
-
-	// Add user ID field
-	if err := writer.WriteField("user", userID); err != nil {
-		log.Printf("Error writing user field: %v", err)
-		return "", fmt.Errorf("failed to write user field: %w", err)
+	if err := utils.PBCreateRecord("excel_files", record, nil); err != nil {
+		log.Printf("Error creating excel_files record: %v", err)
+		return "", fmt.Errorf("failed to create excel_files record: %w", err)
 	}
 
-	// Add Excel file
-	excelFile, err := os.Open(fileName)
-	if err != nil {
-		log.Printf("Error opening Excel file: %v", err)
-		return "", fmt.Errorf("failed to open Excel file: %w", err)
+	// Price alerts compare the invoice with the books it is now part of. A
+	// failure is only logged, since the invoice itself was saved.
+	if settings != nil {
+		if err := alertPriceChanges(userID, settings, record.ID); err != nil {
+			log.Printf("Error checking prices of %s: %v", record.ID, err)
+		}
 	}
-	defer excelFile.Close()
 
-	excelPart, err := writer.CreateFormFile("excel", fileName)
-	if err != nil {
-		log.Printf("Error creating excel form file: %v", err)
-		return "", fmt.Errorf("failed to create excel form file: %w", err)
-	}
+	log.Printf("Excel file and image saved successfully")
+	return keys.Excel, nil
+}
 
-	if _, err := io.Copy(excelPart, excelFile); err != nil {
-		log.Printf("Error copying excel file contents: %v", err)
-		return "", fmt.Errorf("failed to copy excel file contents: %w", err)
+// mergeContinuedRows joins the parts of a line item table that continues
+// across pages: blank lines and any repeat of the header row are dropped.
+func mergeContinuedRows(rows []string) []string {
+	if len(rows) == 0 {
+		return rows
 	}
 
-	// Add the source image file
-	sourceImage, err := os.Open(filePath)
-	if err != nil {
-		log.Printf("Error opening source image: %v", err)
-		return "", fmt.Errorf("failed to open source image: %w", err)
+	normalise := func(row string) string {
+		return strings.ToLower(strings.ReplaceAll(row, " ", ""))
 	}
-	defer sourceImage.Close()
+	header := normalise(rows[0])
 
-	imagePart, err := writer.CreateFormFile("image", filePath)
-	if err != nil {
-		log.Printf("Error creating image form file: %v", err)
-		return "", fmt.Errorf("failed to create image form file: %w", err)
+	merged := []string{rows[0]}
+	for _, row := range rows[1:] {
+		if strings.TrimSpace(row) == "" || normalise(row) == header {
+			continue
+		}
+		merged = append(merged, row)
 	}
+	return merged
+}
 
-	if _, err := io.Copy(imagePart, sourceImage); err != nil {
-		log.Printf("Error copying image file contents: %v", err)
-		return "", fmt.Errorf("failed to copy image file contents: %w", err)
+// preprocessImage writes an OCR-ready copy of the image next to the
+// original and returns its path and the perceptual hash of the cleaned up
+// image, which is stable across re-photographs of the same page
+func preprocessImage(filePath string) (string, uint64, error) {
+	src, err := os.Open(filePath)
+	if err != nil {
+		return "", 0, err
 	}
+	defer src.Close()
 
-	writer.Close()
-
-	// Send request to PocketBase
-	req, err := http.NewRequest("POST", "http://localhost:8090/api/collections/excel_files/records", fileData)
+	result, err := imageproc.Preprocess(src)
 	if err != nil {
-		log.Printf("Error creating request: %v", err)
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return "", 0, err
 	}
-
-	// Add required headers
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-
-	// Log the request body for debugging
-	log.Printf("Request Content-Type: %s", writer.FormDataContentType())
-
-	client := &http.Client{}
-	pbResp, err := client.Do(req)
+	data, err := imageproc.EncodeJPEG(result.Image)
 	if err != nil {
-		log.Printf("Error uploading to PocketBase: %v", err)
-		return "", fmt.Errorf("failed to upload to PocketBase: %w", err)
+		return "", 0, err
 	}
-	defer pbResp.Body.Close()
-
-	// Read and log the response for debugging
-	respBody, _ := io.ReadAll(pbResp.Body)
-	log.Printf("PocketBase response: %s", string(respBody))
+	log.Printf("Preprocessed %s: rotated %d quarter turns, deskewed %.1f degrees, cropped %v",
+		filePath, result.Rotated, result.Skew, result.Cropped)
 
-	if pbResp.StatusCode != http.StatusOK && pbResp.StatusCode != http.StatusCreated {
-		log.Printf("PocketBase upload failed with status: %d, Response: %s", pbResp.StatusCode, string(respBody))
-		return "", fmt.Errorf("PocketBase upload failed with status: %d", pbResp.StatusCode)
+	processedPath := strings.TrimSuffix(filePath, filepath.Ext(filePath)) + ".processed.jpg"
+	if err := utils.WriteFileAtomic(processedPath, bytes.NewReader(data)); err != nil {
+		return "", 0, err
 	}
-
-	log.Printf("Excel file and image saved successfully")
-	return fileName, nil
+	return processedPath, imageproc.DHash(result.Image), nil
 }
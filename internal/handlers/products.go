@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ashX04/new_website/internal/catalog"
+	"github.com/ashX04/new_website/internal/models"
+	"github.com/ashX04/new_website/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// listProducts returns the product master of a user sorted by name
+func listProducts(userID string) ([]models.Product, error) {
+	params := url.Values{}
+	params.Set("filter", fmt.Sprintf("(user=%s)", utils.PBQuote(userID)))
+	params.Set("sort", "name")
+	return utils.PBListAll[models.Product]("products", params)
+}
+
+// ownedProduct fetches a product and checks that it belongs to userID
+func ownedProduct(userID, id string) (*models.Product, error) {
+	var product models.Product
+	if err := utils.PBGetRecord("products", id, &product); err != nil {
+		return nil, err
+	}
+	if product.User != userID {
+		return nil, utils.ErrRecordNotFound
+	}
+	return &product, nil
+}
+
+// matchLines links each line to its closest product in the master. Links
+// are only suggestions until a reviewer confirms them.
+func matchLines(lines []models.InvoiceLine, products []models.Product) {
+	for i := range lines {
+		if lines[i].MatchConfirmed {
+			continue
+		}
+		product, score := catalog.Match(lines[i].ProductName, products)
+		if product == nil || score < catalog.SuggestThreshold {
+			lines[i].ProductID = ""
+			lines[i].MatchScore = 0
+			continue
+		}
+		lines[i].ProductID = product.ID
+		lines[i].MatchScore = score
+	}
+}
+
+// ShowProducts renders the product master. With ?edit=<id> the form is
+// filled in for that product.
+func ShowProducts(c *gin.Context) {
+	userID := currentUserID(c)
+
+	products, err := listProducts(userID)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "products.html", gin.H{
+			"error": "Failed to load products",
+		})
+		return
+	}
+
+	edit := &models.Product{}
+	if id := c.Query("edit"); id != "" {
+		if p, err := ownedProduct(userID, id); err == nil {
+			edit = p
+		}
+	}
+
+	c.HTML(http.StatusOK, "products.html", gin.H{
+		"Products": products,
+		"Edit":     edit,
+		"Aliases":  strings.Join(edit.Aliases, "\n"),
+	})
+}
+
+// SaveProduct creates a product, or updates it when the form carries an ID
+func SaveProduct(c *gin.Context) {
+	userID := currentUserID(c)
+
+	product := &models.Product{User: userID}
+	if id := c.PostForm("id"); id != "" {
+		existing, err := ownedProduct(userID, id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		product = existing
+	}
+
+	product.Name = strings.TrimSpace(c.PostForm("name"))
+	product.Pack = strings.TrimSpace(c.PostForm("pack"))
+	product.HSN = strings.TrimSpace(c.PostForm("hsn"))
+	product.Manufacturer = strings.TrimSpace(c.PostForm("manufacturer"))
+	product.GSTRate = 0
+	if value := strings.TrimSpace(c.PostForm("gst_rate")); value != "" {
+		rate, ok := parseFinite(value)
+		if !ok || rate < 0 || rate > 28 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid GST rate %q: enter a percentage from 0 to 28", value)})
+			return
+		}
+		product.GSTRate = rate
+	}
+	product.Aliases = nil
+	for _, alias := range strings.Split(c.PostForm("aliases"), "\n") {
+		if alias = strings.TrimSpace(alias); alias != "" && !catalog.HasAlias(product, alias) {
+			product.Aliases = append(product.Aliases, alias)
+		}
+	}
+
+	if product.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Product name is required"})
+		return
+	}
+
+	var err error
+	if product.ID == "" {
+		err = utils.PBCreateRecord("products", product, nil)
+	} else {
+		err = utils.PBUpdateRecord("products", product.ID, product, nil)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save product"})
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, "/products")
+}
+
+// DeleteProduct removes a product from the master
+func DeleteProduct(c *gin.Context) {
+	userID := currentUserID(c)
+
+	product, err := ownedProduct(userID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+	if err := utils.PBDeleteRecord("products", product.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete product"})
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, "/products")
+}
@@ -0,0 +1,391 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ashX04/new_website/internal/analytics"
+	"github.com/ashX04/new_website/internal/gst"
+	"github.com/ashX04/new_website/internal/inventory"
+	"github.com/ashX04/new_website/internal/models"
+	"github.com/ashX04/new_website/internal/normalise"
+	"github.com/ashX04/new_website/internal/sales"
+	"github.com/ashX04/new_website/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// saleFormRows is the number of line rows the sales invoice form offers
+const saleFormRows = 8
+
+// StockedProduct is a product offered on the sales invoice form with the
+// stock that can be sold
+type StockedProduct struct {
+	models.Product
+	InStock float64
+}
+
+// SaleLineView is a line of a printed sales invoice
+type SaleLineView struct {
+	models.SaleLine
+	No      int
+	Taxable string
+}
+
+// TaxRowView is a row of the tax summary of a printed sales invoice, per
+// rate or per HSN code and rate
+type TaxRowView struct {
+	HSN     string
+	Rate    float64
+	Taxable string
+	CGST    string
+	SGST    string
+	IGST    string
+	Tax     string
+}
+
+// listSales returns the user's sales invoices matching the extra filter
+// clauses, newest first
+func listSales(userID string, clauses ...string) ([]models.SalesInvoice, error) {
+	clauses = append([]string{fmt.Sprintf("user=%s", utils.PBQuote(userID))}, clauses...)
+	params := url.Values{}
+	params.Set("filter", "("+strings.Join(clauses, " && ")+")")
+	params.Set("sort", "-date,-number")
+	return utils.PBListAll[models.SalesInvoice]("sales_invoices", params)
+}
+
+// ownedSale fetches a sales invoice and checks that it belongs to userID
+func ownedSale(userID, id string) (*models.SalesInvoice, error) {
+	var sale models.SalesInvoice
+	if err := utils.PBGetRecord("sales_invoices", id, &sale); err != nil {
+		return nil, err
+	}
+	if sale.User != userID {
+		return nil, utils.ErrRecordNotFound
+	}
+	return &sale, nil
+}
+
+// taxRow formats the amounts of a rate total for the invoice
+func taxRow(hsn string, r gst.RateTotal) TaxRowView {
+	return TaxRowView{
+		HSN:     hsn,
+		Rate:    gst.Percent(r.Rate),
+		Taxable: analytics.Rupees(r.Taxable),
+		CGST:    analytics.Rupees(r.CGST),
+		SGST:    analytics.Rupees(r.SGST),
+		IGST:    analytics.Rupees(r.IGST),
+		Tax:     analytics.Rupees(r.Tax()),
+	}
+}
+
+// ShowSales lists the user's sales invoices with the form to issue one
+func ShowSales(c *gin.Context) {
+	userID := currentUserID(c)
+	loc := userLocation(userID)
+
+	list, err := listSales(userID)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "sales.html", gin.H{
+			"error": "Failed to load sales invoices",
+		})
+		return
+	}
+	customers, err := listCustomers(userID)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "sales.html", gin.H{
+			"error": "Failed to load customers",
+		})
+		return
+	}
+	products, err := listProducts(userID)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "sales.html", gin.H{
+			"error": "Failed to load products",
+		})
+		return
+	}
+	movements, err := listMovements(userID)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "sales.html", gin.H{
+			"error": "Failed to load stock",
+		})
+		return
+	}
+
+	// Only batches that have not expired can be sold
+	day := today(loc)
+	inStock := make(map[string]float64)
+	for _, b := range inventory.Balances(movements) {
+		if b.Quantity <= 0 {
+			continue
+		}
+		if expiresOn, ok := normalise.ParseExpiry(b.Expiry); ok && expiresOn.Before(day) {
+			continue
+		}
+		inStock[b.Product] += b.Quantity
+	}
+	stocked := make([]StockedProduct, len(products))
+	for i, p := range products {
+		stocked[i] = StockedProduct{Product: p, InStock: inStock[p.ID]}
+	}
+
+	c.HTML(http.StatusOK, "sales.html", gin.H{
+		"Sales":     list,
+		"Customers": customers,
+		"Products":  stocked,
+		"Rows":      make([]struct{}, saleFormRows),
+		"Today":     day.Format("2006-01-02"),
+	})
+}
+
+// SaveSale issues a sales invoice. Lines come as parallel product, quantity,
+// rate and discount fields; each product is taken from its batches first
+// expiring first out, one invoice line per batch. The invoice is numbered
+// in the account's series for its financial year and its stock is posted
+// to the ledger, one invoice at a time per user.
+func SaveSale(c *gin.Context) {
+	userID := currentUserID(c)
+
+	settings, err := loadSettings(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load settings"})
+		return
+	}
+	if settings.GSTIN == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Set your GSTIN under Settings before issuing sales invoices"})
+		return
+	}
+	customer, err := ownedCustomer(userID, c.PostForm("customer_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Choose a customer"})
+		return
+	}
+	if customer.State == "" {
+		// A tax invoice must state the place of supply, which decides
+		// between CGST/SGST and IGST
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Set the state of " + customer.Name + " under Customers before invoicing them"})
+		return
+	}
+	date, ok := normalise.Date(c.PostForm("date"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Enter the invoice date"})
+		return
+	}
+
+	// Stock and numbering are read and written under the lock; the unique
+	// index on (user, number) backs it up across processes
+	defer lockStock(userID)()
+
+	products, err := listProducts(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load products"})
+		return
+	}
+	byID := make(map[string]models.Product, len(products))
+	for _, p := range products {
+		byID[p.ID] = p
+	}
+	movements, err := listMovements(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load stock"})
+		return
+	}
+	balances := inventory.Balances(movements)
+
+	sale := &models.SalesInvoice{
+		User:            userID,
+		Customer:        customer.ID,
+		FinancialYear:   sales.FinancialYear(date),
+		Date:            date.Format("2006-01-02"),
+		SellerName:      settings.BusinessName,
+		SellerGSTIN:     settings.GSTIN,
+		SellerAddress:   settings.BusinessAddress,
+		CustomerName:    customer.Name,
+		CustomerGSTIN:   customer.GSTIN,
+		CustomerAddress: customer.Address,
+		PlaceOfSupply:   customer.State,
+		Status:          models.SaleIssued,
+		Note:            strings.TrimSpace(c.PostForm("note")),
+	}
+
+	productIDs := c.PostFormArray("product")
+	quantities := c.PostFormArray("quantity")
+	rates := c.PostFormArray("rate")
+	discounts := c.PostFormArray("discount")
+	for i, productID := range productIDs {
+		if productID == "" {
+			continue
+		}
+		product, ok := byID[productID]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Product not found"})
+			return
+		}
+		var quantity, rate, discount float64
+		if i < len(quantities) {
+			quantity, _ = parseFinite(quantities[i])
+		}
+		if i < len(rates) {
+			rate, _ = parseFinite(rates[i])
+		}
+		if i < len(discounts) {
+			discount, _ = parseFinite(discounts[i])
+		}
+		if quantity <= 0 || rate <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Enter a quantity and rate for " + product.Name})
+			return
+		}
+		if discount < 0 || discount >= 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid discount for " + product.Name})
+			return
+		}
+
+		allocations, err := sales.Allocate(balances, product.ID, quantity, date)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": product.Name + ": " + err.Error()})
+			return
+		}
+		for _, a := range allocations {
+			sale.Lines = append(sale.Lines, models.SaleLine{
+				Product:     product.ID,
+				ProductName: product.Name,
+				HSN:         product.HSN,
+				Batch:       a.Batch,
+				Expiry:      a.Expiry,
+				Quantity:    a.Quantity,
+				Rate:        rate,
+				Discount:    discount,
+				GSTRate:     product.GSTRate,
+			})
+		}
+	}
+	if len(sale.Lines) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Add at least one product"})
+		return
+	}
+
+	supply := gst.SupplyBetween(gst.StateCode(sale.SellerGSTIN), sale.PlaceOfSupply)
+	sale.Interstate = supply == gst.SupplyInterState
+	sale.Total = gst.Rupees(sales.Compute(sale.Lines, supply).Value)
+
+	existing, err := listSales(userID, fmt.Sprintf("financial_year=%s", utils.PBQuote(sale.FinancialYear)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to number the invoice"})
+		return
+	}
+	taken := make([]string, len(existing))
+	for i, s := range existing {
+		taken[i] = s.Number
+	}
+	sale.Number = sales.NextNumber(settings.SalesInvoicePrefix(), sale.FinancialYear, taken)
+
+	var created models.SalesInvoice
+	if err := utils.PBCreateRecord("sales_invoices", sale, &created); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save sales invoice"})
+		return
+	}
+	sale.ID = created.ID
+	if err := postMovements(sales.Movements(sale)); err != nil {
+		// An invoice without its stock movements would leave stock wrong
+		if err := utils.PBDeleteRecord("sales_invoices", sale.ID); err != nil {
+			log.Printf("Error removing sales invoice %s: %v", sale.ID, err)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to post stock movements"})
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, "/sales/"+sale.ID)
+}
+
+// ShowSale renders a sales invoice ready to print, with the tax per HSN code
+// and the amount in words
+func ShowSale(c *gin.Context) {
+	userID := currentUserID(c)
+
+	sale, err := ownedSale(userID, c.Param("id"))
+	if err != nil {
+		c.HTML(http.StatusNotFound, "sale.html", gin.H{
+			"error": "Sales invoice not found",
+		})
+		return
+	}
+	// The invoice prints as it was issued: the seller, the supply and the
+	// total were fixed then
+	supply := gst.SupplyIntraState
+	if sale.Interstate {
+		supply = gst.SupplyInterState
+	}
+	tax := sales.Compute(sale.Lines, supply)
+	value := gst.Paise(sale.Total)
+
+	lines := make([]SaleLineView, len(sale.Lines))
+	for i, l := range sale.Lines {
+		lines[i] = SaleLineView{SaleLine: l, No: i + 1, Taxable: analytics.Rupees(tax.Taxable[i])}
+	}
+	hsn := make([]TaxRowView, len(tax.HSN))
+	for i, h := range tax.HSN {
+		hsn[i] = taxRow(h.HSN, h.RateTotal)
+	}
+	date := sale.Date
+	if t, ok := normalise.Date(sale.Date); ok {
+		date = t.Format("02-01-2006")
+	}
+	placeOfSupply := sale.PlaceOfSupply
+	if name := gst.StateName(sale.PlaceOfSupply); name != "" {
+		placeOfSupply += " - " + name
+	}
+
+	c.HTML(http.StatusOK, "sale.html", gin.H{
+		"Sale":          sale,
+		"Date":          date,
+		"SellerState":   gst.StateName(gst.StateCode(sale.SellerGSTIN)),
+		"PlaceOfSupply": placeOfSupply,
+		"Interstate":    sale.Interstate,
+		"Cancelled":     sale.Status == models.SaleCancelled,
+		"Lines":         lines,
+		"HSN":           hsn,
+		"Total":         taxRow("", tax.Total),
+		"RoundOff":      analytics.Rupees(value - tax.Total.Taxable - tax.Total.Tax()),
+		"Value":         analytics.Rupees(value),
+		"InWords":       sales.InWords(value),
+		"Printed":       time.Now().In(userLocation(userID)).Format("02-01-2006 15:04"),
+	})
+}
+
+// CancelSale cancels a sales invoice and returns its stock. The invoice is
+// kept, marked cancelled, so that its number is not reused.
+func CancelSale(c *gin.Context) {
+	userID := currentUserID(c)
+
+	sale, err := ownedSale(userID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sales invoice not found"})
+		return
+	}
+	if sale.Status == models.SaleCancelled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Invoice is already cancelled"})
+		return
+	}
+
+	posted, err := listMovements(userID, fmt.Sprintf("sale=%s", utils.PBQuote(sale.ID)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load stock movements"})
+		return
+	}
+	if err := postMovements(sales.Cancellations(sale, posted)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to return stock"})
+		return
+	}
+	if err := utils.PBUpdateRecord("sales_invoices", sale.ID, map[string]interface{}{
+		"status": models.SaleCancelled,
+	}, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel invoice"})
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, "/sales/"+sale.ID)
+}
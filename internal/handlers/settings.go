@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ashX04/new_website/internal/gst"
+	"github.com/ashX04/new_website/internal/models"
+	"github.com/ashX04/new_website/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// commonTimezones are offered as suggestions on the settings page; any IANA
+// zone name is accepted
+var commonTimezones = []string{
+	"Asia/Kolkata", "Asia/Dubai", "Asia/Singapore", "Asia/Kathmandu", "Asia/Dhaka",
+	"Europe/London", "Europe/Berlin", "America/New_York", "America/Chicago",
+	"America/Los_Angeles", "Australia/Sydney", "UTC",
+}
+
+// loadSettings returns the settings of a user, or defaults if they have not
+// saved any yet
+func loadSettings(userID string) (*models.Settings, error) {
+	params := url.Values{}
+	params.Set("filter", fmt.Sprintf("(user=%s)", utils.PBQuote(userID)))
+	params.Set("perPage", "1")
+
+	resp, err := utils.PBListRecords[models.Settings]("settings", params)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Items) == 0 {
+		return &models.Settings{User: userID, Timezone: models.DefaultTimezone}, nil
+	}
+	return &resp.Items[0], nil
+}
+
+// saveSettings creates or updates the settings record of a user
+func saveSettings(settings *models.Settings) error {
+	if settings.ID == "" {
+		return utils.PBCreateRecord("settings", settings, settings)
+	}
+	return utils.PBUpdateRecord("settings", settings.ID, settings, settings)
+}
+
+// userLocation returns the time zone of a user, falling back to the
+// default if the settings cannot be loaded
+func userLocation(userID string) *time.Location {
+	settings, err := loadSettings(userID)
+	if err != nil {
+		settings = &models.Settings{}
+	}
+	return settings.Location()
+}
+
+// ShowSettings renders the account settings page
+func ShowSettings(c *gin.Context) {
+	settings, err := loadSettings(currentUserID(c))
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "settings.html", gin.H{
+			"error": "Failed to load settings",
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "settings.html", gin.H{
+		"Settings":  settings,
+		"Timezones": commonTimezones,
+		"Tally":     models.DefaultTallyLedgers,
+		"saved":     c.Query("saved") != "",
+	})
+}
+
+// parseWindows reads a comma separated list of alert windows in days
+func parseWindows(value string) ([]int, error) {
+	var windows []int
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		days, err := strconv.Atoi(part)
+		if err != nil || days <= 0 || days > 3650 {
+			return nil, fmt.Errorf("%q is not a number of days", part)
+		}
+		windows = append(windows, days)
+	}
+	sort.Ints(windows)
+	return windows, nil
+}
+
+// SaveSettings stores the account settings
+func SaveSettings(c *gin.Context) {
+	settings, err := loadSettings(currentUserID(c))
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "settings.html", gin.H{
+			"error": "Failed to load settings",
+		})
+		return
+	}
+
+	timezone := strings.TrimSpace(c.PostForm("timezone"))
+	if _, err := time.LoadLocation(timezone); err != nil || timezone == "" {
+		c.HTML(http.StatusBadRequest, "settings.html", gin.H{
+			"error":     fmt.Sprintf("Unknown time zone %q", timezone),
+			"Settings":  settings,
+			"Timezones": commonTimezones,
+			"Tally":     models.DefaultTallyLedgers,
+		})
+		return
+	}
+	settings.Timezone = timezone
+
+	gstin := gst.NormaliseGSTIN(c.PostForm("gstin"))
+	if gstin != "" && !gst.ValidGSTIN(gstin) {
+		c.HTML(http.StatusBadRequest, "settings.html", gin.H{
+			"error":     fmt.Sprintf("%q is not a valid GSTIN", gstin),
+			"Settings":  settings,
+			"Timezones": commonTimezones,
+			"Tally":     models.DefaultTallyLedgers,
+		})
+		return
+	}
+	settings.GSTIN = gstin
+	settings.BusinessName = strings.TrimSpace(c.PostForm("business_name"))
+	settings.BusinessAddress = strings.TrimSpace(c.PostForm("business_address"))
+	settings.SalesPrefix = strings.TrimSpace(c.PostForm("sales_prefix"))
+
+	windows, err := parseWindows(c.PostForm("expiry_windows"))
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "settings.html", gin.H{
+			"error":     "Invalid expiry windows: " + err.Error(),
+			"Settings":  settings,
+			"Timezones": commonTimezones,
+			"Tally":     models.DefaultTallyLedgers,
+		})
+		return
+	}
+	settings.ExpiryWindows = windows
+	settings.NotifyEmail = strings.TrimSpace(c.PostForm("notify_email"))
+
+	// An empty threshold keeps the default; 0 would flag every increase, so
+	// it is refused rather than silently read as the default
+	threshold := 0.0
+	if value := strings.TrimSpace(c.PostForm("price_alert_percent")); value != "" {
+		var ok bool
+		threshold, ok = parseFinite(value)
+		if !ok || threshold <= 0 {
+			c.HTML(http.StatusBadRequest, "settings.html", gin.H{
+				"error":     fmt.Sprintf("Invalid price alert threshold %q: enter a percentage more than 0", value),
+				"Settings":  settings,
+				"Timezones": commonTimezones,
+				"Tally":     models.DefaultTallyLedgers,
+			})
+			return
+		}
+	}
+	settings.PriceAlertPercent = threshold
+	settings.Tally = models.TallyLedgers{
+		Company:       strings.TrimSpace(c.PostForm("tally_company")),
+		VoucherType:   strings.TrimSpace(c.PostForm("tally_voucher_type")),
+		Purchase:      strings.TrimSpace(c.PostForm("tally_purchase")),
+		CGST:          strings.TrimSpace(c.PostForm("tally_cgst")),
+		SGST:          strings.TrimSpace(c.PostForm("tally_sgst")),
+		IGST:          strings.TrimSpace(c.PostForm("tally_igst")),
+		Cess:          strings.TrimSpace(c.PostForm("tally_cess")),
+		RoundOff:      strings.TrimSpace(c.PostForm("tally_round_off")),
+		WithInventory: c.PostForm("tally_with_inventory") != "",
+	}
+
+	if err := saveSettings(settings); err != nil {
+		c.HTML(http.StatusInternalServerError, "settings.html", gin.H{
+			"error":     "Failed to save settings",
+			"Settings":  settings,
+			"Timezones": commonTimezones,
+			"Tally":     models.DefaultTallyLedgers,
+		})
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, "/settings?saved=1")
+}
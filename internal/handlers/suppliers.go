@@ -0,0 +1,380 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ashX04/new_website/internal/catalog"
+	"github.com/ashX04/new_website/internal/gst"
+	"github.com/ashX04/new_website/internal/models"
+	"github.com/ashX04/new_website/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// listSuppliers returns the supplier master of a user, proposed suppliers
+// first and then by name
+func listSuppliers(userID string) ([]models.Supplier, error) {
+	params := url.Values{}
+	params.Set("filter", fmt.Sprintf("(user=%s)", utils.PBQuote(userID)))
+	params.Set("sort", "-status,name")
+	return utils.PBListAll[models.Supplier]("suppliers", params)
+}
+
+// ownedSupplier fetches a supplier and checks that it belongs to userID
+func ownedSupplier(userID, id string) (*models.Supplier, error) {
+	var supplier models.Supplier
+	if err := utils.PBGetRecord("suppliers", id, &supplier); err != nil {
+		return nil, err
+	}
+	if supplier.User != userID {
+		return nil, utils.ErrRecordNotFound
+	}
+	return &supplier, nil
+}
+
+// recogniseSupplier links an extracted invoice header to the user's supplier
+// master. A supplier not yet in the master is created as a proposal for the
+// user to approve. Failures are logged and leave the invoice unlinked.
+func recogniseSupplier(userID string, header *models.InvoiceHeader) string {
+	if header.SupplierName == "" && header.SupplierGSTIN == "" {
+		return ""
+	}
+
+	suppliers, err := listSuppliers(userID)
+	if err != nil {
+		log.Printf("Error loading suppliers for matching: %v", err)
+		return ""
+	}
+	if supplier := catalog.MatchSupplier(header, suppliers); supplier != nil {
+		return supplier.ID
+	}
+
+	proposal := models.Supplier{
+		User:   userID,
+		Name:   header.SupplierName,
+		Status: models.SupplierProposed,
+	}
+	if gst.ValidGSTIN(header.SupplierGSTIN) {
+		proposal.GSTIN = gst.NormaliseGSTIN(header.SupplierGSTIN)
+		proposal.State = gst.StateCode(proposal.GSTIN)
+	}
+	if proposal.Name == "" {
+		proposal.Name = header.SupplierGSTIN
+	}
+
+	var created models.Supplier
+	if err := utils.PBCreateRecord("suppliers", proposal, &created); err != nil {
+		log.Printf("Error proposing supplier %q: %v", proposal.Name, err)
+		return ""
+	}
+	log.Printf("Proposed new supplier %q", proposal.Name)
+	return created.ID
+}
+
+// relinkInvoices moves every invoice of a user linked to one supplier over
+// to another, or unlinks them when to is empty
+func relinkInvoices(userID, from, to string) error {
+	params := url.Values{}
+	params.Set("filter", fmt.Sprintf("(user=%s && supplier=%s)", utils.PBQuote(userID), utils.PBQuote(from)))
+	params.Set("fields", "id")
+	files, err := utils.PBListAll[models.ExcelFile]("excel_files", params)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := utils.PBUpdateRecord("excel_files", file.ID, map[string]interface{}{
+			"supplier": to,
+		}, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// relinkOrders moves the purchase orders placed with one supplier to another
+func relinkOrders(userID, from, to string) error {
+	placed, err := listOrders(userID, fmt.Sprintf("supplier=%s", utils.PBQuote(from)))
+	if err != nil {
+		return err
+	}
+	for _, order := range placed {
+		if err := utils.PBUpdateRecord("purchase_orders", order.ID, map[string]interface{}{
+			"supplier": to,
+		}, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// relinkPayments moves the payments made to one supplier to another
+func relinkPayments(userID, from, to string) error {
+	payments, err := listPayments(userID, fmt.Sprintf("supplier=%s", utils.PBQuote(from)))
+	if err != nil {
+		return err
+	}
+	for _, payment := range payments {
+		if err := utils.PBUpdateRecord("payments", payment.ID, map[string]interface{}{
+			"supplier": to,
+		}, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ShowSuppliers renders the supplier master with proposals awaiting
+// approval. With ?edit=<id> the form is filled in for that supplier.
+func ShowSuppliers(c *gin.Context) {
+	userID := currentUserID(c)
+
+	suppliers, err := listSuppliers(userID)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "suppliers.html", gin.H{
+			"error": "Failed to load suppliers",
+		})
+		return
+	}
+
+	var approved, proposed []models.Supplier
+	for _, s := range suppliers {
+		if s.Status == models.SupplierProposed {
+			proposed = append(proposed, s)
+		} else {
+			approved = append(approved, s)
+		}
+	}
+
+	edit := &models.Supplier{}
+	if id := c.Query("edit"); id != "" {
+		if s, err := ownedSupplier(userID, id); err == nil {
+			edit = s
+		}
+	}
+
+	c.HTML(http.StatusOK, "suppliers.html", gin.H{
+		"Suppliers": approved,
+		"Proposed":  proposed,
+		"Edit":      edit,
+		"States":    gst.States(),
+	})
+}
+
+// SaveSupplier creates a supplier, or updates it when the form carries an ID.
+// Suppliers entered by hand are approved straight away.
+func SaveSupplier(c *gin.Context) {
+	userID := currentUserID(c)
+
+	supplier := &models.Supplier{User: userID, Status: models.SupplierApproved}
+	if id := c.PostForm("id"); id != "" {
+		existing, err := ownedSupplier(userID, id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Supplier not found"})
+			return
+		}
+		supplier = existing
+	}
+
+	supplier.Name = strings.TrimSpace(c.PostForm("name"))
+	supplier.GSTIN = gst.NormaliseGSTIN(c.PostForm("gstin"))
+	supplier.Address = strings.TrimSpace(c.PostForm("address"))
+	supplier.State = c.PostForm("state")
+	supplier.PaymentTermsDays = 0
+	if value := strings.TrimSpace(c.PostForm("payment_terms_days")); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid payment terms %q: enter a number of days", value)})
+			return
+		}
+		supplier.PaymentTermsDays = days
+	}
+
+	if supplier.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Supplier name is required"})
+		return
+	}
+	if supplier.GSTIN != "" {
+		if !gst.ValidGSTIN(supplier.GSTIN) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid GSTIN"})
+			return
+		}
+		// The GSTIN is authoritative for the state of registration
+		supplier.State = gst.StateCode(supplier.GSTIN)
+	}
+	if gst.StateName(supplier.State) == "" {
+		supplier.State = ""
+	}
+
+	var err error
+	if supplier.ID == "" {
+		err = utils.PBCreateRecord("suppliers", supplier, nil)
+	} else {
+		err = utils.PBUpdateRecord("suppliers", supplier.ID, supplier, nil)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save supplier"})
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, "/suppliers")
+}
+
+// ApproveSupplier accepts a proposed supplier into the master
+func ApproveSupplier(c *gin.Context) {
+	userID := currentUserID(c)
+
+	supplier, err := ownedSupplier(userID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Supplier not found"})
+		return
+	}
+	if err := utils.PBUpdateRecord("suppliers", supplier.ID, map[string]interface{}{
+		"status": models.SupplierApproved,
+	}, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve supplier"})
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, "/suppliers")
+}
+
+// MergeSupplier folds a supplier into another one: its invoices, payments
+// and purchase orders are moved to the target and it is removed. Proposals
+// that duplicate an existing supplier are resolved this way.
+func MergeSupplier(c *gin.Context) {
+	userID := currentUserID(c)
+
+	supplier, err := ownedSupplier(userID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Supplier not found"})
+		return
+	}
+	target, err := ownedSupplier(userID, c.PostForm("target_id"))
+	if err != nil || target.ID == supplier.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Pick another supplier to merge into"})
+		return
+	}
+
+	if err := relinkInvoices(userID, supplier.ID, target.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move invoices"})
+		return
+	}
+	if err := relinkPayments(userID, supplier.ID, target.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move payments"})
+		return
+	}
+	if err := relinkOrders(userID, supplier.ID, target.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move purchase orders"})
+		return
+	}
+	if target.GSTIN == "" && supplier.GSTIN != "" {
+		if err := utils.PBUpdateRecord("suppliers", target.ID, map[string]interface{}{
+			"gstin": supplier.GSTIN,
+			"state": supplier.State,
+		}, nil); err != nil {
+			log.Printf("Error copying GSTIN to supplier %s: %v", target.ID, err)
+		}
+	}
+	if err := utils.PBDeleteRecord("suppliers", supplier.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove supplier"})
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, "/suppliers")
+}
+
+// DeleteSupplier removes a supplier, or rejects a proposal. Its invoices are
+// left without a supplier; suppliers with payments or purchase orders have
+// to be merged.
+func DeleteSupplier(c *gin.Context) {
+	userID := currentUserID(c)
+
+	supplier, err := ownedSupplier(userID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Supplier not found"})
+		return
+	}
+	// Payments cannot be left without a supplier account to sit on
+	payments, err := listPayments(userID, fmt.Sprintf("supplier=%s", utils.PBQuote(supplier.ID)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load payments"})
+		return
+	}
+	if len(payments) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Suppliers with payments cannot be deleted; merge them into another supplier instead"})
+		return
+	}
+	placed, err := listOrders(userID, fmt.Sprintf("supplier=%s", utils.PBQuote(supplier.ID)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load purchase orders"})
+		return
+	}
+	if len(placed) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Suppliers with purchase orders cannot be deleted; merge them into another supplier instead"})
+		return
+	}
+	if err := relinkInvoices(userID, supplier.ID, ""); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink invoices"})
+		return
+	}
+	if err := utils.PBDeleteRecord("suppliers", supplier.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete supplier"})
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, "/suppliers")
+}
+
+// LinkInvoiceSupplier changes the supplier an invoice is linked to. A
+// purchase order placed with the old supplier is unlinked.
+func LinkInvoiceSupplier(c *gin.Context) {
+	file, ok := ownedFile(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	supplierID := c.PostForm("supplier_id")
+	if supplierID != "" {
+		if _, err := ownedSupplier(file.User, supplierID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Supplier not found"})
+			return
+		}
+	}
+	if supplierID != file.Supplier {
+		// Payments were booked against the supplier the invoice is on now
+		payments, err := listPayments(file.User, fmt.Sprintf("invoice=%s", utils.PBQuote(file.ID)))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load payments"})
+			return
+		}
+		if len(payments) > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Remove the payments recorded against this invoice before changing its supplier"})
+			return
+		}
+	}
+	fields := map[string]interface{}{"supplier": supplierID}
+	// An order from another supplier cannot have delivered this invoice
+	unlinkOrder := false
+	if file.PurchaseOrder != "" && supplierID != file.Supplier {
+		order, err := ownedOrder(file.User, file.PurchaseOrder)
+		unlinkOrder = err != nil || order.Supplier != supplierID
+	}
+	if unlinkOrder {
+		fields["purchase_order"] = ""
+	}
+	if err := utils.PBUpdateRecord("excel_files", file.ID, fields, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link supplier"})
+		return
+	}
+	if unlinkOrder {
+		if err := refreshOrderStatus(file.User, file.PurchaseOrder); err != nil {
+			log.Printf("Error updating status of purchase order %s: %v", file.PurchaseOrder, err)
+		}
+	}
+
+	c.Redirect(http.StatusSeeOther, "/invoices/"+file.ID)
+}
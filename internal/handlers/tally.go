@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ashX04/new_website/internal/models"
+	"github.com/ashX04/new_website/internal/tally"
+	"github.com/gin-gonic/gin"
+)
+
+// tallyExport holds what building the vouchers of an account needs
+type tallyExport struct {
+	ledgers models.TallyLedgers
+	// gstin is the account's own GSTIN, deciding the supply of invoices
+	gstin string
+	// stockItems maps product IDs to stock item names for item invoices
+	stockItems map[string]string
+}
+
+// newTallyExport loads the ledger mapping of a user, and their products
+// when vouchers are exported with inventory
+func newTallyExport(userID string) (*tallyExport, error) {
+	settings, err := loadSettings(userID)
+	if err != nil {
+		return nil, err
+	}
+	export := &tallyExport{ledgers: settings.TallyMapping(), gstin: settings.GSTIN}
+	if export.ledgers.WithInventory {
+		products, err := listProducts(userID)
+		if err != nil {
+			return nil, err
+		}
+		export.stockItems = productNames(products)
+	}
+	return export, nil
+}
+
+// voucher builds the purchase voucher of an approved invoice, crediting the
+// supplier master's ledger where the invoice is linked to one
+func (e *tallyExport) voucher(userID string, file *models.ExcelFile) (*tally.Voucher, error) {
+	if file.Status != models.StatusApproved {
+		return nil, fmt.Errorf("invoice is not approved")
+	}
+	party := tally.Party{Ledger: strings.TrimSpace(file.SupplierName), GSTIN: file.SupplierGSTIN}
+	var supplier *models.Supplier
+	if file.Supplier != "" {
+		if s, err := ownedSupplier(userID, file.Supplier); err == nil {
+			supplier = s
+			party.Ledger = supplier.Name
+			if supplier.GSTIN != "" {
+				party.GSTIN = supplier.GSTIN
+			}
+		}
+	}
+	supply := invoiceSupply(e.gstin, file, supplier)
+	return tally.PurchaseVoucher(file, party, supply, e.stockItems, e.ledgers)
+}
+
+// sendTallyXML writes vouchers as an XML download
+func sendTallyXML(c *gin.Context, name, company string, vouchers []*tally.Voucher) {
+	var buf bytes.Buffer
+	if err := tally.Write(&buf, company, vouchers); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write Tally XML"})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", name))
+	c.Data(http.StatusOK, "application/xml; charset=utf-8", buf.Bytes())
+}
+
+// ExportTally downloads the Tally purchase voucher of an approved invoice
+func ExportTally(c *gin.Context) {
+	file, ok := ownedFile(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	userID := currentUserID(c)
+
+	export, err := newTallyExport(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load Tally settings"})
+		return
+	}
+	voucher, err := export.voucher(userID, file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot export invoice: " + err.Error()})
+		return
+	}
+
+	sendTallyXML(c, fmt.Sprintf("tally_%s.xml", file.ID), export.ledgers.Company, []*tally.Voucher{voucher})
+}
+
+// ExportTallyBatch downloads the purchase vouchers of several approved
+// invoices, given as ?files=<id>,<id>, in one import file. Nothing is
+// exported if any invoice cannot be, so that a batch is never half imported.
+func ExportTallyBatch(c *gin.Context) {
+	userID := currentUserID(c)
+
+	ids := selectionIDs(c)
+	if len(ids) > maxSelection {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Select at most %d files", maxSelection)})
+		return
+	}
+	export, err := newTallyExport(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load Tally settings"})
+		return
+	}
+
+	files, skipped := loadSelection(userID, ids)
+	var vouchers []*tally.Voucher
+	var problems []string
+	for _, s := range skipped {
+		problems = append(problems, fmt.Sprintf("%s: %s", s.ID, s.Reason))
+	}
+	for _, file := range files {
+		voucher, err := export.voucher(userID, file)
+		if err != nil {
+			label := file.InvoiceNumber
+			if label == "" {
+				label = file.ID
+			}
+			problems = append(problems, fmt.Sprintf("%s: %v", label, err))
+			continue
+		}
+		vouchers = append(vouchers, voucher)
+	}
+	if len(problems) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot export invoices: " + strings.Join(problems, "; ")})
+		return
+	}
+	if len(vouchers) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No files selected"})
+		return
+	}
+
+	sendTallyXML(c, "tally_vouchers.xml", export.ledgers.Company, vouchers)
+}
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ashX04/new_website/internal/models"
+	"github.com/ashX04/new_website/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// blankTemplateRows are the empty column rows offered on the edit form for
+// adding columns
+const blankTemplateRows = 3
+
+// columnKinds are the kinds a custom column may have
+var columnKinds = []string{models.KindText, models.KindNumber, models.KindAmount, models.KindPercent, models.KindExpiry}
+
+var slugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// listTemplates returns the output templates of a user sorted by name
+func listTemplates(userID string) ([]models.OutputTemplate, error) {
+	params := url.Values{}
+	params.Set("filter", fmt.Sprintf("(user=%s)", utils.PBQuote(userID)))
+	params.Set("sort", "name")
+	return utils.PBListAll[models.OutputTemplate]("output_templates", params)
+}
+
+// ownedTemplate fetches an output template and checks that it belongs to
+// userID
+func ownedTemplate(userID, id string) (*models.OutputTemplate, error) {
+	var tmpl models.OutputTemplate
+	if err := utils.PBGetRecord("output_templates", id, &tmpl); err != nil {
+		return nil, err
+	}
+	if tmpl.User != userID {
+		return nil, utils.ErrRecordNotFound
+	}
+	return &tmpl, nil
+}
+
+// activeColumns returns the columns new uploads of a user are extracted
+// with. Failing to load the template falls back to the default columns.
+func activeColumns(userID string) []models.TemplateColumn {
+	settings, err := loadSettings(userID)
+	if err != nil {
+		log.Printf("Error loading settings for output template: %v", err)
+		return models.DefaultTemplateColumns
+	}
+	if settings.OutputTemplate == "" {
+		return models.DefaultTemplateColumns
+	}
+	tmpl, err := ownedTemplate(userID, settings.OutputTemplate)
+	if err != nil || len(tmpl.Columns) == 0 {
+		log.Printf("Error loading output template %s: %v", settings.OutputTemplate, err)
+		return models.DefaultTemplateColumns
+	}
+	return tmpl.Columns
+}
+
+// templateRow is a column of the edit form
+type templateRow struct {
+	Position int
+	// Custom is set for custom columns, which are not among the standard
+	// fields offered
+	Custom bool
+	models.TemplateColumn
+}
+
+// ShowTemplates renders the output templates of the account. With
+// ?edit=<id> the form is filled in for that template, and with ?edit=new
+// for a new one starting from the default columns.
+func ShowTemplates(c *gin.Context) {
+	userID := currentUserID(c)
+
+	templates, err := listTemplates(userID)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "output_templates.html", gin.H{
+			"error": "Failed to load templates",
+		})
+		return
+	}
+	settings, err := loadSettings(userID)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "output_templates.html", gin.H{
+			"error": "Failed to load settings",
+		})
+		return
+	}
+
+	var edit *models.OutputTemplate
+	switch id := c.Query("edit"); id {
+	case "":
+	case "new":
+		edit = &models.OutputTemplate{Columns: models.DefaultTemplateColumns}
+	default:
+		if t, err := ownedTemplate(userID, id); err == nil {
+			edit = t
+		}
+	}
+
+	var rows []templateRow
+	if edit != nil {
+		for i, col := range edit.Columns {
+			rows = append(rows, templateRow{Position: i + 1, Custom: models.IsCustomField(col.Field), TemplateColumn: col})
+		}
+		for i := 0; i < blankTemplateRows; i++ {
+			rows = append(rows, templateRow{Position: len(edit.Columns) + i + 1})
+		}
+	}
+
+	c.HTML(http.StatusOK, "output_templates.html", gin.H{
+		"Templates":  templates,
+		"Active":     settings.OutputTemplate,
+		"Edit":       edit,
+		"Rows":       rows,
+		"LineFields": models.LineFields,
+		"Kinds":      columnKinds,
+	})
+}
+
+// templateColumnsFromForm reads the column rows of the edit form. Rows are
+// ordered by position; rows without a field are dropped.
+func templateColumnsFromForm(c *gin.Context) ([]models.TemplateColumn, error) {
+	fields := c.PostFormArray("field")
+	names := c.PostFormArray("name")
+	descriptions := c.PostFormArray("description")
+	kinds := c.PostFormArray("kind")
+	positions := c.PostFormArray("position")
+	required := make(map[string]bool)
+	for _, i := range c.PostFormArray("required") {
+		required[i] = true
+	}
+	at := func(values []string, i int) string {
+		if i < len(values) {
+			return strings.TrimSpace(values[i])
+		}
+		return ""
+	}
+
+	type positioned struct {
+		pos int
+		col models.TemplateColumn
+	}
+	var rows []positioned
+	seen := make(map[string]string)
+	hasProduct := false
+	for i, field := range fields {
+		col := models.TemplateColumn{
+			Field:       strings.TrimSpace(field),
+			Name:        at(names, i),
+			Description: at(descriptions, i),
+			Kind:        at(kinds, i),
+			Required:    required[strconv.Itoa(i)],
+		}
+		switch {
+		case col.Field == "":
+			continue
+		case col.Field == "custom":
+			if col.Name == "" {
+				return nil, fmt.Errorf("custom columns need a name")
+			}
+			slug := strings.Trim(slugChars.ReplaceAllString(strings.ToLower(col.Name), "_"), "_")
+			if slug == "" {
+				// The name becomes the field, so it must carry a letter or digit
+				return nil, fmt.Errorf("custom column %q needs a letter or digit in its name", col.Name)
+			}
+			col.Field = models.CustomFieldPrefix + slug
+			if !validKind(col.Kind) {
+				col.Kind = models.KindText
+			}
+		case models.IsCustomField(col.Field):
+			// An existing custom column keeps its field name
+			if col.Field == models.CustomFieldPrefix {
+				return nil, fmt.Errorf("custom column %q needs a letter or digit in its name", col.Name)
+			}
+			if !validKind(col.Kind) {
+				col.Kind = models.KindText
+			}
+		default:
+			standard, ok := models.LineField(col.Field)
+			if !ok {
+				return nil, fmt.Errorf("unknown field %q", col.Field)
+			}
+			// Standard fields always have their own kind
+			col.Kind = standard.Kind
+			if col.Name == "" {
+				col.Name = standard.Name
+			}
+		}
+		if name, ok := seen[col.Field]; ok {
+			if name != col.Name {
+				// Custom names that differ only in symbols share a field
+				return nil, fmt.Errorf("%s and %s would be the same column; rename one", name, col.Name)
+			}
+			return nil, fmt.Errorf("%s is listed twice", col.Name)
+		}
+		seen[col.Field] = col.Name
+		if col.Field == "product_name" {
+			// Lines are recognised by their product name
+			hasProduct = true
+			col.Required = true
+		}
+
+		pos, err := strconv.Atoi(at(positions, i))
+		if err != nil {
+			pos = len(fields) + i
+		}
+		rows = append(rows, positioned{pos: pos, col: col})
+	}
+	if !hasProduct {
+		return nil, fmt.Errorf("the product name column is required")
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].pos < rows[j].pos })
+	columns := make([]models.TemplateColumn, len(rows))
+	for i, row := range rows {
+		columns[i] = row.col
+	}
+	return columns, nil
+}
+
+func validKind(kind string) bool {
+	for _, k := range columnKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// SaveTemplate creates an output template, or updates it when the form
+// carries an ID. Invoices already processed keep the columns they were
+// extracted with.
+func SaveTemplate(c *gin.Context) {
+	userID := currentUserID(c)
+
+	tmpl := &models.OutputTemplate{User: userID}
+	if id := c.PostForm("id"); id != "" {
+		existing, err := ownedTemplate(userID, id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+			return
+		}
+		tmpl = existing
+	}
+
+	tmpl.Name = strings.TrimSpace(c.PostForm("template_name"))
+	if tmpl.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Template name is required"})
+		return
+	}
+	columns, err := templateColumnsFromForm(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid columns: " + err.Error()})
+		return
+	}
+	tmpl.Columns = columns
+
+	if tmpl.ID == "" {
+		err = utils.PBCreateRecord("output_templates", tmpl, nil)
+	} else {
+		err = utils.PBUpdateRecord("output_templates", tmpl.ID, tmpl, nil)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save template"})
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, "/output-templates")
+}
+
+// UseTemplate makes a template the one new uploads are extracted with. An
+// empty ID switches back to the default columns.
+func UseTemplate(c *gin.Context) {
+	userID := currentUserID(c)
+
+	id := c.PostForm("template_id")
+	if id != "" {
+		if _, err := ownedTemplate(userID, id); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+			return
+		}
+	}
+	settings, err := loadSettings(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load settings"})
+		return
+	}
+	settings.OutputTemplate = id
+	if err := saveSettings(settings); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save settings"})
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, "/output-templates")
+}
+
+// DeleteTemplate removes an output template. If it was in use, new uploads
+// go back to the default columns.
+func DeleteTemplate(c *gin.Context) {
+	userID := currentUserID(c)
+
+	tmpl, err := ownedTemplate(userID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+	if err := utils.PBDeleteRecord("output_templates", tmpl.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete template"})
+		return
+	}
+
+	if settings, err := loadSettings(userID); err == nil && settings.OutputTemplate == tmpl.ID {
+		settings.OutputTemplate = ""
+		if err := saveSettings(settings); err != nil {
+			log.Printf("Error clearing output template of %s: %v", userID, err)
+		}
+	}
+
+	c.Redirect(http.StatusSeeOther, "/output-templates")
+}
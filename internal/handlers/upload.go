@@ -1,34 +1,40 @@
 package handlers
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
 	"log"
+	"mime"
 	"mime/multipart"
 	"net/http"
+	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 
+	"github.com/ashX04/new_website/internal/models"
+	"github.com/ashX04/new_website/internal/storage"
+	"github.com/ashX04/new_website/internal/utils"
+	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 )
 
 // UploadImage handles the uploading of multiple images
 func UploadImage(c *gin.Context) {
 	// Get user ID from session first
-	session, err := store.Get(c.Request, "session-name")
-	if err != nil {
+	session := sessions.Default(c)
+	userID, ok := session.Get("userID").(string)
+	if !ok {
 		c.HTML(http.StatusUnauthorized, "upload.html", gin.H{
-			"error": "Session error, please login again",
+			"error": "User not authenticated, please login again",
 		})
 		return
 	}
 
-	userID, ok := session.Values["userID"].(string)
-	if !ok {
-		c.HTML(http.StatusUnauthorized, "upload.html", gin.H{
-			"error": "User not authenticated, please login again",
+	uploadDir, err := utils.UserUploadDir(userID)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "upload.html", gin.H{
+			"error": "Failed to prepare upload storage",
 		})
 		return
 	}
@@ -50,6 +56,15 @@ func UploadImage(c *gin.Context) {
 		return
 	}
 
+	for _, file := range files {
+		if !utils.ValidateUploadType(file.Filename) {
+			c.HTML(http.StatusBadRequest, "upload.html", gin.H{
+				"error": fmt.Sprintf("%s is not a supported file type. Upload images or PDF documents.", filepath.Base(file.Filename)),
+			})
+			return
+		}
+	}
+
 	var wg sync.WaitGroup
 	errorChan := make(chan error, len(files))
 
@@ -58,79 +73,42 @@ func UploadImage(c *gin.Context) {
 		go func(file *multipart.FileHeader) {
 			defer wg.Done()
 
+			// Store under a random name in the user's directory so that
+			// uploads sharing a filename never overwrite each other
 			filename := filepath.Base(file.Filename)
-			filePath := fmt.Sprintf("./uploads/%s", filename)
-			if err := c.SaveUploadedFile(file, filePath); err != nil {
+			filePath := filepath.Join(uploadDir, utils.NewStorageID()+strings.ToLower(filepath.Ext(filename)))
+			if err := saveUploadedFile(file, filePath); err != nil {
 				errorChan <- fmt.Errorf("failed to save file %s: %v", filename, err)
 				return
 			}
+			defer os.Remove(filePath)
 
-			// Prepare file data for PocketBase
-			fileData := &bytes.Buffer{}
-			writer := multipart.NewWriter(fileData)
-
-			// Add user ID field
-			if err := writer.WriteField("user", userID); err != nil {
-				errorChan <- fmt.Errorf("failed to write user field for %s: %v", filename, err)
+			// Keep the source image or PDF in the blob store
+			keys := uploadKeys(userID, filePath)
+			if err := putBlobFile(keys.Source, filePath); err != nil {
+				errorChan <- fmt.Errorf("failed to store file %s: %v", filename, err)
 				return
 			}
 
-			// Add image file
-			part, err := writer.CreateFormFile("image", filename)
-			if err != nil {
-				errorChan <- fmt.Errorf("failed to create form file for %s: %v", filename, err)
-				return
-			}
-
-			// Open and copy file contents
-			src, err := file.Open()
-			if err != nil {
-				errorChan <- fmt.Errorf("failed to open file %s: %v", filename, err)
-				return
-			}
-			defer src.Close()
-
-			if _, err := io.Copy(part, src); err != nil {
-				errorChan <- fmt.Errorf("failed to copy file contents for %s: %v", filename, err)
-				return
-			}
-
-			writer.Close()
-
-			// Send request to PocketBase
-			req, err := http.NewRequest("POST", "http://localhost:8090/api/collections/images/records", fileData)
+			// Create the image record in PocketBase
+			var image models.ImageFile
+			err := utils.PBCreateRecord("images", map[string]interface{}{
+				"user":      userID,
+				"image_key": keys.Source,
+			}, &image)
 			if err != nil {
-				errorChan <- fmt.Errorf("failed to create request for %s: %v", filename, err)
-				return
-			}
-
-			req.Header.Set("Content-Type", writer.FormDataContentType())
-
-			client := &http.Client{}
-			resp, err := client.Do(req)
-			if err != nil {
-				errorChan <- fmt.Errorf("failed to upload %s to PocketBase: %v", filename, err)
-				return
-			}
-			defer resp.Body.Close()
-
-			// Read and parse the response to get imageID
-			var pbResponse struct {
-				Id string `json:"id"`
-			}
-			if err := json.NewDecoder(resp.Body).Decode(&pbResponse); err != nil {
-				errorChan <- fmt.Errorf("failed to decode PocketBase response for %s: %v", filename, err)
+				errorChan <- fmt.Errorf("failed to create image record for %s: %v", filename, err)
 				return
 			}
 
 			// Process the image with the obtained imageID
-			csvData, err := ProcessImage(filePath, userID, pbResponse.Id)
+			excelKey, err := ProcessImage(filePath, userID, image.ID)
 			if err != nil {
 				errorChan <- fmt.Errorf("failed to process image %s: %v", filename, err)
 				return
 			}
 
-			log.Printf("File %s processed successfully. CSV Data: %s", filename, csvData)
+			log.Printf("File %s processed successfully. Excel key: %s", filename, excelKey)
 
 		}(file)
 	}
@@ -156,3 +134,46 @@ func UploadImage(c *gin.Context) {
 
 	c.Redirect(http.StatusSeeOther, "/dashboard")
 }
+
+// artifactKeys holds the blob keys of everything produced for one upload
+type artifactKeys struct {
+	Source    string
+	Processed string
+	OCR       string
+	Excel     string
+}
+
+// uploadKeys derives the blob keys for an upload from its staged file path,
+// whose base name is the upload's storage ID
+func uploadKeys(userID, filePath string) artifactKeys {
+	ext := filepath.Ext(filePath)
+	storageID := strings.TrimSuffix(filepath.Base(filePath), ext)
+	return artifactKeys{
+		Source:    storage.Key(userID, storageID, "source"+ext),
+		Processed: storage.Key(userID, storageID, "processed.jpg"),
+		OCR:       storage.Key(userID, storageID, "ocr.json"),
+		Excel:     storage.Key(userID, storageID, "invoice.xlsx"),
+	}
+}
+
+// putBlobFile copies a local file into the blob store
+func putBlobFile(key, filePath string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return storage.Default.Put(context.Background(), key, f, mime.TypeByExtension(filepath.Ext(filePath)))
+}
+
+// saveUploadedFile atomically copies an uploaded file to dst
+func saveUploadedFile(file *multipart.FileHeader, dst string) error {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	return utils.WriteFileAtomic(dst, src)
+}
@@ -0,0 +1,420 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ashX04/new_website/internal/export"
+	"github.com/ashX04/new_website/internal/gst"
+	"github.com/ashX04/new_website/internal/models"
+	"github.com/ashX04/new_website/internal/normalise"
+	"github.com/xuri/excelize/v2"
+)
+
+// Workbook sheet names
+const (
+	itemsSheet      = "Items"
+	invoiceSheet    = "Invoice"
+	validationSheet = "Validation"
+	metaSheet       = "Metadata"
+)
+
+// workbookVersion is written to the metadata sheet so that tools reading
+// the workbook back can tell layouts apart
+const workbookVersion = "2"
+
+// sheetColumn is one column of the Items sheet
+type sheetColumn struct {
+	// Field is the JSON name of the invoice line field shown
+	Field string
+	Name  string
+	Kind  normalise.Kind
+	Width float64
+	// Total adds the column to the totals row
+	Total bool
+}
+
+// fieldWidths are the column widths of standard fields on the Items sheet;
+// other columns are defaultColumnWidth wide
+var fieldWidths = map[string]float64{
+	"serial_no": 6, "quantity": 8, "free": 6, "pack": 10, "hsn": 10, "product_name": 36,
+	"manufacturer": 20, "batch": 12, "expiry": 9, "mrp": 11, "rate": 11, "discount": 9,
+	"scheme": 10, "gst": 8, "cgst": 8, "sgst": 8, "igst": 8, "cess": 8, "amount": 14,
+}
+
+const defaultColumnWidth = 14
+
+// sheetColumns lays out the Items sheet for the columns of an output
+// template. Quantities and amounts are totalled.
+func sheetColumns(columns []models.TemplateColumn) []sheetColumn {
+	layout := make([]sheetColumn, len(columns))
+	for i, col := range columns {
+		width, ok := fieldWidths[col.Field]
+		if !ok {
+			width = defaultColumnWidth
+		}
+		kind := normalise.Kind(col.Kind)
+		layout[i] = sheetColumn{
+			Field: col.Field,
+			Name:  col.Name,
+			Kind:  kind,
+			Width: width,
+			Total: kind == normalise.KindAmount || col.Field == "quantity" || col.Field == "free",
+		}
+	}
+	return layout
+}
+
+// workbookStyles are the cell styles of a workbook, created once per file
+type workbookStyles struct {
+	header int
+	label  int
+	kinds  map[normalise.Kind]int
+	totals map[normalise.Kind]int
+}
+
+func newWorkbookStyles(f *excelize.File) (*workbookStyles, error) {
+	border := []excelize.Border{{Type: "bottom", Color: "8EA9DB", Style: 1}}
+	header, err := f.NewStyle(&excelize.Style{
+		Font:      &excelize.Font{Bold: true, Color: "1F3864"},
+		Fill:      excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"D9E1F2"}},
+		Border:    border,
+		Alignment: &excelize.Alignment{Vertical: "center", WrapText: true},
+	})
+	if err != nil {
+		return nil, err
+	}
+	label, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return nil, err
+	}
+
+	styles := &workbookStyles{
+		header: header,
+		label:  label,
+		kinds:  make(map[normalise.Kind]int, len(export.NumFmts)),
+		totals: make(map[normalise.Kind]int, len(export.NumFmts)),
+	}
+	top := []excelize.Border{{Type: "top", Color: "000000", Style: 1}}
+	for kind, numFmt := range export.NumFmts {
+		numFmt := numFmt
+		if styles.kinds[kind], err = f.NewStyle(&excelize.Style{CustomNumFmt: &numFmt}); err != nil {
+			return nil, err
+		}
+		if styles.totals[kind], err = f.NewStyle(&excelize.Style{
+			CustomNumFmt: &numFmt,
+			Font:         &excelize.Font{Bold: true},
+			Border:       top,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return styles, nil
+}
+
+// buildWorkbook writes the workbook of a processed invoice: the line items
+// in the columns of its output template, the invoice header, validation
+// checks against its supply and a hidden sheet linking back to the record
+func buildWorkbook(file *models.ExcelFile, supply gst.Supply) (*excelize.File, error) {
+	columns := sheetColumns(file.LineColumns())
+	f := excelize.NewFile()
+	styles, err := newWorkbookStyles(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to create styles: %w", err)
+	}
+
+	if err := f.SetSheetName("Sheet1", itemsSheet); err != nil {
+		f.Close()
+		return nil, err
+	}
+	totalRow, err := writeItemsSheet(f, styles, columns, file.Lines)
+	if err == nil {
+		err = writeInvoiceHeaderSheet(f, styles, columns, file, supply, totalRow)
+	}
+	if err == nil {
+		err = writeValidationSheet(f, styles, columns, file, supply, totalRow)
+	}
+	if err == nil {
+		err = writeMetaSheet(f, file)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// columnOf returns the column letter of a line field on the Items sheet, or
+// "" if the template has no such column
+func columnOf(columns []sheetColumn, field string) string {
+	for i, col := range columns {
+		if col.Field == field {
+			name, _ := excelize.ColumnNumberToName(i + 1)
+			return name
+		}
+	}
+	return ""
+}
+
+// writeItemsSheet writes one row per line under a styled, frozen header row,
+// followed by a totals row with SUM formulas. It returns the totals row.
+func writeItemsSheet(f *excelize.File, styles *workbookStyles, columns []sheetColumn, lines []models.InvoiceLine) (int, error) {
+	for i, col := range columns {
+		name, _ := excelize.ColumnNumberToName(i + 1)
+		if err := f.SetCellValue(itemsSheet, name+"1", col.Name); err != nil {
+			return 0, err
+		}
+		if err := f.SetColWidth(itemsSheet, name, name, col.Width); err != nil {
+			return 0, err
+		}
+	}
+	last, _ := excelize.ColumnNumberToName(len(columns))
+	if err := f.SetCellStyle(itemsSheet, "A1", last+"1", styles.header); err != nil {
+		return 0, err
+	}
+	if err := f.SetPanes(itemsSheet, &excelize.Panes{
+		Freeze:      true,
+		YSplit:      1,
+		TopLeftCell: "A2",
+		ActivePane:  "bottomLeft",
+	}); err != nil {
+		return 0, err
+	}
+
+	for i := range lines {
+		row := i + 2
+		for j, col := range columns {
+			cell, _ := excelize.CoordinatesToCellName(j+1, row)
+			value := normalise.Cell(col.Kind, lines[i].Field(col.Field))
+			if err := f.SetCellValue(itemsSheet, cell, value); err != nil {
+				return 0, err
+			}
+			// Cells left as text keep the default style
+			if _, isText := value.(string); !isText {
+				if err := f.SetCellStyle(itemsSheet, cell, cell, styles.kinds[col.Kind]); err != nil {
+					return 0, err
+				}
+			}
+		}
+	}
+
+	totalRow := len(lines) + 2
+	for j, col := range columns {
+		name, _ := excelize.ColumnNumberToName(j + 1)
+		cell := fmt.Sprintf("%s%d", name, totalRow)
+		switch {
+		case col.Total && len(lines) == 0:
+			// There is no item range to sum, and SUM(X2:X2) would refer to
+			// the total cell itself
+			if err := f.SetCellValue(itemsSheet, cell, 0); err != nil {
+				return 0, err
+			}
+		case col.Total:
+			formula := fmt.Sprintf("SUM(%s2:%s%d)", name, name, totalRow-1)
+			if err := f.SetCellFormula(itemsSheet, cell, formula); err != nil {
+				return 0, err
+			}
+		case col.Field == "product_name":
+			if err := f.SetCellValue(itemsSheet, cell, "Total"); err != nil {
+				return 0, err
+			}
+		}
+		if err := f.SetCellStyle(itemsSheet, cell, cell, styles.totals[col.Kind]); err != nil {
+			return 0, err
+		}
+	}
+
+	// Warn when a value typed into a numeric column is not a number
+	for j, col := range columns {
+		if len(lines) == 0 {
+			break
+		}
+		if col.Kind != normalise.KindAmount && col.Kind != normalise.KindPercent {
+			continue
+		}
+		name, _ := excelize.ColumnNumberToName(j + 1)
+		dv := excelize.NewDataValidation(true)
+		dv.SetSqref(fmt.Sprintf("%s2:%s%d", name, name, totalRow-1))
+		if err := dv.SetRange(0, 1e12, excelize.DataValidationTypeDecimal, excelize.DataValidationOperatorBetween); err != nil {
+			return 0, err
+		}
+		dv.SetError(excelize.DataValidationErrorStyleWarning, "Not a number", col.Name+" should be a number of 0 or more")
+		if err := f.AddDataValidation(itemsSheet, dv); err != nil {
+			return 0, err
+		}
+	}
+	return totalRow, nil
+}
+
+// writeInvoiceHeaderSheet writes the extracted header fields next to the
+// items total, so that the two can be compared at a glance
+func writeInvoiceHeaderSheet(f *excelize.File, styles *workbookStyles, columns []sheetColumn, file *models.ExcelFile, supply gst.Supply, totalRow int) error {
+	if _, err := f.NewSheet(invoiceSheet); err != nil {
+		return err
+	}
+
+	var date interface{} = file.InvoiceDate
+	if t, ok := normalise.Date(file.InvoiceDate); ok {
+		date = t
+	}
+	rows := []struct {
+		label string
+		value interface{}
+		kind  normalise.Kind
+	}{
+		{"Supplier", file.SupplierName, normalise.KindText},
+		{"GSTIN", file.SupplierGSTIN, normalise.KindText},
+		{"Invoice number", file.InvoiceNumber, normalise.KindText},
+		{"Invoice date", date, normalise.KindText},
+		{"Invoice total", file.InvoiceTotal, normalise.KindAmount},
+		{"Items total", nil, normalise.KindAmount},
+		{"Difference", nil, normalise.KindAmount},
+		{"Pages", file.Pages, normalise.KindText},
+		{"Buyer GSTIN", file.BuyerGSTIN, normalise.KindText},
+		{"Supply", supply.String(), normalise.KindText},
+	}
+	for i, row := range rows {
+		r := i + 1
+		if err := f.SetCellValue(invoiceSheet, fmt.Sprintf("A%d", r), row.label); err != nil {
+			return err
+		}
+		if err := f.SetCellValue(invoiceSheet, fmt.Sprintf("B%d", r), row.value); err != nil {
+			return err
+		}
+		if row.kind != normalise.KindText {
+			if err := f.SetCellStyle(invoiceSheet, fmt.Sprintf("B%d", r), fmt.Sprintf("B%d", r), styles.kinds[row.kind]); err != nil {
+				return err
+			}
+		}
+	}
+	if _, isDate := date.(time.Time); isDate {
+		dateFmt := "dd-mm-yyyy"
+		style, err := f.NewStyle(&excelize.Style{CustomNumFmt: &dateFmt})
+		if err != nil {
+			return err
+		}
+		if err := f.SetCellStyle(invoiceSheet, "B4", "B4", style); err != nil {
+			return err
+		}
+	}
+	// Templates without an amount column have no items total to compare
+	if amount := columnOf(columns, "amount"); amount != "" {
+		if err := f.SetCellFormula(invoiceSheet, "B6", fmt.Sprintf("%s!%s%d", itemsSheet, amount, totalRow)); err != nil {
+			return err
+		}
+		if err := f.SetCellFormula(invoiceSheet, "B7", "B5-B6"); err != nil {
+			return err
+		}
+	}
+	if err := f.SetCellStyle(invoiceSheet, "A1", fmt.Sprintf("A%d", len(rows)), styles.label); err != nil {
+		return err
+	}
+	if err := f.SetColWidth(invoiceSheet, "A", "A", 18); err != nil {
+		return err
+	}
+	return f.SetColWidth(invoiceSheet, "B", "B", 40)
+}
+
+// writeValidationSheet lists checks on the extracted data as live formulas,
+// so that they update when a reviewer corrects a cell
+func writeValidationSheet(f *excelize.File, styles *workbookStyles, columns []sheetColumn, file *models.ExcelFile, supply gst.Supply, totalRow int) error {
+	if _, err := f.NewSheet(validationSheet); err != nil {
+		return err
+	}
+
+	// Item rows run from 2 to the row above the totals; with no lines there
+	// are none, and the range checks are left out
+	lastRow := totalRow - 1
+	hasItems := lastRow >= 2
+	itemRange := func(col string) string {
+		return fmt.Sprintf("%s!%s2:%s%d", itemsSheet, col, col, lastRow)
+	}
+	unlinked, mistaxed := 0, 0
+	for _, line := range file.Lines {
+		if line.ProductID == "" && !line.MatchConfirmed {
+			unlinked++
+		}
+		if len(gst.LineProblems(normalise.Line(line), supply)) > 0 {
+			mistaxed++
+		}
+	}
+
+	type check struct {
+		name    string
+		formula string
+		ok      string
+	}
+	var checks []check
+	if columnOf(columns, "amount") != "" {
+		checks = append(checks, check{"Invoice total minus items total", invoiceSheet + "!B7", "ABS(B%d)<=1"})
+	}
+	// Only columns the template has are checked
+	for _, numeric := range []struct{ field, name string }{
+		{"amount", "Amounts that are not numbers"},
+		{"rate", "Rates that are not numbers"},
+		{"expiry", "Expiries that are not dates"},
+	} {
+		if col := columnOf(columns, numeric.field); col != "" && hasItems {
+			checks = append(checks, check{numeric.name, fmt.Sprintf("COUNTA(%[1]s)-COUNT(%[1]s)", itemRange(col)), "B%d=0"})
+		}
+	}
+	for i, col := range file.LineColumns() {
+		if !col.Required || !hasItems {
+			continue
+		}
+		name, _ := excelize.ColumnNumberToName(i + 1)
+		checks = append(checks, check{"Lines without " + col.Name, fmt.Sprintf("COUNTBLANK(%s)", itemRange(name)), "B%d=0"})
+	}
+	if columnOf(columns, "cgst") != "" || columnOf(columns, "sgst") != "" || columnOf(columns, "igst") != "" {
+		checks = append(checks, check{"Lines whose tax does not fit the supply", fmt.Sprint(mistaxed), "B%d=0"})
+	}
+	checks = append(checks, check{"Lines not linked to the product master", fmt.Sprint(unlinked), "B%d=0"})
+
+	for i, header := range []string{"Check", "Value", "Result"} {
+		cell, _ := excelize.CoordinatesToCellName(i+1, 1)
+		if err := f.SetCellValue(validationSheet, cell, header); err != nil {
+			return err
+		}
+	}
+	if err := f.SetCellStyle(validationSheet, "A1", "C1", styles.header); err != nil {
+		return err
+	}
+	for i, check := range checks {
+		r := i + 2
+		if err := f.SetCellValue(validationSheet, fmt.Sprintf("A%d", r), check.name); err != nil {
+			return err
+		}
+		if err := f.SetCellFormula(validationSheet, fmt.Sprintf("B%d", r), check.formula); err != nil {
+			return err
+		}
+		ok := fmt.Sprintf(check.ok, r)
+		if err := f.SetCellFormula(validationSheet, fmt.Sprintf("C%d", r), fmt.Sprintf(`IF(%s,"OK","CHECK")`, ok)); err != nil {
+			return err
+		}
+	}
+	if err := f.SetColWidth(validationSheet, "A", "A", 40); err != nil {
+		return err
+	}
+	return f.SetColWidth(validationSheet, "B", "C", 12)
+}
+
+// writeMetaSheet writes a hidden sheet that ties the workbook back to its
+// excel_files record
+func writeMetaSheet(f *excelize.File, file *models.ExcelFile) error {
+	if _, err := f.NewSheet(metaSheet); err != nil {
+		return err
+	}
+	rows := [][2]string{
+		{"record_id", file.ID},
+		{"source_key", file.ImageKey},
+		{"generated_at", time.Now().UTC().Format(time.RFC3339)},
+		{"workbook_version", workbookVersion},
+	}
+	for i, row := range rows {
+		if err := f.SetSheetRow(metaSheet, fmt.Sprintf("A%d", i+1), &[]string{row[0], row[1]}); err != nil {
+			return err
+		}
+	}
+	return f.SetSheetVisible(metaSheet, false)
+}
@@ -0,0 +1,388 @@
+// Package imageproc cleans up photographed invoices before they are sent to
+// OCR: it applies the EXIF orientation, turns sideways pages upright, crops
+// to the page, deskews, normalises contrast and scales the result to the OCR
+// provider's limits. Perspective is not corrected beyond cropping and
+// deskewing; the OCR provider copes well with mild keystone distortion.
+package imageproc
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"math"
+	"math/bits"
+
+	"github.com/disintegration/imaging"
+)
+
+const (
+	// MaxDimension is the longest side sent to OCR. Azure Read accepts up to
+	// 10000px, but beyond this size text is already legible and files
+	// quickly exceed MaxBytes.
+	MaxDimension = 4200
+	// MinDimension is the shortest side Azure Read accepts
+	MinDimension = 50
+	// MaxBytes is the largest file Azure Read accepts on the free tier
+	MaxBytes = 4 << 20
+	// MaxPixels is the largest image Preprocess decodes. The header is read
+	// first, as a small file can declare dimensions that take gigabytes to
+	// decode.
+	MaxPixels = 50_000_000
+
+	// analysisSize is the longest side of the copy used to estimate
+	// orientation, skew and page bounds
+	analysisSize = 1000
+	// maxSkew is the largest skew angle in degrees that deskew corrects
+	maxSkew = 10.0
+)
+
+// Result describes what Preprocess did to an image
+type Result struct {
+	Image   image.Image
+	Rotated int     // quarter turns applied to make text lines horizontal
+	Skew    float64 // degrees of skew removed
+	Cropped bool
+}
+
+// Preprocess decodes an image and prepares it for OCR
+func Preprocess(r io.Reader) (*Result, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > MaxPixels {
+		return nil, fmt.Errorf("image is too large (%dx%d)", cfg.Width, cfg.Height)
+	}
+
+	// AutoOrientation applies the EXIF orientation tag written by phones
+	img, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	bounds := img.Bounds()
+	if bounds.Dx() < MinDimension || bounds.Dy() < MinDimension {
+		return nil, fmt.Errorf("image is too small (%dx%d)", bounds.Dx(), bounds.Dy())
+	}
+
+	res := &Result{}
+	gray := imaging.Grayscale(img)
+
+	// Turn the page so that text lines run horizontally. OCR reads upside
+	// down text fine, so only sideways pages are corrected.
+	if isSideways(toGray(imaging.Fit(gray, analysisSize, analysisSize, imaging.Box))) {
+		gray = imaging.Rotate270(gray)
+		res.Rotated = 1
+	}
+
+	// Crop away the table or background around the page first, so that it
+	// does not dominate the skew estimate
+	small := toGray(imaging.Fit(gray, analysisSize, analysisSize, imaging.Box))
+	if rect, ok := pageBounds(small); ok {
+		scale := float64(gray.Bounds().Dx()) / float64(small.Bounds().Dx())
+		crop := image.Rect(
+			int(float64(rect.Min.X)*scale), int(float64(rect.Min.Y)*scale),
+			int(float64(rect.Max.X)*scale), int(float64(rect.Max.Y)*scale),
+		)
+		gray = imaging.Crop(gray, crop)
+		res.Cropped = true
+		small = toGray(imaging.Fit(gray, analysisSize, analysisSize, imaging.Box))
+	}
+
+	// Remove small skew angles left over from hand-held photos
+	if angle := math.Round(estimateSkew(small)*10) / 10; math.Abs(angle) >= 0.2 {
+		gray = imaging.Rotate(gray, angle, color.White)
+		res.Skew = angle
+	}
+
+	out := stretchContrast(toGray(gray))
+
+	b := out.Bounds()
+	if b.Dx() > MaxDimension || b.Dy() > MaxDimension {
+		res.Image = imaging.Fit(out, MaxDimension, MaxDimension, imaging.Lanczos)
+	} else {
+		res.Image = out
+	}
+	return res, nil
+}
+
+// EncodeJPEG encodes img as a JPEG no larger than MaxBytes, lowering the
+// quality as needed
+func EncodeJPEG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	for quality := 90; quality >= 40; quality -= 10 {
+		buf.Reset()
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, fmt.Errorf("failed to encode image: %w", err)
+		}
+		if buf.Len() <= MaxBytes {
+			return buf.Bytes(), nil
+		}
+	}
+	return nil, fmt.Errorf("image does not fit in %d bytes", MaxBytes)
+}
+
+func toGray(img image.Image) *image.Gray {
+	if g, ok := img.(*image.Gray); ok {
+		return g
+	}
+	b := img.Bounds()
+	g := image.NewGray(image.Rect(0, 0, b.Dx(), b.Dy()))
+	if n, ok := img.(*image.NRGBA); ok && n.Rect.Min == (image.Point{}) {
+		// Output of imaging.Grayscale: all channels carry the same level
+		for y := 0; y < b.Dy(); y++ {
+			for x := 0; x < b.Dx(); x++ {
+				g.Pix[y*g.Stride+x] = n.Pix[y*n.Stride+x*4]
+			}
+		}
+		return g
+	}
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			g.Set(x, y, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return g
+}
+
+// otsuThreshold picks the grey level that best separates ink from paper
+func otsuThreshold(g *image.Gray) uint8 {
+	var hist [256]int
+	for _, p := range g.Pix {
+		hist[p]++
+	}
+	total := len(g.Pix)
+
+	var sum float64
+	for i, n := range hist {
+		sum += float64(i * n)
+	}
+
+	var sumB, maxVar float64
+	var wB int
+	threshold := uint8(128)
+	for t := 0; t < 256; t++ {
+		wB += hist[t]
+		if wB == 0 {
+			continue
+		}
+		wF := total - wB
+		if wF == 0 {
+			break
+		}
+		sumB += float64(t * hist[t])
+		mB := sumB / float64(wB)
+		mF := (sum - sumB) / float64(wF)
+		between := float64(wB) * float64(wF) * (mB - mF) * (mB - mF)
+		if between > maxVar {
+			maxVar = between
+			threshold = uint8(t)
+		}
+	}
+	return threshold
+}
+
+// inkPoints returns the coordinates of dark pixels
+func inkPoints(g *image.Gray) [][2]int {
+	t := otsuThreshold(g)
+	var pts [][2]int
+	w, h := g.Bounds().Dx(), g.Bounds().Dy()
+	for y := 0; y < h; y++ {
+		row := g.Pix[y*g.Stride : y*g.Stride+w]
+		for x, p := range row {
+			if p < t {
+				pts = append(pts, [2]int{x, y})
+			}
+		}
+	}
+	return pts
+}
+
+// profileScore measures how strongly ink concentrates into lines when
+// projected onto an axis. Text lines give a spiky profile and a high score.
+func profileScore(bins []float64) float64 {
+	var score float64
+	for i := 1; i < len(bins); i++ {
+		d := bins[i] - bins[i-1]
+		score += d * d
+	}
+	return score
+}
+
+// isSideways reports whether text lines run vertically
+func isSideways(g *image.Gray) bool {
+	w, h := g.Bounds().Dx(), g.Bounds().Dy()
+	rows := make([]float64, h)
+	cols := make([]float64, w)
+	pts := inkPoints(g)
+	if len(pts) == 0 {
+		return false
+	}
+	for _, p := range pts {
+		cols[p[0]]++
+		rows[p[1]]++
+	}
+	// Require a clear margin so that tables with strong vertical rules do
+	// not get turned
+	return profileScore(cols) > 1.5*profileScore(rows)
+}
+
+// estimateSkew returns the rotation in degrees (counter-clockwise) that
+// makes text lines horizontal, found by maximising the projection profile
+func estimateSkew(g *image.Gray) float64 {
+	pts := inkPoints(g)
+	if len(pts) == 0 {
+		return 0
+	}
+	h := g.Bounds().Dy()
+	w := g.Bounds().Dx()
+	offset := w // rotated rows can go negative by up to the width
+	bins := make([]float64, h+2*offset)
+
+	score := func(deg float64) float64 {
+		for i := range bins {
+			bins[i] = 0
+		}
+		rad := deg * math.Pi / 180
+		sin, cos := math.Sin(rad), math.Cos(rad)
+		for _, p := range pts {
+			// Row of the point after rotating the image by deg
+			// counter-clockwise around the origin
+			y := int(float64(p[1])*cos-float64(p[0])*sin) + offset
+			if y >= 0 && y < len(bins) {
+				bins[y]++
+			}
+		}
+		return profileScore(bins)
+	}
+
+	search := func(from, to, step float64) float64 {
+		best, bestScore := 0.0, -1.0
+		for a := from; a <= to+1e-9; a += step {
+			if s := score(a); s > bestScore {
+				best, bestScore = a, s
+			}
+		}
+		return best
+	}
+
+	coarse := search(-maxSkew, maxSkew, 0.5)
+	return search(coarse-0.5, coarse+0.5, 0.1)
+}
+
+// pageBounds finds a light page photographed against a darker background.
+// It reports false when the page already fills the image.
+func pageBounds(g *image.Gray) (image.Rectangle, bool) {
+	w, h := g.Bounds().Dx(), g.Bounds().Dy()
+	t := otsuThreshold(g)
+
+	light := func(p uint8) bool { return p >= t }
+	rowLight := func(y int) float64 {
+		n := 0
+		for x := 0; x < w; x++ {
+			if light(g.Pix[y*g.Stride+x]) {
+				n++
+			}
+		}
+		return float64(n) / float64(w)
+	}
+	colLight := func(x int) float64 {
+		n := 0
+		for y := 0; y < h; y++ {
+			if light(g.Pix[y*g.Stride+x]) {
+				n++
+			}
+		}
+		return float64(n) / float64(h)
+	}
+
+	// Paper is mostly light even where it carries text; background rows
+	// and columns are mostly dark
+	const pageFraction = 0.5
+	top, bottom, left, right := 0, h-1, 0, w-1
+	for top < bottom && rowLight(top) < pageFraction {
+		top++
+	}
+	for bottom > top && rowLight(bottom) < pageFraction {
+		bottom--
+	}
+	for left < right && colLight(left) < pageFraction {
+		left++
+	}
+	for right > left && colLight(right) < pageFraction {
+		right--
+	}
+
+	rect := image.Rect(left, top, right+1, bottom+1)
+	area := float64(rect.Dx()*rect.Dy()) / float64(w*h)
+	// Ignore results that trim almost nothing or that look like a failure
+	// to find the page at all
+	if area > 0.95 || area < 0.2 {
+		return image.Rectangle{}, false
+	}
+	return rect, true
+}
+
+// stretchContrast maps the 1st to 99th percentile of grey levels onto the
+// full range, brightening dim photos and darkening faded print
+func stretchContrast(g *image.Gray) *image.Gray {
+	var hist [256]int
+	for _, p := range g.Pix {
+		hist[p]++
+	}
+	percentile := func(pct int) int {
+		target := len(g.Pix) * pct / 100
+		seen := 0
+		for level, n := range hist {
+			seen += n
+			if seen > target {
+				return level
+			}
+		}
+		return 255
+	}
+	lo, hi := percentile(1), percentile(99)
+	if hi-lo < 10 {
+		return g
+	}
+
+	out := image.NewGray(g.Rect)
+	for i, p := range g.Pix {
+		v := (int(p) - lo) * 255 / (hi - lo)
+		if v < 0 {
+			v = 0
+		} else if v > 255 {
+			v = 255
+		}
+		out.Pix[i] = uint8(v)
+	}
+	return out
+}
+
+// DHash computes a 64-bit difference hash of an image. Re-photographs of the
+// same document produce hashes that differ in only a few bits.
+func DHash(img image.Image) uint64 {
+	small := toGray(imaging.Resize(imaging.Grayscale(img), 9, 8, imaging.Box))
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if small.Pix[y*small.Stride+x] < small.Pix[y*small.Stride+x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// HammingDistance counts the bits that differ between two hashes
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
@@ -0,0 +1,67 @@
+package inventory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/ashX04/new_website/internal/normalise"
+)
+
+// ExpiringBatch is a batch in stock that has expired or expires within one
+// of the alert windows
+type ExpiringBatch struct {
+	Balance
+	ExpiresOn time.Time
+	// DaysLeft is negative once the batch has expired
+	DaysLeft int
+	// Window is the smallest alert window the batch falls in, or 0 if it
+	// has expired
+	Window int
+}
+
+// Expired reports whether the batch is past its expiry
+func (b ExpiringBatch) Expired() bool {
+	return b.DaysLeft < 0
+}
+
+// Expiring picks the batches with stock on hand that have expired or expire
+// within the largest of windows (in days) of today, soonest first. Batches
+// whose expiry cannot be read are left out.
+func Expiring(balances []Balance, today time.Time, windows []int) []ExpiringBatch {
+	if len(windows) == 0 {
+		return nil
+	}
+	sorted := append([]int(nil), windows...)
+	sort.Ints(sorted)
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+
+	var batches []ExpiringBatch
+	for _, b := range balances {
+		if b.Quantity <= 0 {
+			continue
+		}
+		expiresOn, ok := normalise.ParseExpiry(b.Expiry)
+		if !ok {
+			continue
+		}
+		days := int(expiresOn.Sub(today).Hours() / 24)
+		batch := ExpiringBatch{Balance: b, ExpiresOn: expiresOn, DaysLeft: days}
+		if days >= 0 {
+			batch.Window = -1
+			for _, w := range sorted {
+				if days <= w {
+					batch.Window = w
+					break
+				}
+			}
+			if batch.Window == -1 {
+				continue
+			}
+		}
+		batches = append(batches, batch)
+	}
+	sort.SliceStable(batches, func(i, j int) bool {
+		return batches[i].ExpiresOn.Before(batches[j].ExpiresOn)
+	})
+	return batches
+}
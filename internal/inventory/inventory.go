@@ -0,0 +1,168 @@
+// Package inventory turns approved purchase invoices into stock movements
+// and sums the movement ledger into stock per product batch.
+package inventory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ashX04/new_website/internal/models"
+	"github.com/ashX04/new_website/internal/normalise"
+)
+
+// Balance is the stock on hand of one product batch
+type Balance struct {
+	Product  string
+	Batch    string
+	Expiry   string
+	Quantity float64
+}
+
+// UnlinkedLinesError lists invoice lines that cannot be posted because they
+// are not linked to a product and were not reviewed either
+type UnlinkedLinesError struct {
+	Lines []string
+}
+
+func (e *UnlinkedLinesError) Error() string {
+	return fmt.Sprintf("%d line(s) are not linked to a product: %s", len(e.Lines), strings.Join(e.Lines, ", "))
+}
+
+// ShortBatchesError lists batches that no longer hold the stock a set of
+// movements would take out of them
+type ShortBatchesError struct {
+	Batches []string
+}
+
+func (e *ShortBatchesError) Error() string {
+	return fmt.Sprintf("%d batch(es) no longer hold enough stock: %s", len(e.Batches), strings.Join(e.Batches, ", "))
+}
+
+// PurchaseMovements builds the stock-in movements of an invoice, one per
+// line: paid plus free quantity times the units in a pack. Lines a reviewer
+// marked as not in the product master are skipped; any line that is neither
+// linked nor reviewed fails the whole invoice with an UnlinkedLinesError.
+func PurchaseMovements(file *models.ExcelFile) ([]models.StockMovement, error) {
+	var movements []models.StockMovement
+	var unlinked []string
+	for _, line := range file.Lines {
+		if line.ProductID == "" {
+			if !line.MatchConfirmed {
+				unlinked = append(unlinked, line.ProductName)
+			}
+			continue
+		}
+		units := normalise.Line(line).Units()
+		if units <= 0 {
+			continue
+		}
+		movements = append(movements, models.StockMovement{
+			User:     file.User,
+			Product:  line.ProductID,
+			Batch:    NormaliseBatch(line.Batch),
+			Expiry:   line.Expiry,
+			Quantity: units,
+			Kind:     models.MovementPurchase,
+			Invoice:  file.ID,
+			Note:     purchaseNote(file),
+		})
+	}
+	if len(unlinked) > 0 {
+		return nil, &UnlinkedLinesError{Lines: unlinked}
+	}
+	return movements, nil
+}
+
+// Reversals builds the movements that cancel the net effect an invoice has
+// had on stock so far, given the ledger entries posted from it
+func Reversals(file *models.ExcelFile, posted []models.StockMovement) []models.StockMovement {
+	var reversals []models.StockMovement
+	for _, b := range Balances(posted) {
+		if b.Quantity == 0 {
+			continue
+		}
+		reversals = append(reversals, models.StockMovement{
+			User:     file.User,
+			Product:  b.Product,
+			Batch:    b.Batch,
+			Expiry:   b.Expiry,
+			Quantity: -b.Quantity,
+			Kind:     models.MovementPurchaseReversal,
+			Invoice:  file.ID,
+			Note:     "Reversal of " + purchaseNote(file),
+		})
+	}
+	return reversals
+}
+
+// CheckStock fails with a ShortBatchesError when posting movements on top of
+// balances would take any batch below zero. Only movements that take stock
+// out are checked.
+func CheckStock(balances []Balance, movements []models.StockMovement) error {
+	type key struct{ product, batch string }
+	onHand := make(map[key]float64, len(balances))
+	for _, b := range balances {
+		onHand[key{b.Product, b.Batch}] = b.Quantity
+	}
+	var short []string
+	for _, m := range movements {
+		if m.Quantity >= 0 {
+			continue
+		}
+		k := key{m.Product, NormaliseBatch(m.Batch)}
+		onHand[k] += m.Quantity
+		if onHand[k] < 0 {
+			batch := k.batch
+			if batch == "" {
+				batch = "(no batch)"
+			}
+			short = append(short, batch)
+		}
+	}
+	if len(short) > 0 {
+		return &ShortBatchesError{Batches: short}
+	}
+	return nil
+}
+
+// Balances sums movements into the stock of each product batch, ordered by
+// product and batch. The expiry is the one last recorded for the batch.
+func Balances(movements []models.StockMovement) []Balance {
+	type key struct{ product, batch string }
+	index := make(map[key]int)
+	var balances []Balance
+	for _, m := range movements {
+		k := key{m.Product, NormaliseBatch(m.Batch)}
+		i, ok := index[k]
+		if !ok {
+			i = len(balances)
+			index[k] = i
+			balances = append(balances, Balance{Product: k.product, Batch: k.batch})
+		}
+		balances[i].Quantity += m.Quantity
+		if m.Expiry != "" {
+			balances[i].Expiry = m.Expiry
+		}
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		if balances[i].Product != balances[j].Product {
+			return balances[i].Product < balances[j].Product
+		}
+		return balances[i].Batch < balances[j].Batch
+	})
+	return balances
+}
+
+// NormaliseBatch upper-cases a batch number and strips spaces, so that the
+// same batch read off two invoices is booked together
+func NormaliseBatch(batch string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(batch), ""))
+}
+
+func purchaseNote(file *models.ExcelFile) string {
+	if file.InvoiceNumber == "" {
+		return "purchase invoice"
+	}
+	return "purchase invoice " + file.InvoiceNumber
+}
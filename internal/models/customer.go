@@ -0,0 +1,15 @@
+package models
+
+// Customer is a record of the customers collection: a buyer the account
+// sells to
+type Customer struct {
+	ID      string `json:"id,omitempty"`
+	User    string `json:"user"`
+	Name    string `json:"name"`
+	GSTIN   string `json:"gstin"`
+	Address string `json:"address"`
+	// State is the GST state code goods are supplied to, derived from the
+	// GSTIN when known
+	State string `json:"state"`
+	Phone string `json:"phone"`
+}
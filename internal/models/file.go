@@ -1,16 +1,79 @@
 package models
 
-import "time"
+// Record statuses of processed invoices
+const (
+	StatusProcessed = "processed"
+	// StatusApproved invoices have been posted to inventory
+	StatusApproved = "approved"
+)
 
+// ExcelFile is a record of the excel_files collection: one processed invoice
+// together with the keys of its artifacts in the blob store.
 type ExcelFile struct {
-	ID          string    `json:"id"`
-	Created     time.Time `json:"created"`
-	SourceImage string    `json:"source_image"`
-	ExcelFile   string    `json:"excel_file"`
+	ID      string `json:"id"`
+	Created string `json:"created"`
+	User    string `json:"user"`
+
+	// Legacy PocketBase file fields, only set on records created before
+	// artifacts moved to the blob store
+	Excel string `json:"excel,omitempty"`
+	Image string `json:"image,omitempty"`
+
+	ImageKey     string `json:"image_key,omitempty"`
+	ProcessedKey string `json:"processed_key,omitempty"`
+	OCRKey       string `json:"ocr_key,omitempty"`
+	ExcelKey     string `json:"excel_key,omitempty"`
+
+	// Pages is the number of pages OCR read from the source document
+	Pages int `json:"pages,omitempty"`
+
+	InvoiceHeader
+	// Supplier is the ID of the supplier master record the invoice is
+	// linked to
+	Supplier string        `json:"supplier,omitempty"`
+	Lines    []InvoiceLine `json:"lines,omitempty"`
+	// PurchaseOrder is the ID of the purchase order the invoice delivers
+	// against, if any
+	PurchaseOrder string `json:"purchase_order,omitempty"`
+	// Columns are the output template columns the invoice was extracted
+	// with, kept so that later exports use the same layout
+	Columns []TemplateColumn `json:"columns,omitempty"`
+
+	// Status tracks the record through review
+	Status string `json:"status,omitempty"`
+	// SearchText is the lower-cased text matched by dashboard search
+	SearchText string `json:"search_text,omitempty"`
+
+	// PHash is the hex encoded perceptual hash of the source image
+	PHash string `json:"phash,omitempty"`
+	// DuplicateOf is the ID of an earlier record this one appears to
+	// duplicate, with a human readable reason
+	DuplicateOf     string `json:"duplicate_of,omitempty"`
+	DuplicateReason string `json:"duplicate_reason,omitempty"`
+
+	// Expand holds related records requested with PocketBase's expand
+	// parameter
+	Expand *ExcelFileExpand `json:"expand,omitempty"`
+}
+
+// LineColumns returns the output template columns the invoice was
+// extracted with. Records from before templates used the legacy columns.
+func (f *ExcelFile) LineColumns() []TemplateColumn {
+	if len(f.Columns) == 0 {
+		return LegacyTemplateColumns
+	}
+	return f.Columns
+}
+
+// ExcelFileExpand is the expand object of an excel_files record
+type ExcelFileExpand struct {
+	Supplier *Supplier `json:"supplier,omitempty"`
 }
 
+// ImageFile is a record of the images collection: an uploaded source image
 type ImageFile struct {
-	ID        string    `json:"id"`
-	Created   time.Time `json:"created"`
-	ImageFile string    `json:"image_file"`
+	ID       string `json:"id"`
+	Created  string `json:"created"`
+	User     string `json:"user"`
+	ImageKey string `json:"image_key"`
 }
@@ -0,0 +1,118 @@
+package models
+
+// InvoiceHeader holds the header fields extracted from a purchase invoice
+type InvoiceHeader struct {
+	SupplierName  string  `json:"supplier_name"`
+	SupplierGSTIN string  `json:"supplier_gstin"`
+	InvoiceNumber string  `json:"invoice_number"`
+	InvoiceDate   string  `json:"invoice_date"`
+	InvoiceTotal  float64 `json:"invoice_total"`
+	// BuyerGSTIN is the GSTIN the invoice is billed to, as printed
+	BuyerGSTIN string `json:"buyer_gstin,omitempty"`
+}
+
+// InvoiceLine is one row of the line item table. Which fields are filled in
+// depends on the output template the invoice was extracted with.
+type InvoiceLine struct {
+	SerialNo    string `json:"serial_no"`
+	Quantity    string `json:"quantity"`
+	Pack        string `json:"pack"`
+	HSN         string `json:"hsn"`
+	ProductName string `json:"product_name"`
+	Batch       string `json:"batch"`
+	Expiry      string `json:"expiry"`
+	MRP         string `json:"mrp"`
+	Rate        string `json:"rate"`
+	GST         string `json:"gst"`
+	CGST        string `json:"cgst"`
+	SGST        string `json:"sgst"`
+	Amount      string `json:"amount"`
+
+	Free         string `json:"free,omitempty"`
+	Manufacturer string `json:"manufacturer,omitempty"`
+	Discount     string `json:"discount,omitempty"`
+	Scheme       string `json:"scheme,omitempty"`
+	IGST         string `json:"igst,omitempty"`
+	Cess         string `json:"cess,omitempty"`
+	// Extra holds the values of custom template columns by field name
+	Extra map[string]string `json:"extra,omitempty"`
+
+	// ProductID links the line to the product master. MatchScore is the
+	// matcher's confidence between 0 and 1; MatchConfirmed is set once a
+	// reviewer has accepted or corrected the link.
+	ProductID      string  `json:"product_id,omitempty"`
+	MatchScore     float64 `json:"match_score,omitempty"`
+	MatchConfirmed bool    `json:"match_confirmed,omitempty"`
+}
+
+// Field returns the extracted value of a line by its field name, or "" for
+// unknown names
+func (l *InvoiceLine) Field(name string) string {
+	if IsCustomField(name) {
+		return l.Extra[name]
+	}
+	if field := l.field(name); field != nil {
+		return *field
+	}
+	return ""
+}
+
+// SetField sets the value of a line field by name. Unknown standard names
+// are ignored.
+func (l *InvoiceLine) SetField(name, value string) {
+	if IsCustomField(name) {
+		if l.Extra == nil {
+			l.Extra = make(map[string]string)
+		}
+		l.Extra[name] = value
+		return
+	}
+	if field := l.field(name); field != nil {
+		*field = value
+	}
+}
+
+// field points at the standard field with the given name
+func (l *InvoiceLine) field(name string) *string {
+	switch name {
+	case "serial_no":
+		return &l.SerialNo
+	case "quantity":
+		return &l.Quantity
+	case "pack":
+		return &l.Pack
+	case "hsn":
+		return &l.HSN
+	case "product_name":
+		return &l.ProductName
+	case "batch":
+		return &l.Batch
+	case "expiry":
+		return &l.Expiry
+	case "mrp":
+		return &l.MRP
+	case "rate":
+		return &l.Rate
+	case "gst":
+		return &l.GST
+	case "cgst":
+		return &l.CGST
+	case "sgst":
+		return &l.SGST
+	case "igst":
+		return &l.IGST
+	case "cess":
+		return &l.Cess
+	case "amount":
+		return &l.Amount
+	case "free":
+		return &l.Free
+	case "manufacturer":
+		return &l.Manufacturer
+	case "discount":
+		return &l.Discount
+	case "scheme":
+		return &l.Scheme
+	}
+	return nil
+}
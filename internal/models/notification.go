@@ -0,0 +1,19 @@
+package models
+
+// Notification kinds
+const (
+	NotificationExpiryDigest = "expiry_digest"
+	NotificationPriceChange  = "price_change"
+)
+
+// Notification is a record of the notifications collection: a message shown
+// to the user in the app and optionally also sent by email
+type Notification struct {
+	ID      string `json:"id,omitempty"`
+	Created string `json:"created,omitempty"`
+	User    string `json:"user"`
+	Kind    string `json:"kind"`
+	Title   string `json:"title"`
+	Body    string `json:"body"`
+	Read    bool   `json:"read"`
+}
@@ -0,0 +1,33 @@
+package models
+
+// Purchase order statuses. They follow the approved invoices received
+// against an order.
+const (
+	OrderOpen    = "open"
+	OrderPartial = "partially_received"
+	OrderClosed  = "closed"
+)
+
+// PurchaseOrder is a record of the purchase_orders collection: what the
+// account ordered from a supplier, at agreed rates
+type PurchaseOrder struct {
+	ID       string `json:"id,omitempty"`
+	Created  string `json:"created,omitempty"`
+	User     string `json:"user"`
+	Supplier string `json:"supplier"`
+	Number   string `json:"number"`
+	// Date is the order date as YYYY-MM-DD
+	Date   string      `json:"date"`
+	Status string      `json:"status"`
+	Lines  []OrderLine `json:"lines"`
+	Note   string      `json:"note,omitempty"`
+}
+
+// OrderLine is a product ordered. Quantities are in the units invoices bill
+// in, and the rate is the agreed rate per unit in rupees.
+type OrderLine struct {
+	Product     string  `json:"product"`
+	ProductName string  `json:"product_name"`
+	Quantity    float64 `json:"quantity"`
+	Rate        float64 `json:"rate"`
+}
@@ -0,0 +1,22 @@
+package models
+
+// PaymentModes are the ways a supplier can be paid
+var PaymentModes = []string{"NEFT/RTGS", "UPI", "Cheque", "Cash", "Card"}
+
+// Payment is a record of the payments collection: money paid to a supplier,
+// against one invoice or on account
+type Payment struct {
+	ID       string `json:"id,omitempty"`
+	Created  string `json:"created,omitempty"`
+	User     string `json:"user"`
+	Supplier string `json:"supplier"`
+	// Invoice is the excel_files record the payment settles; empty for a
+	// payment on account
+	Invoice string `json:"invoice,omitempty"`
+	// Date is the payment date as YYYY-MM-DD
+	Date      string  `json:"date"`
+	Amount    float64 `json:"amount"`
+	Mode      string  `json:"mode"`
+	Reference string  `json:"reference,omitempty"`
+	Note      string  `json:"note,omitempty"`
+}
@@ -0,0 +1,14 @@
+package models
+
+// Product is a record of the products collection: an entry of the account's
+// product master that extracted invoice lines are linked to
+type Product struct {
+	ID           string   `json:"id,omitempty"`
+	User         string   `json:"user"`
+	Name         string   `json:"name"`
+	Pack         string   `json:"pack"`
+	HSN          string   `json:"hsn"`
+	GSTRate      float64  `json:"gst_rate"`
+	Manufacturer string   `json:"manufacturer"`
+	Aliases      []string `json:"aliases"`
+}
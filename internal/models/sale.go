@@ -0,0 +1,59 @@
+package models
+
+// Sales invoice statuses. Issued invoices are never deleted, so that the
+// numbering has no gaps; cancelling one returns its stock.
+const (
+	SaleIssued    = "issued"
+	SaleCancelled = "cancelled"
+)
+
+// DefaultSalesPrefix starts sales invoice numbers until an account sets its
+// own prefix
+const DefaultSalesPrefix = "INV"
+
+// SalesInvoice is a record of the sales_invoices collection: an invoice the
+// account issued to a customer. The seller's and customer's details and the
+// supply are copied onto the invoice so that it prints the same after the
+// account's settings or the customer are edited.
+type SalesInvoice struct {
+	ID       string `json:"id,omitempty"`
+	Created  string `json:"created,omitempty"`
+	User     string `json:"user"`
+	Customer string `json:"customer"`
+	Number   string `json:"number"`
+	// FinancialYear is the year the invoice is numbered in, as 2026-27
+	FinancialYear string `json:"financial_year"`
+	// Date is the invoice date as YYYY-MM-DD
+	Date            string `json:"date"`
+	SellerName      string `json:"seller_name"`
+	SellerGSTIN     string `json:"seller_gstin"`
+	SellerAddress   string `json:"seller_address"`
+	CustomerName    string `json:"customer_name"`
+	CustomerGSTIN   string `json:"customer_gstin"`
+	CustomerAddress string `json:"customer_address"`
+	// PlaceOfSupply is the GST state code of the customer
+	PlaceOfSupply string `json:"place_of_supply"`
+	// Interstate is set when the place of supply is outside the seller's
+	// state, so that the invoice is taxed with IGST
+	Interstate bool       `json:"interstate"`
+	Status     string     `json:"status"`
+	Lines      []SaleLine `json:"lines"`
+	// Total is the invoice value in rupees, rounded off
+	Total float64 `json:"total"`
+	Note  string  `json:"note,omitempty"`
+}
+
+// SaleLine is one batch of a product sold. Quantities are in units; the rate
+// is per unit before tax, in rupees, and the discount and GST rate are in
+// percent. HSN and GST rate are copied from the product master.
+type SaleLine struct {
+	Product     string  `json:"product"`
+	ProductName string  `json:"product_name"`
+	HSN         string  `json:"hsn"`
+	Batch       string  `json:"batch"`
+	Expiry      string  `json:"expiry"`
+	Quantity    float64 `json:"quantity"`
+	Rate        float64 `json:"rate"`
+	Discount    float64 `json:"discount,omitempty"`
+	GSTRate     float64 `json:"gst_rate"`
+}
@@ -0,0 +1,142 @@
+package models
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultTimezone is used until an account picks its own time zone
+const DefaultTimezone = "Asia/Kolkata"
+
+// DefaultExpiryWindows are the near-expiry alert windows, in days, used until
+// an account sets its own
+var DefaultExpiryWindows = []int{30, 60, 90}
+
+// DefaultPriceAlertPercent is the rate increase, in percent, that raises a
+// price alert until an account sets its own
+const DefaultPriceAlertPercent = 5
+
+// Settings is a record of the settings collection: the preferences of an
+// account, which is the unit invoices are processed for
+type Settings struct {
+	ID       string `json:"id,omitempty"`
+	User     string `json:"user"`
+	Timezone string `json:"timezone"`
+	// GSTIN is the account's own GSTIN. Its state code decides whether
+	// purchases are intra- or inter-state.
+	GSTIN string `json:"gstin"`
+	// BusinessName and BusinessAddress head the sales invoices the account
+	// issues
+	BusinessName    string `json:"business_name"`
+	BusinessAddress string `json:"business_address"`
+	// SalesPrefix starts sales invoice numbers, as in INV/2026-27/0001
+	SalesPrefix string `json:"sales_prefix"`
+
+	// ExpiryWindows are the near-expiry alert windows in days
+	ExpiryWindows []int `json:"expiry_windows"`
+	// NotifyEmail receives alert digests by email when set
+	NotifyEmail string `json:"notify_email"`
+	// PriceAlertPercent is how far, in percent, a new invoice's rate may
+	// exceed the supplier's previous rate or the cheapest other supplier's
+	// before it is flagged; 0 means unset, as the settings form refuses 0
+	PriceAlertPercent float64 `json:"price_alert_percent"`
+	// OutputTemplate is the output template new uploads are extracted
+	// with; the default columns are used when empty
+	OutputTemplate string `json:"output_template"`
+	// Tally maps invoice amounts to the ledgers of the account's Tally
+	// company
+	Tally TallyLedgers `json:"tally"`
+}
+
+// TallyLedgers are the Tally ledger names purchase vouchers are posted to.
+// "{rate}" in a ledger name is replaced by the tax rate of the amount, so
+// that one name covers "Purchase @ 5%", "Purchase @ 12%" and so on.
+type TallyLedgers struct {
+	// Company is the Tally company vouchers are imported into; Tally uses
+	// the open company when empty
+	Company     string `json:"company,omitempty"`
+	VoucherType string `json:"voucher_type,omitempty"`
+	Purchase    string `json:"purchase,omitempty"`
+	CGST        string `json:"cgst,omitempty"`
+	SGST        string `json:"sgst,omitempty"`
+	IGST        string `json:"igst,omitempty"`
+	Cess        string `json:"cess,omitempty"`
+	RoundOff    string `json:"round_off,omitempty"`
+	// WithInventory exports item invoices with stock items and batches
+	// instead of accounting invoices
+	WithInventory bool `json:"with_inventory,omitempty"`
+}
+
+// DefaultTallyLedgers are used for ledger names an account has not set
+var DefaultTallyLedgers = TallyLedgers{
+	VoucherType: "Purchase",
+	Purchase:    "Purchase @ {rate}%",
+	CGST:        "Input CGST @ {rate}%",
+	SGST:        "Input SGST @ {rate}%",
+	IGST:        "Input IGST @ {rate}%",
+	Cess:        "Input Cess @ {rate}%",
+	RoundOff:    "Round Off",
+}
+
+// TallyMapping returns the account's Tally ledgers with unset names filled
+// in from the defaults
+func (s *Settings) TallyMapping() TallyLedgers {
+	m := s.Tally
+	fill := func(name *string, fallback string) {
+		if strings.TrimSpace(*name) == "" {
+			*name = fallback
+		}
+	}
+	fill(&m.VoucherType, DefaultTallyLedgers.VoucherType)
+	fill(&m.Purchase, DefaultTallyLedgers.Purchase)
+	fill(&m.CGST, DefaultTallyLedgers.CGST)
+	fill(&m.SGST, DefaultTallyLedgers.SGST)
+	fill(&m.IGST, DefaultTallyLedgers.IGST)
+	fill(&m.Cess, DefaultTallyLedgers.Cess)
+	fill(&m.RoundOff, DefaultTallyLedgers.RoundOff)
+	return m
+}
+
+// Location returns the account's time zone, falling back to the default
+// when none is set or the stored name is unknown
+func (s *Settings) Location() *time.Location {
+	name := s.Timezone
+	if name == "" {
+		name = DefaultTimezone
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		loc, _ = time.LoadLocation(DefaultTimezone)
+	}
+	return loc
+}
+
+// AlertWindows returns the account's near-expiry windows in ascending order,
+// falling back to the defaults when none are set
+func (s *Settings) AlertWindows() []int {
+	if len(s.ExpiryWindows) == 0 {
+		return DefaultExpiryWindows
+	}
+	windows := append([]int(nil), s.ExpiryWindows...)
+	sort.Ints(windows)
+	return windows
+}
+
+// PriceAlertThreshold returns the account's price alert threshold in
+// percent, falling back to the default when none is set
+func (s *Settings) PriceAlertThreshold() float64 {
+	if s.PriceAlertPercent <= 0 {
+		return DefaultPriceAlertPercent
+	}
+	return s.PriceAlertPercent
+}
+
+// SalesInvoicePrefix returns the account's sales invoice prefix, falling
+// back to the default when none is set
+func (s *Settings) SalesInvoicePrefix() string {
+	if strings.TrimSpace(s.SalesPrefix) == "" {
+		return DefaultSalesPrefix
+	}
+	return strings.TrimSpace(s.SalesPrefix)
+}
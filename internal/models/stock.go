@@ -0,0 +1,29 @@
+package models
+
+// Kinds of stock movement
+const (
+	MovementPurchase         = "purchase"
+	MovementPurchaseReversal = "purchase_reversal"
+	MovementAdjustment       = "adjustment"
+	MovementStockOut         = "stock_out"
+	MovementSale             = "sale"
+	MovementSaleCancellation = "sale_cancellation"
+)
+
+// StockMovement is a record of the stock_movements collection: one entry of
+// the inventory ledger. Quantity is in units and negative for stock leaving.
+type StockMovement struct {
+	ID       string  `json:"id,omitempty"`
+	Created  string  `json:"created,omitempty"`
+	User     string  `json:"user"`
+	Product  string  `json:"product"`
+	Batch    string  `json:"batch"`
+	Expiry   string  `json:"expiry"`
+	Quantity float64 `json:"quantity"`
+	Kind     string  `json:"kind"`
+	// Invoice is the excel_files record a purchase movement was posted from
+	Invoice string `json:"invoice,omitempty"`
+	// Sale is the sales_invoices record a sale movement was posted from
+	Sale string `json:"sale,omitempty"`
+	Note string `json:"note,omitempty"`
+}
@@ -0,0 +1,23 @@
+package models
+
+// Supplier statuses: suppliers recognised on an invoice but not in the master
+// are proposed until a reviewer approves them
+const (
+	SupplierApproved = "approved"
+	SupplierProposed = "proposed"
+)
+
+// Supplier is a record of the suppliers collection: a distributor the
+// account buys from
+type Supplier struct {
+	ID      string `json:"id,omitempty"`
+	User    string `json:"user"`
+	Name    string `json:"name"`
+	GSTIN   string `json:"gstin"`
+	Address string `json:"address"`
+	// State is the GST state code, derived from the GSTIN when known
+	State string `json:"state"`
+	// PaymentTermsDays is the credit period the supplier allows
+	PaymentTermsDays int    `json:"payment_terms_days"`
+	Status           string `json:"status"`
+}
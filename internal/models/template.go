@@ -0,0 +1,97 @@
+package models
+
+import "strings"
+
+// CustomFieldPrefix starts the field name of template columns that are not
+// one of the standard line fields. Their values are kept in InvoiceLine.Extra.
+const CustomFieldPrefix = "custom_"
+
+// Column kinds, matching the kinds of the normalise package
+const (
+	KindText     = "text"
+	KindInteger  = "integer"
+	KindNumber   = "number"
+	KindAmount   = "amount"
+	KindPercent  = "percent"
+	KindQuantity = "quantity"
+	KindExpiry   = "expiry"
+)
+
+// TemplateColumn is one column of an output template
+type TemplateColumn struct {
+	// Field is the line field the column holds: a standard field name or
+	// CustomFieldPrefix followed by a slug
+	Field string `json:"field"`
+	// Name is the column header in the prompt and the workbook
+	Name string `json:"name"`
+	// Description tells the extraction model what to put in the column
+	Description string `json:"description,omitempty"`
+	Kind        string `json:"kind"`
+	// Required columns must be filled in on every line
+	Required bool `json:"required,omitempty"`
+}
+
+// OutputTemplate is a record of the output_templates collection: the
+// columns an account wants extracted and written to its workbooks
+type OutputTemplate struct {
+	ID      string           `json:"id,omitempty"`
+	User    string           `json:"user"`
+	Name    string           `json:"name"`
+	Columns []TemplateColumn `json:"columns"`
+}
+
+// LineFields are the standard line fields templates can pick from
+var LineFields = []TemplateColumn{
+	{Field: "serial_no", Name: "Serial.no.", Kind: KindInteger},
+	{Field: "quantity", Name: "Quantity.", Description: "write free goods as paid+free, e.g. 10+2, unless there is a free quantity column", Kind: KindQuantity},
+	{Field: "free", Name: "Free", Description: "free quantity", Kind: KindNumber},
+	{Field: "pack", Name: "Pack", Kind: KindText},
+	{Field: "hsn", Name: "HSN no.", Kind: KindText},
+	{Field: "product_name", Name: "Product_name", Kind: KindText, Required: true},
+	{Field: "manufacturer", Name: "Manufacturer", Kind: KindText},
+	{Field: "batch", Name: "batch no.", Kind: KindText},
+	{Field: "expiry", Name: "Expiry date", Kind: KindExpiry},
+	{Field: "mrp", Name: "MRP", Kind: KindAmount},
+	{Field: "rate", Name: "S.Rate", Description: "selling rate", Kind: KindAmount},
+	{Field: "discount", Name: "Discount %", Kind: KindPercent},
+	{Field: "scheme", Name: "Scheme", Description: "scheme or offer, e.g. 10+1", Kind: KindText},
+	{Field: "gst", Name: "GST", Kind: KindPercent},
+	{Field: "cgst", Name: "CGST", Kind: KindPercent},
+	{Field: "sgst", Name: "SGST", Kind: KindPercent},
+	{Field: "igst", Name: "IGST", Description: "only on inter-state invoices", Kind: KindPercent},
+	{Field: "cess", Name: "Cess %", Kind: KindPercent},
+	{Field: "amount", Name: "Amount", Kind: KindAmount},
+}
+
+// DefaultTemplateColumns are used by accounts without a template of their
+// own: the original thirteen columns with IGST next to CGST and SGST
+var DefaultTemplateColumns = templateColumns("serial_no", "quantity", "pack", "hsn", "product_name",
+	"batch", "expiry", "mrp", "rate", "gst", "cgst", "sgst", "igst", "amount")
+
+// LegacyTemplateColumns are the columns of records extracted before output
+// templates, which do not store their own
+var LegacyTemplateColumns = templateColumns("serial_no", "quantity", "pack", "hsn", "product_name",
+	"batch", "expiry", "mrp", "rate", "gst", "cgst", "sgst", "amount")
+
+// LineField returns the standard line field with the given name
+func LineField(field string) (TemplateColumn, bool) {
+	for _, f := range LineFields {
+		if f.Field == field {
+			return f, true
+		}
+	}
+	return TemplateColumn{}, false
+}
+
+// IsCustomField reports whether a field name is a custom column
+func IsCustomField(field string) bool {
+	return strings.HasPrefix(field, CustomFieldPrefix)
+}
+
+func templateColumns(fields ...string) []TemplateColumn {
+	columns := make([]TemplateColumn, len(fields))
+	for i, field := range fields {
+		columns[i], _ = LineField(field)
+	}
+	return columns
+}
@@ -0,0 +1,28 @@
+package normalise
+
+import (
+	"strings"
+	"time"
+)
+
+// dateLayouts are the invoice date formats accepted besides numeric
+// DD-MM-YYYY and ISO dates
+var dateLayouts = []string{"2 Jan 2006", "2-Jan-2006", "2 Jan 06", "2-Jan-06", "Jan 2, 2006", "2 January 2006"}
+
+// Date parses an invoice date. Numeric dates are read day first, as printed
+// in India. The result is a date at midnight UTC.
+func Date(value string) (time.Time, bool) {
+	s := strings.TrimSpace(value)
+	if m := fullDate.FindStringSubmatch(s); m != nil {
+		return date(year(m[3]), atoi(m[2]), atoi(m[1]))
+	}
+	if m := isoDate.FindStringSubmatch(s); m != nil && m[3] != "" {
+		return date(atoi(m[1]), atoi(m[2]), atoi(m[3]))
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,100 @@
+// Package normalise turns the free-text cells extracted from invoices into
+// typed values.
+package normalise
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var months = map[string]time.Month{
+	"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April,
+	"may": time.May, "jun": time.June, "jul": time.July, "aug": time.August,
+	"sep": time.September, "sept": time.September, "oct": time.October,
+	"nov": time.November, "dec": time.December,
+}
+
+var (
+	// 03/26, 3-2026, 03.26
+	numericExpiry = regexp.MustCompile(`^(\d{1,2})\s*[/\-.]\s*(\d{2}|\d{4})$`)
+	// MAR-26, Mar 2026, MAR26
+	namedExpiry = regexp.MustCompile(`^([a-z]{3,4})[a-z]*\s*[/\-.']?\s*(\d{2}|\d{4})$`)
+	// 31/03/2026, 31-03-26
+	fullDate = regexp.MustCompile(`^(\d{1,2})[/\-.](\d{1,2})[/\-.](\d{2}|\d{4})$`)
+	// 2026-03-31, 2026-03
+	isoDate = regexp.MustCompile(`^(\d{4})-(\d{1,2})(?:-(\d{1,2}))?$`)
+)
+
+// ParseExpiry reads an expiry as printed on Indian pharma invoices: MM/YY,
+// MM-YYYY, MMM-YY and their variants, or a full date. Stock is usable until
+// the end of the expiry month, so month-only expiries return the last day of
+// that month. The result is a date at midnight UTC.
+func ParseExpiry(value string) (time.Time, bool) {
+	s := strings.ToLower(strings.TrimSpace(value))
+	// Some invoices repeat the label in the cell: "Exp. 03/26"
+	for _, label := range []string{"expiry", "exp"} {
+		if strings.HasPrefix(s, label) {
+			s = strings.TrimLeft(strings.TrimPrefix(s, label), ".: ")
+			break
+		}
+	}
+	if s == "" {
+		return time.Time{}, false
+	}
+
+	if m := fullDate.FindStringSubmatch(s); m != nil {
+		return date(year(m[3]), atoi(m[2]), atoi(m[1]))
+	}
+	if m := isoDate.FindStringSubmatch(s); m != nil {
+		if m[3] == "" {
+			return endOfMonth(atoi(m[1]), atoi(m[2]))
+		}
+		return date(atoi(m[1]), atoi(m[2]), atoi(m[3]))
+	}
+	if m := numericExpiry.FindStringSubmatch(s); m != nil {
+		return endOfMonth(year(m[2]), atoi(m[1]))
+	}
+	if m := namedExpiry.FindStringSubmatch(s); m != nil {
+		month, ok := months[m[1]]
+		if !ok {
+			month, ok = months[m[1][:3]]
+		}
+		if !ok {
+			return time.Time{}, false
+		}
+		return endOfMonth(year(m[2]), int(month))
+	}
+	return time.Time{}, false
+}
+
+func endOfMonth(y, m int) (time.Time, bool) {
+	if m < 1 || m > 12 {
+		return time.Time{}, false
+	}
+	return time.Date(y, time.Month(m)+1, 0, 0, 0, 0, 0, time.UTC), true
+}
+
+func date(y, m, d int) (time.Time, bool) {
+	t := time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC)
+	// Reject dates that time.Date normalised, such as 31/02
+	if t.Month() != time.Month(m) || t.Day() != d {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// year expands two digit years into this century
+func year(s string) int {
+	y := atoi(s)
+	if len(s) == 2 {
+		y += 2000
+	}
+	return y
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
@@ -0,0 +1,112 @@
+package normalise
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/ashX04/new_website/internal/models"
+)
+
+// Kind is how the text of an extracted column is interpreted
+type Kind string
+
+const (
+	KindText     Kind = "text"
+	KindInteger  Kind = "integer"
+	KindNumber   Kind = "number"
+	KindAmount   Kind = "amount"
+	KindPercent  Kind = "percent"
+	KindQuantity Kind = "quantity"
+	KindExpiry   Kind = "expiry"
+	KindDate     Kind = "date"
+)
+
+// Cell converts the text of a cell into the value a spreadsheet should hold:
+// float64 for numbers and amounts, int64 for whole numbers, a fraction for
+// percentages (12% becomes 0.12) and a time.Time for expiries and dates.
+// Text that cannot be read as its kind is returned trimmed but otherwise
+// unchanged, so nothing extracted is lost. A quantity with free goods
+// ("10+2") stays text.
+func Cell(kind Kind, value string) interface{} {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ""
+	}
+	switch kind {
+	case KindInteger:
+		if n, ok := Number(value); ok && n == math.Trunc(n) {
+			return int64(n)
+		}
+	case KindNumber, KindAmount:
+		if n, ok := Number(value); ok {
+			return n
+		}
+	case KindPercent:
+		if n, ok := Percent(value); ok {
+			return n / 100
+		}
+	case KindQuantity:
+		if paid, free, ok := Quantity(value); ok && free == 0 && strings.TrimSpace(leadingNumber(value)) == value {
+			return paid
+		}
+	case KindExpiry:
+		if t, ok := ParseExpiry(value); ok {
+			return t
+		}
+	case KindDate:
+		if t, ok := Date(value); ok {
+			return t
+		}
+	}
+	return value
+}
+
+// LineValues are the typed values of an extracted invoice line. Values that
+// could not be read are zero.
+type LineValues struct {
+	Quantity  float64
+	Free      float64
+	PackUnits float64
+	MRP       float64
+	Rate      float64
+	// Discount is in percentage points
+	Discount float64
+	// GSTRate is in percentage points
+	GSTRate float64
+	// CGST, SGST, IGST and Cess are the printed rates in percentage points
+	CGST   float64
+	SGST   float64
+	IGST   float64
+	Cess   float64
+	Amount float64
+	// Expiry is the last day the batch is usable, zero if unreadable
+	Expiry time.Time
+}
+
+// Units is the number of units received, paid and free
+func (v LineValues) Units() float64 {
+	return (v.Quantity + v.Free) * v.PackUnits
+}
+
+// Line reads the typed values of an invoice line
+func Line(line models.InvoiceLine) LineValues {
+	var v LineValues
+	v.Quantity, v.Free, _ = Quantity(line.Quantity)
+	// A separate free column wins over "10+2" in the quantity
+	if free, ok := Number(line.Free); ok {
+		v.Free = free
+	}
+	v.PackUnits = PackUnits(line.Pack)
+	v.MRP, _ = Number(line.MRP)
+	v.Rate, _ = Number(line.Rate)
+	v.Discount, _ = Percent(line.Discount)
+	v.GSTRate, _ = Percent(line.GST)
+	v.CGST, _ = Percent(line.CGST)
+	v.SGST, _ = Percent(line.SGST)
+	v.IGST, _ = Percent(line.IGST)
+	v.Cess, _ = Percent(line.Cess)
+	v.Amount, _ = Number(line.Amount)
+	v.Expiry, _ = ParseExpiry(line.Expiry)
+	return v
+}
@@ -0,0 +1,110 @@
+package normalise
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// currencyMarks are stripped from amounts before parsing
+var currencyMarks = []string{"₹", "rs.", "rs", "inr", "/-"}
+
+// Number parses a number as printed on Indian invoices: lakh grouping
+// ("1,23,456.50"), a rupee sign or "Rs." prefix, a trailing "/-", and
+// negatives written with a minus sign or in brackets
+func Number(value string) (float64, bool) {
+	s := strings.ToLower(strings.TrimSpace(value))
+	for _, mark := range currencyMarks {
+		s = strings.ReplaceAll(s, mark, "")
+	}
+	s = strings.TrimSpace(s)
+
+	negative := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		negative = true
+		s = strings.TrimSpace(s[1 : len(s)-1])
+	}
+	if strings.HasPrefix(s, "-") {
+		negative = !negative
+		s = strings.TrimSpace(s[1:])
+	}
+
+	// Grouping separators and spaces carry no value
+	s = strings.Map(func(r rune) rune {
+		if r == ',' || unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+	if s == "" {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+		// ParseFloat also reads "NaN" and "Inf", which are not amounts
+		return 0, false
+	}
+	if negative {
+		n = -n
+	}
+	return n, true
+}
+
+// Percent parses a rate such as "12%", "12.0 %" or "12", returning it in
+// percentage points (12)
+func Percent(value string) (float64, bool) {
+	return Number(strings.TrimSuffix(strings.TrimSpace(value), "%"))
+}
+
+// Quantity reads an invoice quantity cell. Free goods are written as "10+2"
+// and returned separately. A unit such as "10 strips" is ignored.
+func Quantity(value string) (paid, free float64, ok bool) {
+	parts := strings.SplitN(value, "+", 2)
+	paid, ok = Number(leadingNumber(parts[0]))
+	if len(parts) == 2 {
+		free, _ = Number(leadingNumber(parts[1]))
+	}
+	return paid, free, ok
+}
+
+// PackUnits returns the number of units in one pack: "10x10" and "10*10" are
+// 100, "1x15" and "15's" are 15. Packs measured by volume or weight, such as
+// "100ml", and unreadable packs count as a single unit.
+func PackUnits(pack string) float64 {
+	pack = strings.ToLower(strings.TrimSpace(pack))
+	if pack == "" {
+		return 1
+	}
+	units := 1.0
+	for _, factor := range strings.FieldsFunc(pack, func(r rune) bool { return r == 'x' || r == '*' }) {
+		number := leadingNumber(factor)
+		n, ok := Number(number)
+		rest := strings.TrimPrefix(strings.TrimSpace(factor), number)
+		if !ok || n <= 0 || measure(rest) {
+			return 1
+		}
+		units *= n
+	}
+	return units
+}
+
+// measure reports whether the text after a pack number is a unit of volume
+// or weight rather than a count
+func measure(suffix string) bool {
+	switch strings.TrimSpace(suffix) {
+	case "ml", "ltr", "l", "gm", "g", "kg", "mg":
+		return true
+	}
+	return false
+}
+
+// leadingNumber returns the digits, dots and commas a string starts with
+func leadingNumber(s string) string {
+	s = strings.TrimSpace(s)
+	end := 0
+	for end < len(s) && (s[end] >= '0' && s[end] <= '9' || s[end] == '.' || s[end] == ',') {
+		end++
+	}
+	return s[:end]
+}
@@ -0,0 +1,199 @@
+// Package orders matches processed invoices against the purchase orders
+// they deliver, flagging what differs from what was ordered, and works out
+// how much of an order has been received.
+package orders
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ashX04/new_website/internal/gst"
+	"github.com/ashX04/new_website/internal/models"
+	"github.com/ashX04/new_website/internal/normalise"
+)
+
+// Received sums the billed quantity per product of the approved invoices
+// delivered against an order, leaving out the invoice with ID except
+func Received(invoices []models.ExcelFile, except string) map[string]float64 {
+	received := make(map[string]float64)
+	for i := range invoices {
+		file := &invoices[i]
+		if file.ID == except || file.Status != models.StatusApproved {
+			continue
+		}
+		for _, line := range file.Lines {
+			if line.ProductID != "" {
+				received[line.ProductID] += normalise.Line(line).Quantity
+			}
+		}
+	}
+	return received
+}
+
+// Status is the status of an order given what has been received against
+// it: closed once every line is received in full, partially received once
+// anything is
+func Status(order *models.PurchaseOrder, received map[string]float64) string {
+	started, all := false, true
+	for _, l := range order.Lines {
+		if received[l.Product] > 0 {
+			started = true
+		}
+		if received[l.Product] < l.Quantity {
+			all = false
+		}
+	}
+	switch {
+	case all && len(order.Lines) > 0:
+		return models.OrderClosed
+	case started:
+		return models.OrderPartial
+	}
+	return models.OrderOpen
+}
+
+// LineMatch compares one product of an invoice with the order
+type LineMatch struct {
+	Product     string
+	ProductName string
+	// Ordered is zero for products not on the order
+	Ordered float64
+	// Before is what earlier approved invoices delivered
+	Before   float64
+	Invoiced float64
+	// AgreedRate and Rate are in rupees; Rate is the first rate billed
+	// that differs from the agreed one, or the agreed rate when none does
+	AgreedRate float64
+	Rate       float64
+	// Lines are the invoice lines of the product, by index
+	Lines    []int
+	Problems []string
+}
+
+// Outstanding is what is still to be delivered after the invoice
+func (m LineMatch) Outstanding() float64 {
+	return max(m.Ordered-m.Before-m.Invoiced, 0)
+}
+
+// Match is the comparison of an invoice with an order
+type Match struct {
+	Lines []LineMatch
+	// Unlinked are invoice lines not linked to a product, by index; they
+	// cannot be compared with the order
+	Unlinked []int
+	// Problems are the variances of the invoice: rates that differ from
+	// the agreed ones, over-deliveries and products not ordered
+	Problems []string
+	// Partial is set when products of the order are still to come
+	Partial bool
+}
+
+// MatchInvoice compares the lines of an invoice with an order, given what
+// was received against it before. Lines are matched on their linked
+// product.
+func MatchInvoice(order *models.PurchaseOrder, before map[string]float64, lines []models.InvoiceLine) *Match {
+	m := &Match{}
+	byProduct := make(map[string]int)
+	for _, l := range order.Lines {
+		byProduct[l.Product] = len(m.Lines)
+		m.Lines = append(m.Lines, LineMatch{
+			Product:     l.Product,
+			ProductName: l.ProductName,
+			Ordered:     l.Quantity,
+			Before:      before[l.Product],
+			AgreedRate:  l.Rate,
+			Rate:        l.Rate,
+		})
+	}
+
+	for i, line := range lines {
+		if line.ProductID == "" {
+			m.Unlinked = append(m.Unlinked, i)
+			continue
+		}
+		k, ok := byProduct[line.ProductID]
+		if !ok {
+			k = len(m.Lines)
+			byProduct[line.ProductID] = k
+			m.Lines = append(m.Lines, LineMatch{Product: line.ProductID, ProductName: line.ProductName})
+		}
+		lm := &m.Lines[k]
+		v := normalise.Line(line)
+		lm.Invoiced += v.Quantity
+		lm.Lines = append(lm.Lines, i)
+		if lm.Ordered > 0 && v.Rate > 0 && gst.Paise(v.Rate) != gst.Paise(lm.AgreedRate) && lm.Rate == lm.AgreedRate {
+			lm.Rate = v.Rate
+		}
+	}
+
+	for k := range m.Lines {
+		lm := &m.Lines[k]
+		switch {
+		case lm.Ordered == 0:
+			lm.Problems = append(lm.Problems, "not on the order")
+		case lm.Before+lm.Invoiced > lm.Ordered:
+			lm.Problems = append(lm.Problems, fmt.Sprintf("%g delivered against %g ordered", lm.Before+lm.Invoiced, lm.Ordered))
+		}
+		if lm.Rate != lm.AgreedRate {
+			lm.Problems = append(lm.Problems, fmt.Sprintf("billed at %.2f against the agreed %.2f", lm.Rate, lm.AgreedRate))
+		}
+		if lm.Ordered > 0 && lm.Outstanding() > 0 {
+			m.Partial = true
+		}
+		for _, p := range lm.Problems {
+			m.Problems = append(m.Problems, lm.ProductName+": "+p)
+		}
+	}
+	return m
+}
+
+// Pick chooses the order an invoice most likely delivers against: the
+// order of the invoice's supplier, not yet closed and not dated after the
+// invoice, that has the most of the invoice's products. Ties go to the
+// oldest order. It returns nil when no order has any of the products.
+func Pick(candidates []models.PurchaseOrder, file *models.ExcelFile) *models.PurchaseOrder {
+	if file.Supplier == "" {
+		return nil
+	}
+	products := make(map[string]bool)
+	for _, line := range file.Lines {
+		if line.ProductID != "" {
+			products[line.ProductID] = true
+		}
+	}
+	invoiceDate, dated := normalise.Date(file.InvoiceDate)
+
+	sorted := append([]models.PurchaseOrder(nil), candidates...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Date < sorted[j].Date })
+
+	var best *models.PurchaseOrder
+	bestScore := 0
+	for i := range sorted {
+		order := &sorted[i]
+		if order.Supplier != file.Supplier || order.Status == models.OrderClosed {
+			continue
+		}
+		if orderDate, ok := normalise.Date(order.Date); ok && dated && orderDate.After(invoiceDate) {
+			continue
+		}
+		score := 0
+		for _, l := range order.Lines {
+			if products[l.Product] {
+				score++
+			}
+		}
+		if score > bestScore {
+			best, bestScore = order, score
+		}
+	}
+	return best
+}
+
+// StatusLabel is the human readable form of an order status
+func StatusLabel(status string) string {
+	if status == "" {
+		return ""
+	}
+	return strings.ToUpper(status[:1]) + strings.ReplaceAll(status[1:], "_", " ")
+}
@@ -0,0 +1,189 @@
+// Package payables works out what is owed to suppliers: the due date of
+// each purchase invoice under the supplier's payment terms, how payments
+// settle invoices, the ageing of what is outstanding and the statement of a
+// supplier's account. Amounts are in paise and dates at midnight UTC.
+package payables
+
+import (
+	"sort"
+	"time"
+)
+
+// Bucket bounds, in days since the invoice date: 0-30, 31-60, 61-90, 90+
+var bucketDays = []int{30, 60, 90}
+
+// BucketLabels name the ageing buckets
+var BucketLabels = []string{"0-30 days", "31-60 days", "61-90 days", "90+ days"}
+
+// Bill is a purchase invoice owed to a supplier
+type Bill struct {
+	ID     string
+	Number string
+	Date   time.Time
+	Due    time.Time
+	Amount int64
+	// Paid is filled in by Allocate
+	Paid int64
+}
+
+// Outstanding is what is still owed on the bill
+func (b Bill) Outstanding() int64 {
+	return b.Amount - b.Paid
+}
+
+// DaysOverdue is how many days past its due date an unpaid bill is on a
+// day, zero when not yet due or paid
+func (b Bill) DaysOverdue(today time.Time) int {
+	if b.Outstanding() <= 0 || !today.After(b.Due) {
+		return 0
+	}
+	return int(today.Sub(b.Due).Hours() / 24)
+}
+
+// DueDate is the date an invoice falls due under payment terms in days
+func DueDate(date time.Time, termsDays int) time.Time {
+	return date.AddDate(0, 0, max(termsDays, 0))
+}
+
+// Payment is money paid to a supplier. Invoice is the bill it settles, or
+// empty for a payment on account.
+type Payment struct {
+	ID        string
+	Date      time.Time
+	Amount    int64
+	Invoice   string
+	Mode      string
+	Reference string
+}
+
+// Allocate settles bills with payments. A payment against an invoice goes
+// to that invoice first; payments on account, and whatever is left over
+// from a payment against an invoice, settle the oldest bills first. It
+// returns the amount paid that no bill is left to take.
+func Allocate(bills []Bill, payments []Payment) int64 {
+	sort.SliceStable(bills, func(i, j int) bool {
+		if !bills[i].Due.Equal(bills[j].Due) {
+			return bills[i].Due.Before(bills[j].Due)
+		}
+		return bills[i].Date.Before(bills[j].Date)
+	})
+	byID := make(map[string]int, len(bills))
+	for i := range bills {
+		bills[i].Paid = 0
+		byID[bills[i].ID] = i
+	}
+
+	sorted := append([]Payment(nil), payments...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Date.Before(sorted[j].Date) })
+
+	var onAccount int64
+	for _, p := range sorted {
+		left := p.Amount
+		if i, ok := byID[p.Invoice]; ok && p.Invoice != "" {
+			take := min(left, max(bills[i].Outstanding(), 0))
+			bills[i].Paid += take
+			left -= take
+		}
+		onAccount += left
+	}
+	for i := range bills {
+		if onAccount <= 0 {
+			break
+		}
+		take := min(onAccount, max(bills[i].Outstanding(), 0))
+		bills[i].Paid += take
+		onAccount -= take
+	}
+	return onAccount
+}
+
+// Ageing is what is outstanding by the age of the invoices, with the part
+// of it past due
+type Ageing struct {
+	Buckets [4]int64
+	Total   int64
+	Overdue int64
+}
+
+// Add ages the outstanding amount of a bill on a day
+func (a *Ageing) Add(b Bill, today time.Time) {
+	owed := b.Outstanding()
+	if owed <= 0 {
+		return
+	}
+	age := int(today.Sub(b.Date).Hours() / 24)
+	bucket := len(bucketDays)
+	for i, days := range bucketDays {
+		if age <= days {
+			bucket = i
+			break
+		}
+	}
+	a.Buckets[bucket] += owed
+	a.Total += owed
+	if b.DaysOverdue(today) > 0 {
+		a.Overdue += owed
+	}
+}
+
+// Merge adds another ageing to this one
+func (a *Ageing) Merge(other Ageing) {
+	for i := range a.Buckets {
+		a.Buckets[i] += other.Buckets[i]
+	}
+	a.Total += other.Total
+	a.Overdue += other.Overdue
+}
+
+// Entry is a line of a supplier statement. Bills raise the balance owed and
+// payments lower it.
+type Entry struct {
+	Date time.Time
+	// ID is the invoice or payment record
+	ID        string
+	Bill      bool
+	Reference string
+	Due       time.Time
+	Debit     int64
+	Credit    int64
+	Balance   int64
+}
+
+// Statement lists the bills and payments of a supplier from one day to
+// another, with the balance owed before the first day brought forward as
+// the opening balance. Bills come before payments of the same day.
+func Statement(bills []Bill, payments []Payment, from, to time.Time) (opening int64, entries []Entry) {
+	var all []Entry
+	for _, b := range bills {
+		all = append(all, Entry{Date: b.Date, ID: b.ID, Bill: true, Reference: b.Number, Due: b.Due, Credit: b.Amount})
+	}
+	for _, p := range payments {
+		reference := p.Mode
+		if p.Reference != "" {
+			reference += " " + p.Reference
+		}
+		all = append(all, Entry{Date: p.Date, ID: p.ID, Reference: reference, Debit: p.Amount})
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		if !all[i].Date.Equal(all[j].Date) {
+			return all[i].Date.Before(all[j].Date)
+		}
+		return all[i].Bill && !all[j].Bill
+	})
+
+	for _, e := range all {
+		if e.Date.Before(from) {
+			opening += e.Credit - e.Debit
+		}
+	}
+	balance := opening
+	for _, e := range all {
+		if e.Date.Before(from) || e.Date.After(to) {
+			continue
+		}
+		balance += e.Credit - e.Debit
+		e.Balance = balance
+		entries = append(entries, e)
+	}
+	return opening, entries
+}
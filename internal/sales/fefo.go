@@ -0,0 +1,78 @@
+package sales
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ashX04/new_website/internal/inventory"
+	"github.com/ashX04/new_website/internal/normalise"
+)
+
+// Allocation is the quantity of a product taken from one batch
+type Allocation struct {
+	Batch    string
+	Expiry   string
+	Quantity float64
+}
+
+// ShortageError reports that there is not enough sellable stock of a
+// product for a sale
+type ShortageError struct {
+	Product   string
+	Wanted    float64
+	Available float64
+}
+
+func (e *ShortageError) Error() string {
+	return fmt.Sprintf("only %g of %g in stock", e.Available, e.Wanted)
+}
+
+// Allocate takes a quantity of a product from the batches in stock, first
+// expiring first out. Expired batches are not sold, and batches whose expiry
+// cannot be read go last. What is taken is deducted from balances, so that
+// several lines of one product draw on the same stock; nothing is deducted
+// when there is not enough, and a ShortageError is returned instead.
+func Allocate(balances []inventory.Balance, product string, quantity float64, today time.Time) ([]Allocation, error) {
+	type candidate struct {
+		index     int
+		expiresOn time.Time
+		known     bool
+	}
+	var candidates []candidate
+	available := 0.0
+	for i, b := range balances {
+		if b.Product != product || b.Quantity <= 0 {
+			continue
+		}
+		expiresOn, known := normalise.ParseExpiry(b.Expiry)
+		if known && expiresOn.Before(today) {
+			continue
+		}
+		candidates = append(candidates, candidate{i, expiresOn, known})
+		available += b.Quantity
+	}
+	if quantity > available {
+		return nil, &ShortageError{Product: product, Wanted: quantity, Available: available}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].known != candidates[j].known {
+			return candidates[i].known
+		}
+		return candidates[i].expiresOn.Before(candidates[j].expiresOn)
+	})
+
+	var allocations []Allocation
+	left := quantity
+	for _, c := range candidates {
+		if left <= 0 {
+			break
+		}
+		b := &balances[c.index]
+		take := min(left, b.Quantity)
+		allocations = append(allocations, Allocation{Batch: b.Batch, Expiry: b.Expiry, Quantity: take})
+		b.Quantity -= take
+		left -= take
+	}
+	return allocations, nil
+}
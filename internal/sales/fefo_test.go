@@ -0,0 +1,115 @@
+package sales
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ashX04/new_website/internal/inventory"
+)
+
+func TestAllocate(t *testing.T) {
+	today := time.Date(2026, time.May, 1, 0, 0, 0, 0, time.UTC)
+	stock := func() []inventory.Balance {
+		return []inventory.Balance{
+			{Product: "p", Batch: "LATER", Expiry: "12/2026", Quantity: 5},
+			{Product: "p", Batch: "SOONER", Expiry: "06/2026", Quantity: 5},
+			{Product: "p", Batch: "EXPIRED", Expiry: "01/2026", Quantity: 10},
+			{Product: "p", Batch: "UNKNOWN", Expiry: "", Quantity: 10},
+			{Product: "p", Batch: "EMPTY", Expiry: "05/2026", Quantity: 0},
+			{Product: "q", Batch: "OTHER", Expiry: "05/2026", Quantity: 50},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		quantity float64
+		want     []Allocation
+		short    bool
+	}{
+		{
+			name:     "first expiring batch first",
+			quantity: 3,
+			want:     []Allocation{{Batch: "SOONER", Expiry: "06/2026", Quantity: 3}},
+		},
+		{
+			name:     "spills over into the next batch",
+			quantity: 8,
+			want: []Allocation{
+				{Batch: "SOONER", Expiry: "06/2026", Quantity: 5},
+				{Batch: "LATER", Expiry: "12/2026", Quantity: 3},
+			},
+		},
+		{
+			name:     "unknown expiry goes last and expired batches are skipped",
+			quantity: 15,
+			want: []Allocation{
+				{Batch: "SOONER", Expiry: "06/2026", Quantity: 5},
+				{Batch: "LATER", Expiry: "12/2026", Quantity: 5},
+				{Batch: "UNKNOWN", Expiry: "", Quantity: 5},
+			},
+		},
+		{
+			name:     "more than the sellable stock",
+			quantity: 21,
+			short:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			balances := stock()
+			got, err := Allocate(balances, "p", tt.quantity, today)
+			if tt.short {
+				var shortage *ShortageError
+				if !errors.As(err, &shortage) {
+					t.Fatalf("Allocate() error = %v, want a ShortageError", err)
+				}
+				if shortage.Available != 20 || shortage.Wanted != tt.quantity {
+					t.Errorf("ShortageError = %+v, want 20 available of %g", shortage, tt.quantity)
+				}
+				if !reflect.DeepEqual(balances, stock()) {
+					t.Errorf("balances changed on a shortage: %+v", balances)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Allocate() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Allocate() = %+v, want %+v", got, tt.want)
+			}
+			taken := 0.0
+			for i, b := range stock() {
+				taken += b.Quantity - balances[i].Quantity
+			}
+			if taken != tt.quantity {
+				t.Errorf("%g deducted from balances, want %g", taken, tt.quantity)
+			}
+		})
+	}
+}
+
+func TestAllocateDrawsOnTheSameStock(t *testing.T) {
+	today := time.Date(2026, time.May, 1, 0, 0, 0, 0, time.UTC)
+	balances := []inventory.Balance{
+		{Product: "p", Batch: "THIS", Expiry: "05/2026", Quantity: 5},
+		{Product: "p", Batch: "NEXT", Expiry: "07/2026", Quantity: 5},
+	}
+
+	if _, err := Allocate(balances, "p", 4, today); err != nil {
+		t.Fatalf("first Allocate() error = %v", err)
+	}
+	got, err := Allocate(balances, "p", 4, today)
+	if err != nil {
+		t.Fatalf("second Allocate() error = %v", err)
+	}
+	want := []Allocation{
+		{Batch: "THIS", Expiry: "05/2026", Quantity: 1},
+		{Batch: "NEXT", Expiry: "07/2026", Quantity: 3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("second Allocate() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,87 @@
+// Package sales works out the invoices the account issues to its customers:
+// their numbering per financial year, the batches stock is sold from, the
+// tax charged and the stock movements they post.
+package sales
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ashX04/new_website/internal/inventory"
+	"github.com/ashX04/new_website/internal/models"
+)
+
+// YearStart is 1 April of the Indian financial year a date falls in
+func YearStart(date time.Time) time.Time {
+	year := date.Year()
+	if date.Month() < time.April {
+		year--
+	}
+	return time.Date(year, time.April, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// FinancialYear names the financial year a date falls in, as 2026-27
+func FinancialYear(date time.Time) string {
+	start := YearStart(date).Year()
+	return fmt.Sprintf("%d-%02d", start, (start+1)%100)
+}
+
+// NextNumber is the next invoice number of a series, one more than the
+// highest number taken in it: INV/2026-27/0001, INV/2026-27/0002 and so on.
+// Each financial year starts its own series.
+func NextNumber(prefix, year string, taken []string) string {
+	series := prefix + "/" + year + "/"
+	highest := 0
+	for _, number := range taken {
+		rest, ok := strings.CutPrefix(number, series)
+		if !ok {
+			continue
+		}
+		if n, err := strconv.Atoi(rest); err == nil && n > highest {
+			highest = n
+		}
+	}
+	return fmt.Sprintf("%s%04d", series, highest+1)
+}
+
+// Movements builds the stock-out movements of a sales invoice, one per line
+func Movements(sale *models.SalesInvoice) []models.StockMovement {
+	movements := make([]models.StockMovement, 0, len(sale.Lines))
+	for _, line := range sale.Lines {
+		movements = append(movements, models.StockMovement{
+			User:     sale.User,
+			Product:  line.Product,
+			Batch:    inventory.NormaliseBatch(line.Batch),
+			Expiry:   line.Expiry,
+			Quantity: -line.Quantity,
+			Kind:     models.MovementSale,
+			Sale:     sale.ID,
+			Note:     "sales invoice " + sale.Number,
+		})
+	}
+	return movements
+}
+
+// Cancellations builds the movements that return to stock what a sales
+// invoice still takes out of it, given the ledger entries posted from it
+func Cancellations(sale *models.SalesInvoice, posted []models.StockMovement) []models.StockMovement {
+	var movements []models.StockMovement
+	for _, b := range inventory.Balances(posted) {
+		if b.Quantity == 0 {
+			continue
+		}
+		movements = append(movements, models.StockMovement{
+			User:     sale.User,
+			Product:  b.Product,
+			Batch:    b.Batch,
+			Expiry:   b.Expiry,
+			Quantity: -b.Quantity,
+			Kind:     models.MovementSaleCancellation,
+			Sale:     sale.ID,
+			Note:     "Cancellation of sales invoice " + sale.Number,
+		})
+	}
+	return movements
+}
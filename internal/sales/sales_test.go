@@ -0,0 +1,76 @@
+package sales
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFinancialYear(t *testing.T) {
+	tests := []struct {
+		date      string
+		wantYear  string
+		wantStart string
+	}{
+		{"2026-03-31", "2025-26", "2025-04-01"},
+		{"2026-04-01", "2026-27", "2026-04-01"},
+		{"2026-12-31", "2026-27", "2026-04-01"},
+		{"2027-01-01", "2026-27", "2026-04-01"},
+		{"1999-04-01", "1999-00", "1999-04-01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.date, func(t *testing.T) {
+			date, err := time.Parse("2006-01-02", tt.date)
+			if err != nil {
+				t.Fatalf("parsing %s: %v", tt.date, err)
+			}
+			if got := FinancialYear(date); got != tt.wantYear {
+				t.Errorf("FinancialYear() = %q, want %q", got, tt.wantYear)
+			}
+			if got := YearStart(date).Format("2006-01-02"); got != tt.wantStart {
+				t.Errorf("YearStart() = %s, want %s", got, tt.wantStart)
+			}
+		})
+	}
+}
+
+func TestNextNumber(t *testing.T) {
+	tests := []struct {
+		name  string
+		taken []string
+		want  string
+	}{
+		{
+			name: "first invoice of the year",
+			want: "INV/2026-27/0001",
+		},
+		{
+			name:  "one more than the highest, not the count",
+			taken: []string{"INV/2026-27/0001", "INV/2026-27/0009", "INV/2026-27/0004"},
+			want:  "INV/2026-27/0010",
+		},
+		{
+			name:  "other years and prefixes start their own series",
+			taken: []string{"INV/2025-26/0042", "SI/2026-27/0100"},
+			want:  "INV/2026-27/0001",
+		},
+		{
+			name:  "numbers that do not parse are skipped",
+			taken: []string{"INV/2026-27/0003", "INV/2026-27/draft"},
+			want:  "INV/2026-27/0004",
+		},
+		{
+			name:  "the series outgrows four digits",
+			taken: []string{"INV/2026-27/9999"},
+			want:  "INV/2026-27/10000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NextNumber("INV", "2026-27", tt.taken); got != tt.want {
+				t.Errorf("NextNumber() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
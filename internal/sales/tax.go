@@ -0,0 +1,102 @@
+package sales
+
+import (
+	"math"
+	"sort"
+
+	"github.com/ashX04/new_website/internal/gst"
+	"github.com/ashX04/new_website/internal/models"
+)
+
+// HSNTotal is the taxable value and tax of one HSN code at one rate, a row
+// of the HSN summary printed on an invoice
+type HSNTotal struct {
+	HSN string
+	gst.RateTotal
+}
+
+// Tax is the tax worked out for a sales invoice. Amounts are in paise.
+type Tax struct {
+	// Taxable is the taxable value of each line
+	Taxable []int64
+	// Rates are the totals per rate, in ascending order of rate
+	Rates []gst.RateTotal
+	// HSN are the totals per HSN code and rate
+	HSN   []HSNTotal
+	Total gst.RateTotal
+	// RoundOff brings the invoice value to whole rupees
+	RoundOff int64
+	Value    int64
+}
+
+// Compute works out the tax of a sales invoice: the GST rate is charged as
+// IGST on inter-state supplies and as CGST and SGST halves otherwise. As on
+// purchase invoices, tax is worked out on each rate's total taxable value.
+func Compute(lines []models.SaleLine, supply gst.Supply) Tax {
+	t := Tax{Taxable: make([]int64, len(lines))}
+	split := func(rate int64) gst.RateTotal {
+		r := gst.RateTotal{Rate: rate}
+		if supply == gst.SupplyInterState {
+			r.IGSTRate = rate
+		} else {
+			r.CGSTRate, r.SGSTRate = rate/2, rate/2
+		}
+		return r
+	}
+	taxOn := func(r *gst.RateTotal) {
+		if supply == gst.SupplyInterState {
+			r.IGST = gst.TaxOn(r.Taxable, r.IGSTRate)
+			return
+		}
+		// Rates are whole basis points, so CGSTRate and SGSTRate cut an odd
+		// rate such as 0.25% short; each half is worked out from the full
+		// rate instead
+		half := int64(math.Round(float64(r.Taxable) * float64(r.Rate) / 20000))
+		r.CGST, r.SGST = half, half
+	}
+
+	type hsnKey struct {
+		hsn  string
+		rate int64
+	}
+	rates := make(map[int64]*gst.RateTotal)
+	hsn := make(map[hsnKey]*HSNTotal)
+	for i, line := range lines {
+		taxable := gst.Paise(line.Quantity * line.Rate * (1 - line.Discount/100))
+		t.Taxable[i] = taxable
+		rate := gst.BasisPoints(line.GSTRate)
+		if rates[rate] == nil {
+			r := split(rate)
+			rates[rate] = &r
+		}
+		rates[rate].Taxable += taxable
+		key := hsnKey{line.HSN, rate}
+		if hsn[key] == nil {
+			hsn[key] = &HSNTotal{HSN: line.HSN, RateTotal: split(rate)}
+		}
+		hsn[key].Taxable += taxable
+	}
+
+	for _, r := range rates {
+		taxOn(r)
+		t.Rates = append(t.Rates, *r)
+		t.Total.Add(*r)
+	}
+	sort.Slice(t.Rates, func(i, j int) bool { return t.Rates[i].Rate < t.Rates[j].Rate })
+	for _, h := range hsn {
+		taxOn(&h.RateTotal)
+		t.HSN = append(t.HSN, *h)
+	}
+	sort.Slice(t.HSN, func(i, j int) bool {
+		if t.HSN[i].HSN != t.HSN[j].HSN {
+			return t.HSN[i].HSN < t.HSN[j].HSN
+		}
+		return t.HSN[i].Rate < t.HSN[j].Rate
+	})
+
+	value := t.Total.Taxable + t.Total.Tax()
+	rounded := int64(math.Round(float64(value)/100)) * 100
+	t.RoundOff = rounded - value
+	t.Value = rounded
+	return t
+}
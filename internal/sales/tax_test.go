@@ -0,0 +1,144 @@
+package sales
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ashX04/new_website/internal/gst"
+	"github.com/ashX04/new_website/internal/models"
+)
+
+func TestCompute(t *testing.T) {
+	tests := []struct {
+		name         string
+		lines        []models.SaleLine
+		supply       gst.Supply
+		wantTaxable  []int64
+		wantTotal    gst.RateTotal
+		wantRoundOff int64
+		wantValue    int64
+	}{
+		{
+			name:        "intra-state rate is halved into CGST and SGST",
+			lines:       []models.SaleLine{{Quantity: 10, Rate: 100, GSTRate: 12}},
+			supply:      gst.SupplyIntraState,
+			wantTaxable: []int64{100000},
+			wantTotal:   gst.RateTotal{Taxable: 100000, CGST: 6000, SGST: 6000},
+			wantValue:   112000,
+		},
+		{
+			name:        "inter-state rate is charged as IGST",
+			lines:       []models.SaleLine{{Quantity: 10, Rate: 100, GSTRate: 12}},
+			supply:      gst.SupplyInterState,
+			wantTaxable: []int64{100000},
+			wantTotal:   gst.RateTotal{Taxable: 100000, IGST: 12000},
+			wantValue:   112000,
+		},
+		{
+			name:         "odd basis-point rate is not cut short when halved",
+			lines:        []models.SaleLine{{Quantity: 1, Rate: 1000, GSTRate: 0.25}},
+			supply:       gst.SupplyIntraState,
+			wantTaxable:  []int64{100000},
+			wantTotal:    gst.RateTotal{Taxable: 100000, CGST: 125, SGST: 125},
+			wantRoundOff: 50,
+			wantValue:    100300,
+		},
+		{
+			name:         "odd basis-point rate between states",
+			lines:        []models.SaleLine{{Quantity: 1, Rate: 1000, GSTRate: 0.25}},
+			supply:       gst.SupplyInterState,
+			wantTaxable:  []int64{100000},
+			wantTotal:    gst.RateTotal{Taxable: 100000, IGST: 250},
+			wantRoundOff: 50,
+			wantValue:    100300,
+		},
+		{
+			name:         "value is rounded up to whole rupees",
+			lines:        []models.SaleLine{{Quantity: 1, Rate: 99.99, GSTRate: 5}},
+			supply:       gst.SupplyIntraState,
+			wantTaxable:  []int64{9999},
+			wantTotal:    gst.RateTotal{Taxable: 9999, CGST: 250, SGST: 250},
+			wantRoundOff: 1,
+			wantValue:    10500,
+		},
+		{
+			name:         "value is rounded down to whole rupees",
+			lines:        []models.SaleLine{{Quantity: 1, Rate: 10.10, GSTRate: 12}},
+			supply:       gst.SupplyIntraState,
+			wantTaxable:  []int64{1010},
+			wantTotal:    gst.RateTotal{Taxable: 1010, CGST: 61, SGST: 61},
+			wantRoundOff: -32,
+			wantValue:    1100,
+		},
+		{
+			name:         "discount comes off the taxable value",
+			lines:        []models.SaleLine{{Quantity: 2, Rate: 50, Discount: 10, GSTRate: 5}},
+			supply:       gst.SupplyIntraState,
+			wantTaxable:  []int64{9000},
+			wantTotal:    gst.RateTotal{Taxable: 9000, CGST: 225, SGST: 225},
+			wantRoundOff: 50,
+			wantValue:    9500,
+		},
+		{
+			name: "tax is worked out on each rate's total",
+			lines: []models.SaleLine{
+				{Quantity: 1, Rate: 0.04, GSTRate: 18},
+				{Quantity: 1, Rate: 0.04, GSTRate: 18},
+				{Quantity: 1, Rate: 0.04, GSTRate: 18},
+			},
+			supply:       gst.SupplyInterState,
+			wantTaxable:  []int64{4, 4, 4},
+			wantTotal:    gst.RateTotal{Taxable: 12, IGST: 2},
+			wantRoundOff: -14,
+			wantValue:    0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Compute(tt.lines, tt.supply)
+			if !reflect.DeepEqual(got.Taxable, tt.wantTaxable) {
+				t.Errorf("Taxable = %v, want %v", got.Taxable, tt.wantTaxable)
+			}
+			if got.Total != tt.wantTotal {
+				t.Errorf("Total = %+v, want %+v", got.Total, tt.wantTotal)
+			}
+			if got.RoundOff != tt.wantRoundOff {
+				t.Errorf("RoundOff = %d, want %d", got.RoundOff, tt.wantRoundOff)
+			}
+			if got.Value != tt.wantValue {
+				t.Errorf("Value = %d, want %d", got.Value, tt.wantValue)
+			}
+			if got.Value != got.Total.Taxable+got.Total.Tax()+got.RoundOff {
+				t.Errorf("Value %d is not taxable %d plus tax %d plus round off %d",
+					got.Value, got.Total.Taxable, got.Total.Tax(), got.RoundOff)
+			}
+		})
+	}
+}
+
+func TestComputeSummaries(t *testing.T) {
+	lines := []models.SaleLine{
+		{HSN: "3004", Quantity: 1, Rate: 100, GSTRate: 12},
+		{HSN: "3004", Quantity: 1, Rate: 100, GSTRate: 5},
+		{HSN: "2106", Quantity: 1, Rate: 100, GSTRate: 12},
+	}
+	got := Compute(lines, gst.SupplyIntraState)
+
+	wantRates := []gst.RateTotal{
+		{Rate: 500, CGSTRate: 250, SGSTRate: 250, Taxable: 10000, CGST: 250, SGST: 250},
+		{Rate: 1200, CGSTRate: 600, SGSTRate: 600, Taxable: 20000, CGST: 1200, SGST: 1200},
+	}
+	if !reflect.DeepEqual(got.Rates, wantRates) {
+		t.Errorf("Rates = %+v, want %+v", got.Rates, wantRates)
+	}
+
+	wantHSN := []HSNTotal{
+		{HSN: "2106", RateTotal: gst.RateTotal{Rate: 1200, CGSTRate: 600, SGSTRate: 600, Taxable: 10000, CGST: 600, SGST: 600}},
+		{HSN: "3004", RateTotal: gst.RateTotal{Rate: 500, CGSTRate: 250, SGSTRate: 250, Taxable: 10000, CGST: 250, SGST: 250}},
+		{HSN: "3004", RateTotal: gst.RateTotal{Rate: 1200, CGSTRate: 600, SGSTRate: 600, Taxable: 10000, CGST: 600, SGST: 600}},
+	}
+	if !reflect.DeepEqual(got.HSN, wantHSN) {
+		t.Errorf("HSN = %+v, want %+v", got.HSN, wantHSN)
+	}
+}
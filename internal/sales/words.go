@@ -0,0 +1,59 @@
+package sales
+
+import "strings"
+
+var ones = []string{"", "One", "Two", "Three", "Four", "Five", "Six", "Seven", "Eight", "Nine",
+	"Ten", "Eleven", "Twelve", "Thirteen", "Fourteen", "Fifteen", "Sixteen", "Seventeen",
+	"Eighteen", "Nineteen"}
+
+var tens = []string{"", "", "Twenty", "Thirty", "Forty", "Fifty", "Sixty", "Seventy", "Eighty", "Ninety"}
+
+// InWords spells out an amount in paise the way Indian invoices print it,
+// in crores, lakhs and thousands: "Rupees One Lakh Twelve Thousand and
+// Fifty Paise Only"
+func InWords(paise int64) string {
+	if paise < 0 {
+		return "Minus " + InWords(-paise)
+	}
+	rupees, rest := paise/100, paise%100
+	words := "Rupees " + indian(rupees)
+	if rupees == 0 {
+		words = "Rupees Zero"
+	}
+	if rest > 0 {
+		words += " and " + belowHundred(rest) + " Paise"
+	}
+	return words + " Only"
+}
+
+// indian spells out a whole number in the Indian system
+func indian(n int64) string {
+	var parts []string
+	if n >= 10000000 {
+		parts = append(parts, indian(n/10000000)+" Crore")
+		n %= 10000000
+	}
+	for _, unit := range []struct {
+		size int64
+		name string
+	}{{100000, "Lakh"}, {1000, "Thousand"}, {100, "Hundred"}} {
+		if n >= unit.size {
+			parts = append(parts, belowHundred(n/unit.size)+" "+unit.name)
+			n %= unit.size
+		}
+	}
+	if n > 0 {
+		parts = append(parts, belowHundred(n))
+	}
+	return strings.Join(parts, " ")
+}
+
+func belowHundred(n int64) string {
+	if n < 20 {
+		return ones[n]
+	}
+	if n%10 == 0 {
+		return tens[n/10]
+	}
+	return tens[n/10] + " " + ones[n%10]
+}
@@ -0,0 +1,29 @@
+package sales
+
+import "testing"
+
+func TestInWords(t *testing.T) {
+	tests := []struct {
+		paise int64
+		want  string
+	}{
+		{0, "Rupees Zero Only"},
+		{5, "Rupees Zero and Five Paise Only"},
+		{100, "Rupees One Only"},
+		{1900, "Rupees Nineteen Only"},
+		{4200, "Rupees Forty Two Only"},
+		{10000, "Rupees One Hundred Only"},
+		{11205000, "Rupees One Lakh Twelve Thousand Fifty Only"},
+		{11200050, "Rupees One Lakh Twelve Thousand and Fifty Paise Only"},
+		{10000000000, "Rupees Ten Crore Only"},
+		{12345678912, "Rupees Twelve Crore Thirty Four Lakh Fifty Six Thousand Seven Hundred Eighty Nine and Twelve Paise Only"},
+		{1000000000000, "Rupees One Thousand Crore Only"},
+		{-150, "Minus Rupees One and Fifty Paise Only"},
+	}
+
+	for _, tt := range tests {
+		if got := InWords(tt.paise); got != tt.want {
+			t.Errorf("InWords(%d) = %q, want %q", tt.paise, got, tt.want)
+		}
+	}
+}
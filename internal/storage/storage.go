@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// ErrNotFound is returned when a blob does not exist
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore stores the artifacts produced for each invoice: the source
+// image, the raw OCR response and the generated workbook.
+type BlobStore interface {
+	// Put stores the contents of r under key, replacing any existing blob
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	// Get opens the blob stored under key
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob stored under key. Missing blobs are not an error.
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a URL that allows downloading the blob without a
+	// session until ttl has elapsed. If downloadName is set the response is
+	// served as an attachment with that filename.
+	SignedURL(ctx context.Context, key, downloadName string, ttl time.Duration) (string, error)
+}
+
+// Default is the store used by the handlers. It is set up in main.
+var Default BlobStore
+
+// Key builds the blob key for an artifact of an upload. Keys are grouped by
+// user and by the storage ID assigned to the upload.
+func Key(userID, storageID, name string) string {
+	return path.Join(userID, storageID, name)
+}
+
+// validateKey rejects keys that could escape the store's namespace
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("invalid blob key %q", key)
+		}
+	}
+	return nil
+}
+
+// NewFromEnv creates the blob store selected by STORAGE_BACKEND ("fs", the
+// default, or "s3").
+func NewFromEnv() (BlobStore, error) {
+	// The .env file is optional; variables may come from the environment
+	_ = godotenv.Load()
+
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "", "fs":
+		dir := os.Getenv("STORAGE_DIR")
+		if dir == "" {
+			dir = "storage"
+		}
+		key := []byte(os.Getenv("BLOB_SIGNING_KEY"))
+		if len(key) == 0 {
+			log.Printf("BLOB_SIGNING_KEY not set, using a random key; download links will not survive a restart")
+			key = make([]byte, 32)
+			if _, err := rand.Read(key); err != nil {
+				return nil, fmt.Errorf("failed to generate signing key: %w", err)
+			}
+		}
+		return NewFSStore(dir, "/blobs", key)
+	case "s3":
+		return NewS3Store(S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
@@ -0,0 +1,319 @@
+// Package tally converts approved purchase invoices into Tally Prime XML
+// vouchers that accountants can import instead of retyping them.
+package tally
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ashX04/new_website/internal/gst"
+	"github.com/ashX04/new_website/internal/models"
+	"github.com/ashX04/new_website/internal/normalise"
+)
+
+// maxRoundOff is the largest difference, in paise, between the lines and
+// the printed invoice total that is booked to the round off ledger
+const maxRoundOff = 100
+
+// godown is the location stock items are received into
+const godown = "Main Location"
+
+// unit is the unit of measure of quantities on item invoices
+const unit = "Nos"
+
+// Party is the supplier ledger a purchase voucher is credited to
+type Party struct {
+	Ledger string
+	GSTIN  string
+}
+
+// Voucher is a Tally purchase voucher
+type Voucher struct {
+	XMLName         xml.Name         `xml:"VOUCHER"`
+	VchType         string           `xml:"VCHTYPE,attr"`
+	Action          string           `xml:"ACTION,attr"`
+	ObjView         string           `xml:"OBJVIEW,attr"`
+	Date            string           `xml:"DATE"`
+	VoucherTypeName string           `xml:"VOUCHERTYPENAME"`
+	Reference       string           `xml:"REFERENCE"`
+	ReferenceDate   string           `xml:"REFERENCEDATE"`
+	PartyLedgerName string           `xml:"PARTYLEDGERNAME"`
+	PartyGSTIN      string           `xml:"PARTYGSTIN,omitempty"`
+	StateName       string           `xml:"STATENAME,omitempty"`
+	IsInvoice       string           `xml:"ISINVOICE"`
+	PersistedView   string           `xml:"PERSISTEDVIEW"`
+	Narration       string           `xml:"NARRATION"`
+	Inventory       []InventoryEntry `xml:"ALLINVENTORYENTRIES.LIST"`
+	Ledgers         []LedgerEntry    `xml:"LEDGERENTRIES.LIST"`
+}
+
+// InventoryEntry is a stock item line of an item invoice
+type InventoryEntry struct {
+	StockItemName    string            `xml:"STOCKITEMNAME"`
+	IsDeemedPositive string            `xml:"ISDEEMEDPOSITIVE"`
+	Rate             string            `xml:"RATE,omitempty"`
+	Amount           string            `xml:"AMOUNT"`
+	ActualQty        string            `xml:"ACTUALQTY"`
+	BilledQty        string            `xml:"BILLEDQTY"`
+	Batches          []BatchAllocation `xml:"BATCHALLOCATIONS.LIST"`
+	Accounts         []LedgerEntry     `xml:"ACCOUNTINGALLOCATIONS.LIST"`
+}
+
+// BatchAllocation is the batch and godown stock is received into
+type BatchAllocation struct {
+	GodownName   string  `xml:"GODOWNNAME"`
+	BatchName    string  `xml:"BATCHNAME"`
+	ExpiryPeriod *Expiry `xml:"EXPIRYPERIOD,omitempty"`
+	Amount       string  `xml:"AMOUNT"`
+	ActualQty    string  `xml:"ACTUALQTY"`
+	BilledQty    string  `xml:"BILLEDQTY"`
+}
+
+// Expiry is the expiry date of a batch
+type Expiry struct {
+	P    string `xml:"P,attr"`
+	Date string `xml:",chardata"`
+}
+
+// LedgerEntry is a ledger line of a voucher
+type LedgerEntry struct {
+	LedgerName       string           `xml:"LEDGERNAME"`
+	IsDeemedPositive string           `xml:"ISDEEMEDPOSITIVE"`
+	IsPartyLedger    string           `xml:"ISPARTYLEDGER,omitempty"`
+	Amount           string           `xml:"AMOUNT"`
+	Bills            []BillAllocation `xml:"BILLALLOCATIONS.LIST,omitempty"`
+}
+
+// BillAllocation ties the party amount to the supplier's bill, so that it
+// shows up in Tally's outstanding payables
+type BillAllocation struct {
+	Name     string `xml:"NAME"`
+	BillType string `xml:"BILLTYPE"`
+	Amount   string `xml:"AMOUNT"`
+}
+
+// PurchaseVoucher builds the purchase voucher of an invoice, with its tax
+// worked out by gst.ComputeInvoice for the supply. Invoices whose tax does
+// not fit the supply are refused rather than posted to the wrong ledgers.
+// stockItems maps product IDs to Tally stock item names and is only used
+// for item invoices.
+func PurchaseVoucher(file *models.ExcelFile, party Party, supply gst.Supply, stockItems map[string]string, ledgers models.TallyLedgers) (*Voucher, error) {
+	if party.Ledger == "" {
+		return nil, fmt.Errorf("invoice has no supplier")
+	}
+	date, ok := normalise.Date(file.InvoiceDate)
+	if !ok {
+		return nil, fmt.Errorf("invoice date %q is not readable", file.InvoiceDate)
+	}
+	if problems := gst.InvoiceProblems(file.Lines, supply); len(problems) > 0 {
+		return nil, fmt.Errorf("tax does not match the supply: %s", strings.Join(problems, "; "))
+	}
+	tax, err := gst.ComputeInvoice(file.Lines, supply)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Voucher{
+		VchType:         ledgers.VoucherType,
+		Action:          "Create",
+		Date:            date.Format("20060102"),
+		VoucherTypeName: ledgers.VoucherType,
+		Reference:       file.InvoiceNumber,
+		ReferenceDate:   date.Format("20060102"),
+		PartyLedgerName: party.Ledger,
+		PartyGSTIN:      party.GSTIN,
+		StateName:       gst.StateName(gst.StateCode(party.GSTIN)),
+		IsInvoice:       "Yes",
+	}
+	if ledgers.WithInventory {
+		v.ObjView = "Invoice Voucher View"
+		for _, l := range tax.Lines {
+			v.Inventory = append(v.Inventory, inventoryEntry(file.Lines[l.Index], l, stockItems, ledgerName(ledgers.Purchase, l.Rate())))
+		}
+	} else {
+		v.ObjView = "Accounting Voucher View"
+	}
+	v.PersistedView = v.ObjView
+
+	// Debits are added up per ledger, in the order ledgers first appear
+	var debits []LedgerEntry
+	debited := make(map[string]int64)
+	var order []string
+	add := func(ledger string, p int64) {
+		if _, ok := debited[ledger]; !ok {
+			order = append(order, ledger)
+		}
+		debited[ledger] += p
+	}
+	if !ledgers.WithInventory {
+		for _, r := range tax.Rates {
+			add(ledgerName(ledgers.Purchase, r.Rate), r.Taxable)
+		}
+	}
+	for _, r := range tax.Rates {
+		if r.CGST != 0 {
+			add(ledgerName(ledgers.CGST, r.CGSTRate), r.CGST)
+		}
+	}
+	for _, r := range tax.Rates {
+		if r.SGST != 0 {
+			add(ledgerName(ledgers.SGST, r.SGSTRate), r.SGST)
+		}
+	}
+	for _, r := range tax.Rates {
+		if r.IGST != 0 {
+			add(ledgerName(ledgers.IGST, r.IGSTRate), r.IGST)
+		}
+	}
+	for _, r := range tax.Rates {
+		if r.Cess != 0 {
+			add(ledgerName(ledgers.Cess, r.CessRate), r.Cess)
+		}
+	}
+	for _, ledger := range order {
+		debits = append(debits, debit(ledger, debited[ledger]))
+	}
+	totals := tax.Total()
+	total := totals.Taxable + totals.Tax()
+
+	v.Narration = fmt.Sprintf("Supplier invoice %s dated %s", file.InvoiceNumber, file.InvoiceDate)
+	payable := total
+	if printed := gst.Paise(file.InvoiceTotal); printed > 0 && printed != total {
+		if diff := printed - total; diff >= -maxRoundOff && diff <= maxRoundOff {
+			debits = append(debits, debit(ledgers.RoundOff, diff))
+			payable = printed
+		} else {
+			v.Narration += fmt.Sprintf(". Lines total %s differs from the invoice total %s", amount(total), amount(printed))
+		}
+	}
+
+	reference := file.InvoiceNumber
+	if reference == "" {
+		reference = file.ID
+	}
+	v.Ledgers = append([]LedgerEntry{{
+		LedgerName:       party.Ledger,
+		IsDeemedPositive: "No",
+		IsPartyLedger:    "Yes",
+		Amount:           amount(payable),
+		Bills:            []BillAllocation{{Name: reference, BillType: "New Ref", Amount: amount(payable)}},
+	}}, debits...)
+	return v, nil
+}
+
+// inventoryEntry is the stock item line of an invoice line. Free goods are
+// received but not billed.
+func inventoryEntry(line models.InvoiceLine, l gst.TaxedLine, stockItems map[string]string, purchaseLedger string) InventoryEntry {
+	name := stockItems[line.ProductID]
+	if name == "" {
+		name = strings.TrimSpace(line.ProductName)
+	}
+	actual := quantity(l.Values.Quantity + l.Values.Free)
+	billed := quantity(l.Values.Quantity)
+
+	batch := BatchAllocation{
+		GodownName: godown,
+		BatchName:  strings.TrimSpace(line.Batch),
+		Amount:     amount(-l.Taxable),
+		ActualQty:  actual,
+		BilledQty:  billed,
+	}
+	if batch.BatchName == "" {
+		batch.BatchName = "Primary Batch"
+	}
+	if !l.Values.Expiry.IsZero() {
+		expiry := l.Values.Expiry.Format("2-Jan-2006")
+		batch.ExpiryPeriod = &Expiry{P: expiry, Date: expiry}
+	}
+
+	entry := InventoryEntry{
+		StockItemName:    name,
+		IsDeemedPositive: "Yes",
+		Amount:           amount(-l.Taxable),
+		ActualQty:        actual,
+		BilledQty:        billed,
+		Batches:          []BatchAllocation{batch},
+		Accounts:         []LedgerEntry{debit(purchaseLedger, l.Taxable)},
+	}
+	if l.Values.Rate > 0 {
+		entry.Rate = fmt.Sprintf("%s/%s", amount(gst.Paise(l.Values.Rate)), unit)
+	}
+	return entry
+}
+
+// debit is a ledger entry debiting an amount in paise. Tally writes debits
+// as negative amounts that are deemed positive.
+func debit(ledger string, p int64) LedgerEntry {
+	entry := LedgerEntry{LedgerName: ledger, IsDeemedPositive: "Yes", Amount: amount(-p)}
+	if p < 0 {
+		entry.IsDeemedPositive = "No"
+	}
+	return entry
+}
+
+// Write writes vouchers as one Tally import envelope
+func Write(w io.Writer, company string, vouchers []*Voucher) error {
+	env := envelope{}
+	env.Header.TallyRequest = "Import Data"
+	env.Body.ImportData.RequestDesc.ReportName = "Vouchers"
+	env.Body.ImportData.RequestDesc.StaticVariables.Company = company
+	for _, v := range vouchers {
+		env.Body.ImportData.RequestData.Messages = append(env.Body.ImportData.RequestData.Messages, message{Voucher: v})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", " ")
+	if err := enc.Encode(env); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+type envelope struct {
+	XMLName xml.Name `xml:"ENVELOPE"`
+	Header  struct {
+		TallyRequest string `xml:"TALLYREQUEST"`
+	} `xml:"HEADER"`
+	Body struct {
+		ImportData struct {
+			RequestDesc struct {
+				ReportName      string `xml:"REPORTNAME"`
+				StaticVariables struct {
+					Company string `xml:"SVCURRENTCOMPANY,omitempty"`
+				} `xml:"STATICVARIABLES"`
+			} `xml:"REQUESTDESC"`
+			RequestData struct {
+				Messages []message `xml:"TALLYMESSAGE"`
+			} `xml:"REQUESTDATA"`
+		} `xml:"IMPORTDATA"`
+	} `xml:"BODY"`
+}
+
+type message struct {
+	Voucher *Voucher `xml:"VOUCHER"`
+}
+
+// ledgerName fills the tax rate into a ledger name
+func ledgerName(name string, rate int64) string {
+	return strings.ReplaceAll(name, "{rate}", strconv.FormatFloat(gst.Percent(rate), 'f', -1, 64))
+}
+
+// amount formats paise as rupees with two decimals
+func amount(p int64) string {
+	sign := ""
+	if p < 0 {
+		sign, p = "-", -p
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, p/100, p%100)
+}
+
+func quantity(q float64) string {
+	return strconv.FormatFloat(q, 'f', -1, 64) + " " + unit
+}
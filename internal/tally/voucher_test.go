@@ -0,0 +1,228 @@
+package tally
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ashX04/new_website/internal/gst"
+	"github.com/ashX04/new_website/internal/models"
+)
+
+func TestPurchaseVoucher(t *testing.T) {
+	lines := []models.InvoiceLine{
+		{ProductName: "Crocin 500", Amount: "1000.00", GST: "12"},
+		{ProductName: "ORS Sachet", Amount: "500", GST: "5"},
+	}
+	party := Party{Ledger: "Sharma Pharma", GSTIN: "27AAPFU0939F1ZV"}
+
+	type entry struct {
+		Ledger string
+		Amount string
+	}
+	tests := []struct {
+		name          string
+		lines         []models.InvoiceLine
+		total         float64
+		supply        gst.Supply
+		withInventory bool
+		want          []entry
+		wantItems     []entry
+		narration     string
+	}{
+		{
+			name:   "intra-state purchase split into CGST and SGST",
+			lines:  lines,
+			total:  1645,
+			supply: gst.SupplyIntraState,
+			want: []entry{
+				{"Sharma Pharma", "1645.00"},
+				{"Purchase @ 5%", "-500.00"},
+				{"Purchase @ 12%", "-1000.00"},
+				{"Input CGST @ 2.5%", "-12.50"},
+				{"Input CGST @ 6%", "-60.00"},
+				{"Input SGST @ 2.5%", "-12.50"},
+				{"Input SGST @ 6%", "-60.00"},
+			},
+		},
+		{
+			name:   "inter-state purchase charged as IGST",
+			lines:  lines,
+			total:  1645,
+			supply: gst.SupplyInterState,
+			want: []entry{
+				{"Sharma Pharma", "1645.00"},
+				{"Purchase @ 5%", "-500.00"},
+				{"Purchase @ 12%", "-1000.00"},
+				{"Input IGST @ 5%", "-25.00"},
+				{"Input IGST @ 12%", "-120.00"},
+			},
+		},
+		{
+			name:   "printed total above the lines is debited to round off",
+			lines:  lines,
+			total:  1645.40,
+			supply: gst.SupplyIntraState,
+			want: []entry{
+				{"Sharma Pharma", "1645.40"},
+				{"Purchase @ 5%", "-500.00"},
+				{"Purchase @ 12%", "-1000.00"},
+				{"Input CGST @ 2.5%", "-12.50"},
+				{"Input CGST @ 6%", "-60.00"},
+				{"Input SGST @ 2.5%", "-12.50"},
+				{"Input SGST @ 6%", "-60.00"},
+				{"Round Off", "-0.40"},
+			},
+		},
+		{
+			name:   "printed total below the lines is credited to round off",
+			lines:  lines,
+			total:  1644.60,
+			supply: gst.SupplyIntraState,
+			want: []entry{
+				{"Sharma Pharma", "1644.60"},
+				{"Purchase @ 5%", "-500.00"},
+				{"Purchase @ 12%", "-1000.00"},
+				{"Input CGST @ 2.5%", "-12.50"},
+				{"Input CGST @ 6%", "-60.00"},
+				{"Input SGST @ 2.5%", "-12.50"},
+				{"Input SGST @ 6%", "-60.00"},
+				{"Round Off", "0.40"},
+			},
+		},
+		{
+			name:   "printed total too far off is noted, not rounded",
+			lines:  lines,
+			total:  1700,
+			supply: gst.SupplyInterState,
+			want: []entry{
+				{"Sharma Pharma", "1645.00"},
+				{"Purchase @ 5%", "-500.00"},
+				{"Purchase @ 12%", "-1000.00"},
+				{"Input IGST @ 5%", "-25.00"},
+				{"Input IGST @ 12%", "-120.00"},
+			},
+			narration: "Lines total 1645.00 differs from the invoice total 1700.00",
+		},
+		{
+			name: "item invoice debits purchases through its stock items",
+			lines: []models.InvoiceLine{
+				{ProductName: "Crocin 500", ProductID: "p1", Quantity: "10", Free: "1", Rate: "100", Amount: "1000", GST: "12", Batch: "B1", Expiry: "03/27"},
+			},
+			total:         1120,
+			supply:        gst.SupplyIntraState,
+			withInventory: true,
+			want: []entry{
+				{"Sharma Pharma", "1120.00"},
+				{"Input CGST @ 6%", "-60.00"},
+				{"Input SGST @ 6%", "-60.00"},
+			},
+			wantItems: []entry{{"Crocin 500 Tab", "-1000.00"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := &models.ExcelFile{ID: "file1", Lines: tt.lines}
+			file.InvoiceNumber = "SP/1234"
+			file.InvoiceDate = "2026-04-15"
+			file.InvoiceTotal = tt.total
+			ledgers := models.DefaultTallyLedgers
+			ledgers.WithInventory = tt.withInventory
+			v, err := PurchaseVoucher(file, party, tt.supply, map[string]string{"p1": "Crocin 500 Tab"}, ledgers)
+			if err != nil {
+				t.Fatalf("PurchaseVoucher() error = %v", err)
+			}
+
+			var got []entry
+			for _, l := range v.Ledgers {
+				got = append(got, entry{l.LedgerName, l.Amount})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ledgers = %v, want %v", got, tt.want)
+			}
+			var items []entry
+			for _, item := range v.Inventory {
+				items = append(items, entry{item.StockItemName, item.Amount})
+			}
+			if !reflect.DeepEqual(items, tt.wantItems) {
+				t.Errorf("inventory = %v, want %v", items, tt.wantItems)
+			}
+			if !strings.Contains(v.Narration, tt.narration) {
+				t.Errorf("narration %q does not mention %q", v.Narration, tt.narration)
+			}
+
+			// Tally refuses vouchers whose debits do not match the party
+			// credit
+			balance := int64(0)
+			for _, l := range v.Ledgers {
+				balance += paise(t, l.Amount)
+			}
+			for _, item := range v.Inventory {
+				balance += paise(t, item.Amount)
+			}
+			if balance != 0 {
+				t.Errorf("voucher is off by %d paise", balance)
+			}
+			if party := v.Ledgers[0]; len(party.Bills) != 1 || party.Bills[0].Amount != party.Amount {
+				t.Errorf("bill allocation %+v does not carry the party amount %s", party.Bills, party.Amount)
+			}
+		})
+	}
+}
+
+func TestPurchaseVoucherRefusals(t *testing.T) {
+	tests := []struct {
+		name   string
+		party  Party
+		date   string
+		line   models.InvoiceLine
+		supply gst.Supply
+	}{
+		{
+			name:   "no supplier",
+			date:   "2026-04-15",
+			line:   models.InvoiceLine{ProductName: "Crocin", Amount: "100", GST: "12"},
+			supply: gst.SupplyIntraState,
+		},
+		{
+			name:   "unreadable date",
+			party:  Party{Ledger: "Sharma Pharma"},
+			date:   "sometime",
+			line:   models.InvoiceLine{ProductName: "Crocin", Amount: "100", GST: "12"},
+			supply: gst.SupplyIntraState,
+		},
+		{
+			name:   "IGST on an intra-state supply",
+			party:  Party{Ledger: "Sharma Pharma"},
+			date:   "2026-04-15",
+			line:   models.InvoiceLine{ProductName: "Crocin", Amount: "100", IGST: "12"},
+			supply: gst.SupplyIntraState,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := &models.ExcelFile{Lines: []models.InvoiceLine{tt.line}}
+			file.InvoiceDate = tt.date
+			if v, err := PurchaseVoucher(file, tt.party, tt.supply, nil, models.DefaultTallyLedgers); err == nil {
+				t.Errorf("PurchaseVoucher() = %+v, want an error", v)
+			}
+		})
+	}
+}
+
+// paise reads an amount written by amount back into paise
+func paise(t *testing.T, s string) int64 {
+	t.Helper()
+	rupees, fraction, _ := strings.Cut(strings.TrimPrefix(s, "-"), ".")
+	n, err := strconv.ParseInt(rupees+fraction, 10, 64)
+	if err != nil {
+		t.Fatalf("amount %q: %v", s, err)
+	}
+	if strings.HasPrefix(s, "-") {
+		return -n
+	}
+	return n
+}
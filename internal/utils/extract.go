@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"encoding/csv"
+	"strings"
+
+	"github.com/ashX04/new_website/internal/models"
+	"github.com/ashX04/new_website/internal/normalise"
+)
+
+// headerPrompt asks the model for the invoice header after the CSV
+const headerPrompt = " After the CSV, give the invoice header between <#> tags as one 'key: value' line each for supplier_name, supplier_gstin, buyer_gstin (the GSTIN the invoice is billed to), invoice_number, invoice_date (DD-MM-YYYY) and invoice_total (grand total as a plain number). Leave a value empty if it is not on the invoice."
+
+// taxPrompt tells the model how GST is split between CGST, SGST and IGST
+const taxPrompt = " Copy the tax rates as printed: an invoice within one state charges CGST and SGST, each half of GST, and leaves IGST empty; an inter-state invoice charges IGST, equal to GST, and leaves CGST and SGST empty. Do not split IGST into CGST and SGST."
+
+// ParseInvoiceHeader reads the header block the model writes between <#>
+// tags. Missing or unreadable fields are left empty.
+func ParseInvoiceHeader(response string) models.InvoiceHeader {
+	var header models.InvoiceHeader
+
+	start := strings.Index(response, "<#>")
+	end := strings.LastIndex(response, "<#>")
+	if start == -1 || end <= start {
+		return header
+	}
+
+	for _, line := range strings.Split(response[start+3:end], "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "supplier_name":
+			header.SupplierName = value
+		case "supplier_gstin":
+			header.SupplierGSTIN = strings.ToUpper(strings.ReplaceAll(value, " ", ""))
+		case "buyer_gstin":
+			header.BuyerGSTIN = strings.ToUpper(strings.ReplaceAll(value, " ", ""))
+		case "invoice_number":
+			header.InvoiceNumber = value
+		case "invoice_date":
+			header.InvoiceDate = value
+		case "invoice_total":
+			header.InvoiceTotal, _ = normalise.Number(value)
+		}
+	}
+	return header
+}
+
+// LinePrompt describes the line item CSV the model should produce for the
+// columns of an output template
+func LinePrompt(columns []models.TemplateColumn) string {
+	names := make([]string, len(columns))
+	var required []string
+	for i, col := range columns {
+		names[i] = col.Name
+		if col.Description != "" {
+			names[i] += " (" + col.Description + ")"
+		}
+		if col.Required {
+			required = append(required, col.Name)
+		}
+	}
+	prompt := "convert it to a CSV in this column order: " + strings.Join(names, ",") + "."
+	if len(required) > 0 {
+		prompt += " Always fill in " + strings.Join(required, ", ") + "; leave other values empty if they are not on the invoice."
+	}
+	return prompt
+}
+
+// ParseInvoiceLines maps CSV rows in the column order of an output template
+// onto invoice lines. A leading header row and rows without a product name
+// are skipped.
+func ParseInvoiceLines(rows [][]string, columns []models.TemplateColumn) []models.InvoiceLine {
+	var lines []models.InvoiceLine
+	for i, cols := range rows {
+		if i == 0 && IsHeaderRow(cols, columns) {
+			continue
+		}
+		var line models.InvoiceLine
+		for j, col := range columns {
+			if j < len(cols) {
+				line.SetField(col.Field, strings.TrimSpace(cols[j]))
+			}
+		}
+		if line.ProductName == "" {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// IsHeaderRow reports whether a CSV row is the column header rather than a
+// line item: its product cell, or most of its filled cells, repeat the name
+// or field of their template column. Cells that merely contain such a word,
+// as in "Dairy Products Mix", do not count.
+func IsHeaderRow(cols []string, columns []models.TemplateColumn) bool {
+	filled, matches := 0, 0
+	for j, col := range cols {
+		if strings.TrimSpace(col) != "" {
+			filled++
+		}
+		if j >= len(columns) || !isColumnHeader(col, columns[j]) {
+			continue
+		}
+		if columns[j].Field == "product_name" {
+			return true
+		}
+		matches++
+	}
+	return matches >= 2 && matches*2 > filled
+}
+
+// isColumnHeader reports whether a cell is the name of column, or its field
+// written as words ("product_name" as "Product Name")
+func isColumnHeader(cell string, column models.TemplateColumn) bool {
+	cell = strings.TrimSpace(cell)
+	return cell != "" && (strings.EqualFold(cell, column.Name) ||
+		strings.EqualFold(cell, column.Field) ||
+		strings.EqualFold(cell, strings.ReplaceAll(column.Field, "_", " ")))
+}
+
+// SearchText builds the lower-cased text that dashboard search matches
+// against: supplier, invoice number, product names and batches
+func SearchText(header models.InvoiceHeader, lines []models.InvoiceLine) string {
+	parts := []string{header.SupplierName, header.SupplierGSTIN, header.InvoiceNumber}
+	for _, line := range lines {
+		parts = append(parts, line.ProductName, line.Batch)
+	}
+	return strings.ToLower(strings.Join(strings.Fields(strings.Join(parts, " ")), " "))
+}
+
+// SplitCSVRow splits one row of the CSV the model returns. Quoted fields may
+// contain commas, as in "1,23,456.50"; a row that is not valid CSV is split
+// on every comma.
+func SplitCSVRow(row string) []string {
+	r := csv.NewReader(strings.NewReader(row))
+	r.LazyQuotes = true
+	r.TrimLeadingSpace = true
+	cols, err := r.Read()
+	if err != nil {
+		return strings.Split(row, ",")
+	}
+	return cols
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ReadResult is the response of the Azure Vision Read operation
+type ReadResult struct {
+	Status        string `json:"status"`
+	AnalyzeResult struct {
+		ReadResults []ReadPage `json:"readResults"`
+	} `json:"analyzeResult"`
+}
+
+// ReadPage holds the recognised lines of one page or image
+type ReadPage struct {
+	Page   int        `json:"page"`
+	Angle  float64    `json:"angle"`
+	Width  float64    `json:"width"`
+	Height float64    `json:"height"`
+	Unit   string     `json:"unit"`
+	Lines  []ReadLine `json:"lines"`
+}
+
+// ReadLine is a single recognised line of text
+type ReadLine struct {
+	Text        string    `json:"text"`
+	BoundingBox []float64 `json:"boundingBox"`
+}
+
+// ParseReadResult decodes a Read operation response
+func ParseReadResult(data string) (*ReadResult, error) {
+	var result ReadResult
+	if err := json.Unmarshal([]byte(data), &result); err != nil {
+		return nil, fmt.Errorf("failed to parse OCR response: %w", err)
+	}
+	return &result, nil
+}
+
+// Text joins the recognised lines of every page. Multi-page documents get a
+// "--- Page N ---" marker before each page so that the page a line came
+// from is preserved for the extraction step.
+func (r *ReadResult) Text() string {
+	pages := r.AnalyzeResult.ReadResults
+	var b strings.Builder
+	for i, page := range pages {
+		if len(pages) > 1 {
+			pageNo := page.Page
+			if pageNo == 0 {
+				pageNo = i + 1
+			}
+			fmt.Fprintf(&b, "\n--- Page %d ---\n", pageNo)
+		}
+		for _, line := range page.Lines {
+			b.WriteString(line.Text)
+			b.WriteString(" ")
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// PageCount returns the number of pages in the result
+func (r *ReadResult) PageCount() int {
+	return len(r.AnalyzeResult.ReadResults)
+}
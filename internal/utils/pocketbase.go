@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// PocketBaseURL is the base URL of the PocketBase instance
+const PocketBaseURL = "http://127.0.0.1:8090"
+
+// ErrRecordNotFound is returned when PocketBase responds with 404
+var ErrRecordNotFound = errors.New("record not found")
+
+// ListResponse is the envelope PocketBase uses for paginated list responses
+type ListResponse[T any] struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"perPage"`
+	TotalItems int `json:"totalItems"`
+	TotalPages int `json:"totalPages"`
+	Items      []T `json:"items"`
+}
+
+// RecordsURL returns the records endpoint of a collection
+func RecordsURL(collection string) string {
+	return fmt.Sprintf("%s/api/collections/%s/records", PocketBaseURL, url.PathEscape(collection))
+}
+
+// RecordURL returns the endpoint of a single record
+func RecordURL(collection, id string) string {
+	return RecordsURL(collection) + "/" + url.PathEscape(id)
+}
+
+// PBGetRecord fetches a single record and decodes it into out
+func PBGetRecord(collection, id string, out interface{}) error {
+	if !ValidateFileID(id) {
+		return fmt.Errorf("invalid record ID")
+	}
+	return pbDo(http.MethodGet, RecordURL(collection, id), nil, out)
+}
+
+// PBCreateRecord creates a record from data and decodes the result into out
+func PBCreateRecord(collection string, data interface{}, out interface{}) error {
+	return pbDo(http.MethodPost, RecordsURL(collection), data, out)
+}
+
+// PBUpdateRecord patches a record with data and decodes the result into out
+func PBUpdateRecord(collection, id string, data interface{}, out interface{}) error {
+	if !ValidateFileID(id) {
+		return fmt.Errorf("invalid record ID")
+	}
+	return pbDo(http.MethodPatch, RecordURL(collection, id), data, out)
+}
+
+// PBDeleteRecord deletes a record
+func PBDeleteRecord(collection, id string) error {
+	if !ValidateFileID(id) {
+		return fmt.Errorf("invalid record ID")
+	}
+	return pbDo(http.MethodDelete, RecordURL(collection, id), nil, nil)
+}
+
+// PBListRecords fetches a single page of records
+func PBListRecords[T any](collection string, params url.Values) (*ListResponse[T], error) {
+	var resp ListResponse[T]
+	if err := pbDo(http.MethodGet, RecordsURL(collection)+"?"+params.Encode(), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// PBListAll fetches every page of records matching params
+func PBListAll[T any](collection string, params url.Values) ([]T, error) {
+	q := url.Values{}
+	for k, v := range params {
+		q[k] = v
+	}
+	q.Set("perPage", "500")
+
+	var items []T
+	for page := 1; ; page++ {
+		q.Set("page", strconv.Itoa(page))
+		resp, err := PBListRecords[T](collection, q)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, resp.Items...)
+		if page >= resp.TotalPages || len(resp.Items) == 0 {
+			return items, nil
+		}
+	}
+}
+
+// pbTimeLayout is the layout of PocketBase date fields, always in UTC
+const pbTimeLayout = "2006-01-02 15:04:05.000Z"
+
+// PBTime formats t for comparison with PocketBase date fields
+func PBTime(t time.Time) string {
+	return t.UTC().Format(pbTimeLayout)
+}
+
+// ParsePBTime parses a PocketBase date field
+func ParsePBTime(value string) (time.Time, error) {
+	return time.Parse("2006-01-02 15:04:05.999Z", value)
+}
+
+// recordIDChars are the characters of PocketBase record IDs
+const recordIDChars = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// NewRecordID returns a random ID in PocketBase's format, for records whose
+// ID must be known before they are created
+func NewRecordID() string {
+	id := make([]byte, 15)
+	random := make([]byte, len(id))
+	if _, err := rand.Read(random); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	for i := range id {
+		id[i] = recordIDChars[int(random[i])%len(recordIDChars)]
+	}
+	return string(id)
+}
+
+// PBQuote quotes a value for use inside a PocketBase filter expression
+func PBQuote(value string) string {
+	b, _ := json.Marshal(value)
+	return string(b)
+}
+
+func pbDo(method, rawURL string, data interface{}, out interface{}) error {
+	var body io.Reader
+	if data != nil {
+		payload, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, rawURL, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := SecureClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("PocketBase request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrRecordNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("PocketBase returned status %d: %s", resp.StatusCode, respBody)
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode PocketBase response: %w", err)
+	}
+	return nil
+}
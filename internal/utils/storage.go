@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+)
+
+// UploadDir is the root of the local staging area for uploads. It is never
+// served over HTTP; files only leave it through authenticated handlers.
+const UploadDir = "uploads"
+
+// UserUploadDir returns (and creates) the staging directory for a user.
+func UserUploadDir(userID string) (string, error) {
+	if !ValidateFileID(userID) {
+		return "", fmt.Errorf("invalid user ID")
+	}
+	dir := filepath.Join(UploadDir, userID)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return "", fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	return dir, nil
+}
+
+// NewStorageID returns a random identifier used to name stored artifacts so
+// that uploads with the same original filename never overwrite each other.
+func NewStorageID() string {
+	return uuid.NewString()
+}
+
+// WriteFileAtomic writes r to path by streaming into a temporary file in the
+// same directory and renaming it into place, so readers never observe a
+// partially written file.
+func WriteFileAtomic(path string, r io.Reader) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return fmt.Errorf("failed to move file into place: %w", err)
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -10,10 +11,18 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/ashX04/new_website/internal/models"
 	"github.com/joho/godotenv"
 	openai "github.com/sashabaranov/go-openai"
 )
 
+const (
+	// ocrPollInterval is the delay between checks of a running OCR operation
+	ocrPollInterval = 2 * time.Second
+	// ocrTimeout bounds how long we wait for an OCR operation to finish
+	ocrTimeout = 2 * time.Minute
+)
+
 // SendImageToAPI sends an image to the Azure Vision API
 func SendImageToAPI(imagePath string) (*http.Response, error) {
 	err := godotenv.Load()
@@ -49,9 +58,12 @@ func SendImageToAPI(imagePath string) (*http.Response, error) {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	// Add necessary headers
-	req.Header.Set("Content-Type", "application/octet-stream")
-	req.Header.Set("Content-Type", "image/jpeg")
+	// Add necessary headers. PDFs are read as multi-page documents.
+	contentType := "application/octet-stream"
+	if IsPDF(imagePath) {
+		contentType = "application/pdf"
+	}
+	req.Header.Set("Content-Type", contentType)
 	req.Header.Set("Ocp-Apim-Subscription-Key", apiToken)
 
 	// Send the request using http.Client
@@ -85,15 +97,41 @@ func HandleAPIResponse(resp *http.Response) (string, error) {
 
 	apiURL := resp.Header.Get("Operation-Location")
 	fmt.Println("Operation-Location:", apiURL)
-
-	time.Sleep(2 * time.Second)
-
-	response, err := MakeGetRequestWithAuth(apiURL, apiToken)
-	if err != nil {
-		fmt.Println("Error:", err)
-		return "error", err
+	if apiURL == "" {
+		body, _ := io.ReadAll(resp.Body)
+		return "error", fmt.Errorf("OCR request rejected with status %d: %s", resp.StatusCode, body)
+	}
+
+	// Multi-page documents take a while to read, so poll until the
+	// operation has finished
+	deadline := time.Now().Add(ocrTimeout)
+	for {
+		time.Sleep(ocrPollInterval)
+
+		response, err := MakeGetRequestWithAuth(apiURL, apiToken)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return "error", err
+		}
+
+		var operation struct {
+			Status string `json:"status"`
+		}
+		if err := json.Unmarshal([]byte(response), &operation); err != nil {
+			return "error", fmt.Errorf("failed to parse OCR status: %w", err)
+		}
+
+		switch operation.Status {
+		case "succeeded":
+			return response, nil
+		case "failed":
+			return "error", fmt.Errorf("OCR operation failed")
+		}
+
+		if time.Now().After(deadline) {
+			return "error", fmt.Errorf("timed out waiting for OCR result (status %q)", operation.Status)
+		}
 	}
-	return response, nil
 }
 
 // MakeGetRequestWithAuth makes a GET request with authentication
@@ -131,9 +169,21 @@ func MakeGetRequestWithAuth(apiURL string, token string) (string, error) {
 	return string(bodyBytes), nil
 }
 
-// SendJSONToOpenAI sends JSON data to OpenAI and returns the processed data
-func SendJSONToOpenAI(data string) (string, error) {
-	prompt := fmt.Sprintf("Use this to make a table %s now convert it to a CSV in this column order: Serial.no.,Quantity.,Pack,HSN no.,Product_name,batch no.,Expiry date,MRP,S.Rate(selling rate),GST,CGST,SGST,Amount (GST is cgst = sgst). Ignore other data and only give the CSV and nothing else. Also put <*> at the start and end of the CSV.", data)
+// SendJSONToOpenAI sends JSON data to OpenAI and returns the processed data.
+// pages is the number of pages the text was read from; columns are the
+// columns of the account's output template.
+func SendJSONToOpenAI(data string, pages int, columns []models.TemplateColumn) (string, error) {
+	prompt := fmt.Sprintf("Use this to make a table %s now %s%s Quote any value that contains a comma. Ignore other data and only give the CSV and nothing else. Also put <*> at the start and end of the CSV.", data, LinePrompt(columns), taxPrompt)
+	prompt += headerPrompt
+	if pages > 1 {
+		prompt += fmt.Sprintf(" The text comes from a %d page document and each page starts with a '--- Page N ---' marker. The line item table may continue across pages: merge it into a single table with one header row, skip repeated headers, page totals and carried forward lines, and keep the serial numbers continuous.", pages)
+	}
+
+	// Longer documents produce more rows
+	maxTokens := 1500 * max(pages, 1)
+	if maxTokens > 8000 {
+		maxTokens = 8000
+	}
 
 	err := godotenv.Load()
 	if err != nil {
@@ -145,7 +195,7 @@ func SendJSONToOpenAI(data string) (string, error) {
 	ctx := context.Background()
 	req := openai.ChatCompletionRequest{
 		Model:     openai.GPT4oMini,
-		MaxTokens: 1500,
+		MaxTokens: maxTokens,
 		Messages: []openai.ChatCompletionMessage{
 			{
 				Role:    openai.ChatMessageRoleUser,
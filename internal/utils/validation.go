@@ -2,14 +2,32 @@ package utils
 
 import (
 	"net/url"
+	"path/filepath"
 	"regexp"
+	"strings"
 )
 
 var (
 	// Regex for validating file IDs
 	fileIDRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+	// File types accepted by the OCR provider
+	allowedUploadExts = map[string]bool{
+		".jpg": true, ".jpeg": true, ".png": true, ".bmp": true,
+		".tif": true, ".tiff": true, ".pdf": true,
+	}
 )
 
+// ValidateUploadType checks that a file can be sent to OCR
+func ValidateUploadType(filename string) bool {
+	return allowedUploadExts[strings.ToLower(filepath.Ext(filename))]
+}
+
+// IsPDF reports whether a file name or blob key refers to a PDF document
+func IsPDF(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".pdf")
+}
+
 // ValidateFileID checks if the file ID is safe
 func ValidateFileID(id string) bool {
 	return fileIDRegex.MatchString(id) && len(id) <= 100